@@ -0,0 +1,44 @@
+// Package buildinfo reports which build of the API is running.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version and Commit are set when building a release:
+//
+//	go build -ldflags "-X github.com/DaffaJatmiko/go-rest-project-manager/buildinfo.Version=v1.2.0 -X github.com/DaffaJatmiko/go-rest-project-manager/buildinfo.Commit=$(git rev-parse HEAD)" ./cmd
+//
+// Without them, the commit recorded by the Go toolchain is used.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build info of the running binary.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+	if info.Commit != "" {
+		return info
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
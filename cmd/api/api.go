@@ -2,36 +2,45 @@ package api
 
 import (
 	"log"
+	"log/slog"
 	"net/http"
 
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
 	"github.com/DaffaJatmiko/go-rest-project-manager/service"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
 	"github.com/gorilla/mux"
 )
 
 type APIServer struct {
-	addr  string
-	store repository.Store
+	addr   string
+	store  repository.Store
+	keys   *keyring.Keyring
+	checks []service.HealthCheck
 }
 
-func NewAPIServer(addr string, store repository.Store) *APIServer {
-	return &APIServer{addr: addr, store: store}
+// NewAPIServer returns the API server. checks decide whether /readyz
+// reports the server ready.
+func NewAPIServer(addr string, store repository.Store, keys *keyring.Keyring, checks ...service.HealthCheck) *APIServer {
+	return &APIServer{addr: addr, store: store, keys: keys, checks: checks}
 }
 
 func (s *APIServer) Serve() {
-	router := mux.NewRouter()
-	subRouter := router.PathPrefix("/api/v1").Subrouter()
-
-	// registering services
-	userService := service.NewUserService(s.store)
-	userService.RegisterRoutes(subRouter)
-
-	taskService := service.NewTaskService(s.store)
-	taskService.RegisterRoutes(subRouter)
+	limiter, err := middleware.NewRateLimiter(middleware.NewMemoryRateLimitStore(), config.Envs.RateLimitDefault, config.Envs.RateLimitRoutes)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	projectService := service.NewProjectService(s.store)
-	projectService.RegisterRoutes(subRouter)
-
-	log.Println("Starting the API server at", s.addr)
-	log.Fatal(http.ListenAndServe(s.addr, subRouter))
-}
\ No newline at end of file
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(utils.NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(utils.MethodNotAllowed)
+	router.Use(middleware.LogRoute, middleware.TraceRoute)
+	router.Use(limiter.Middleware)
+	service.RegisterRoutes(router, s.store, mailer.New(config.Envs), s.keys, s.checks...)
+
+	slog.Info("Starting the API server", "addr", s.addr)
+	log.Fatal(http.ListenAndServe(s.addr, middleware.Trace(middleware.RequestLogger(middleware.CORS(config.Envs.CORSAllowedOrigins, router)))))
+}
@@ -1,16 +1,49 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
 	"log"
+	"log/slog"
 
+	"github.com/DaffaJatmiko/go-rest-project-manager/buildinfo"
 	"github.com/DaffaJatmiko/go-rest-project-manager/cmd/api"
 	"github.com/DaffaJatmiko/go-rest-project-manager/config"
 	"github.com/DaffaJatmiko/go-rest-project-manager/db"
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/metrics"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/service"
+	"github.com/DaffaJatmiko/go-rest-project-manager/tracing"
 	"github.com/go-sql-driver/mysql"
 )
 
 func main() {
+	promoteAdmin := flag.String("promote-admin", "", "make the user with this email an admin and exit")
+	flag.Parse()
+
+	if err := config.Envs.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	logging.Setup(config.Envs)
+	info := buildinfo.Get()
+	slog.Info("Starting go-rest-project-manager", "version", info.Version, "commit", info.Commit, "go_version", info.GoVersion)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	keys, err := keyring.Load(config.Envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	middleware.SetKeyring(keys)
+
 	cfg := mysql.Config{
 		User: 								config.Envs.DBUser,
 		Passwd: 							config.Envs.DBPassword,
@@ -21,14 +54,41 @@ func main() {
 		ParseTime: 						true,
 	}
 
-	sqlStorage := db.NewMysqlStorage(cfg)
+	connectCtx, cancel := context.WithTimeout(context.Background(), config.Envs.DBConnectTimeout)
+	sqlStorage, err := db.NewMysqlStorage(connectCtx, cfg)
+	cancel()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	db, err := sqlStorage.Init()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	store := repository.NewStore(db)
-	api := api.NewAPIServer(":3000", store)
+	store := metrics.InstrumentStore(repository.NewStore(db))
+	metrics.RegisterDatabase(db, config.Envs.DBName, store)
+	ctx := context.Background()
+
+	if *promoteAdmin != "" {
+		user, err := store.GetUserByEmail(ctx, *promoteAdmin)
+		if err == sql.ErrNoRows {
+			log.Fatalf("no user with email %s", *promoteAdmin)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := service.PromoteAdmin(ctx, store, user, "promoted from the command line"); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	service.BootstrapAdmins(ctx, store, config.Envs.AdminEmails)
+
+	api := api.NewAPIServer(":3000", store, keys,
+		service.HealthCheck{Name: "database", Check: sqlStorage.Ping},
+		service.HealthCheck{Name: "migrations", Check: sqlStorage.CheckMigrations},
+	)
 	api.Serve()
 }
\ No newline at end of file
@@ -1,30 +1,275 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
+	// Env is the deployment environment. Outside "development" the API
+	// refuses to start with default or weak secrets.
+	Env        string
 	Port       string
 	DBUser     string
 	DBPassword string
 	DBAddress  string
 	DBName     string
 	JWTSecret  string
+
+	// JWTKeys lists asymmetric signing keys as "kid=path/to/key.pem", each
+	// optionally followed by "@" and an RFC 3339 activation time. When set,
+	// JWTSecret is no longer used to sign tokens.
+	JWTKeys []string
+	JWTTTL  time.Duration
+	// JWTKeyOverlap is how long a superseded key still verifies tokens.
+	JWTKeyOverlap time.Duration
+	// ShareLinkSecret signs the tokens of public project share links.
+	// Changing it invalidates every existing link.
+	ShareLinkSecret string
+
+	// Browser sessions are kept in an HttpOnly cookie. CookieSameSite is
+	// "lax", "strict" or "none"; "none" requires CookieSecure.
+	CookieSecure   bool
+	CookieDomain   string
+	CookieSameSite string
+	// CORSAllowedOrigins lists the origins, such as the SPA, that may call
+	// the API from a browser with credentials.
+	CORSAllowedOrigins []string
+
+	// AppURL is the public base URL used to build links sent by email.
+	AppURL                   string
+	MailFrom                 string
+	SMTPHost                 string
+	SMTPPort                 string
+	SMTPUser                 string
+	SMTPPassword             string
+	RequireEmailVerification bool
+	PasswordResetTTL         time.Duration
+	EmailVerificationTTL     time.Duration
+	// OrgInvitationTTL is how long an invitation to an organization can be
+	// accepted.
+	OrgInvitationTTL time.Duration
+	// ProjectInvitationTTL is how long an invitation to a project can be
+	// accepted.
+	ProjectInvitationTTL time.Duration
+	// TOTPIssuer is the account issuer shown in authenticator apps.
+	TOTPIssuer string
+
+	// LoginMaxAttempts is the number of failed logins allowed per account
+	// before it is locked for LoginLockoutDuration. LoginIPMaxAttempts is
+	// the equivalent limit per client IP.
+	LoginMaxAttempts     int
+	LoginIPMaxAttempts   int
+	LoginLockoutDuration time.Duration
+	// TrustProxyHeaders makes X-Forwarded-For and X-Real-IP count as the
+	// client IP. Only enable it behind a proxy that sets these headers.
+	// TrustedProxyHops is the number of proxies in front of the API, each of
+	// which appends to X-Forwarded-For.
+	TrustProxyHeaders bool
+	TrustedProxyHops  int
+	// AdminEmails are promoted to the admin role at startup, once their
+	// accounts exist and, if verification is required, are verified.
+	AdminEmails []string
+	// ImpersonationTTL is how long a support session started by an
+	// administrator lasts.
+	ImpersonationTTL time.Duration
+	// RateLimitDefault is the request limit of every route without a limit
+	// of its own, such as "300/m", counted per user or, for anonymous
+	// requests, per client IP. "off" leaves those routes unlimited.
+	RateLimitDefault string
+	// RateLimitRoutes sets the limits of single routes, each given as
+	// "METHOD /path/template=limit" or "/path/template=limit".
+	RateLimitRoutes []string
+	// LogLevel is debug, info, warn or error. LogFormat is json, for log
+	// collectors, or text, for reading logs in a terminal.
+	LogLevel  string
+	LogFormat string
+	// LogPIIFields names the log attributes, such as "email", that hold
+	// personal data. Their values are logged as fingerprints.
+	LogPIIFields []string
+	// MetricsToken, when set, must be sent as a bearer token to read
+	// /metrics. Outside development /metrics is only served with one.
+	MetricsToken string
+	// TracingExporter sends traces to an OTLP collector, "otlp", or prints
+	// them, "stdout". Tracing is off when it is empty. The collector is set
+	// through the standard OTEL_EXPORTER_OTLP_* variables.
+	TracingExporter string
+	// TracingSampleRatio is the share of traces started here that are
+	// recorded. Requests that arrive in a sampled trace are always recorded.
+	TracingSampleRatio float64
+	// ServiceName names the API in traces.
+	ServiceName string
+	// DBConnectTimeout bounds how long startup waits for the database.
+	DBConnectTimeout time.Duration
+	// PprofEnabled serves the Go profiler under /debug/pprof to
+	// administrators.
+	PprofEnabled bool
+	// MaxBodyBytes limits the size of JSON request bodies.
+	MaxBodyBytes int64
+	// IfMatchRequired refuses changes to tasks and projects that do not
+	// send the ETag they are based on in If-Match.
+	IfMatchRequired bool
+
+	// OIDCIssuer enables single sign-on through an OpenID Connect provider.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
 }
 
+const (
+	defaultJWTSecret       = "randomjwtsecret"
+	defaultShareLinkSecret = "randomsharelinksecret"
+	minJWTSecretLen        = 32
+)
+
 var Envs = initConfig()
 
+func (c Config) DevMode() bool {
+	return c.Env == "development"
+}
+
+// Validate reports invalid settings, and settings that are unsafe to run
+// with outside dev mode.
+func (c Config) Validate() error {
+	switch c.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !c.CookieSecure {
+			return errors.New("config: COOKIE_SAMESITE=none requires COOKIE_SECURE")
+		}
+	default:
+		return fmt.Errorf("config: COOKIE_SAMESITE must be lax, strict or none, got %q", c.CookieSameSite)
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			return errors.New("config: CORS_ALLOWED_ORIGINS must list origins explicitly, as credentials are allowed")
+		}
+	}
+
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("config: LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		return fmt.Errorf("config: LOG_FORMAT must be json or text, got %q", c.LogFormat)
+	}
+
+	switch c.TracingExporter {
+	case "", "otlp", "stdout":
+	default:
+		return fmt.Errorf("config: TRACING_EXPORTER must be otlp, stdout or empty, got %q", c.TracingExporter)
+	}
+
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		return fmt.Errorf("config: TRACING_SAMPLE_RATIO must be between 0 and 1, got %v", c.TracingSampleRatio)
+	}
+
+	if c.MaxBodyBytes < 1 {
+		return fmt.Errorf("config: MAX_BODY_BYTES must be positive, got %d", c.MaxBodyBytes)
+	}
+
+	if c.DevMode() {
+		return nil
+	}
+
+	if len(c.JWTKeys) == 0 {
+		if c.JWTSecret == defaultJWTSecret {
+			return errors.New("config: JWT_SECRET is set to the default value, set a random secret or configure JWT_KEYS")
+		}
+		if len(c.JWTSecret) < minJWTSecretLen {
+			return fmt.Errorf("config: JWT_SECRET must be at least %d characters long", minJWTSecretLen)
+		}
+	}
+
+	if c.ShareLinkSecret == defaultShareLinkSecret {
+		return errors.New("config: SHARE_LINK_SECRET is set to the default value, set a random secret")
+	}
+	if len(c.ShareLinkSecret) < minJWTSecretLen {
+		return fmt.Errorf("config: SHARE_LINK_SECRET must be at least %d characters long", minJWTSecretLen)
+	}
+
+	if c.JWTKeyOverlap < c.JWTTTL {
+		return errors.New("config: JWT_KEY_OVERLAP must not be shorter than JWT_TTL, or rotated keys invalidate live tokens")
+	}
+
+	return nil
+}
+
 func initConfig() Config {
-	return Config{
+	cfg := Config{
+		Env:        getEnv("APP_ENV", "production"),
 		Port:       getEnv("PORT", "8080"),
 		DBUser:     getEnv("DB_USER", "root"),
 		DBPassword: getEnv("DB_PASSWORD", "mysqldatabase123"),
 		DBAddress:  fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
-		DBName: getEnv("DB_NAME", "goprojectmanager"),
-		JWTSecret: getEnv("JWT_SECRET", "randomjwtsecret"),
+		DBName:     getEnv("DB_NAME", "goprojectmanager"),
+		JWTSecret:  getEnv("JWT_SECRET", defaultJWTSecret),
+		JWTKeys:    getEnvList("JWT_KEYS"),
+		JWTTTL:     getEnvDuration("JWT_TTL", 24*time.Hour),
+
+		AppURL:                   getEnv("APP_URL", "http://localhost:3000"),
+		MailFrom:                 getEnv("MAIL_FROM", "no-reply@localhost"),
+		SMTPHost:                 getEnv("SMTP_HOST", ""),
+		SMTPPort:                 getEnv("SMTP_PORT", "587"),
+		SMTPUser:                 getEnv("SMTP_USER", ""),
+		SMTPPassword:             getEnv("SMTP_PASSWORD", ""),
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", false),
+		PasswordResetTTL:         getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL:     getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		OrgInvitationTTL:         getEnvDuration("ORG_INVITATION_TTL", 7*24*time.Hour),
+		ProjectInvitationTTL:     getEnvDuration("PROJECT_INVITATION_TTL", 7*24*time.Hour),
+		TOTPIssuer:               getEnv("TOTP_ISSUER", "Go Rest Project Manager"),
+
+		LoginMaxAttempts:     getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		LoginIPMaxAttempts:   getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 20),
+		LoginLockoutDuration: getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		TrustProxyHeaders:    getEnvBool("TRUST_PROXY_HEADERS", false),
+		TrustedProxyHops:     getEnvInt("TRUSTED_PROXY_HOPS", 1),
+		AdminEmails:          getEnvList("ADMIN_EMAILS"),
+		ImpersonationTTL:     getEnvDuration("IMPERSONATION_TTL", time.Hour),
+		RateLimitDefault:     getEnv("RATE_LIMIT_DEFAULT", "300/m"),
+		RateLimitRoutes:      getEnvList("RATE_LIMIT_ROUTES"),
+		LogLevel:             strings.ToLower(getEnv("LOG_LEVEL", "info")),
+		LogFormat:            strings.ToLower(getEnv("LOG_FORMAT", "json")),
 	}
+
+	cfg.MetricsToken = getEnv("METRICS_TOKEN", "")
+	cfg.TracingExporter = strings.ToLower(getEnv("TRACING_EXPORTER", ""))
+	cfg.TracingSampleRatio = getEnvFloat("TRACING_SAMPLE_RATIO", 1)
+	cfg.ServiceName = getEnv("OTEL_SERVICE_NAME", "go-rest-project-manager")
+	cfg.DBConnectTimeout = getEnvDuration("DB_CONNECT_TIMEOUT", time.Minute)
+	cfg.PprofEnabled = getEnvBool("PPROF_ENABLED", false)
+	cfg.MaxBodyBytes = int64(getEnvInt("MAX_BODY_BYTES", 1<<20))
+	cfg.IfMatchRequired = getEnvBool("IF_MATCH_REQUIRED", false)
+	cfg.LogPIIFields = getEnvList("LOG_PII_FIELDS")
+	if cfg.LogPIIFields == nil {
+		cfg.LogPIIFields = []string{"email", "ip"}
+	}
+
+	cfg.JWTKeyOverlap = getEnvDuration("JWT_KEY_OVERLAP", cfg.JWTTTL)
+	cfg.ShareLinkSecret = getEnv("SHARE_LINK_SECRET", defaultShareLinkSecret)
+
+	cfg.CookieSecure = getEnvBool("COOKIE_SECURE", strings.HasPrefix(cfg.AppURL, "https://"))
+	cfg.CookieDomain = getEnv("COOKIE_DOMAIN", "")
+	cfg.CookieSameSite = strings.ToLower(getEnv("COOKIE_SAMESITE", "lax"))
+	cfg.CORSAllowedOrigins = getEnvList("CORS_ALLOWED_ORIGINS")
+
+	cfg.OIDCIssuer = getEnv("OIDC_ISSUER", "")
+	cfg.OIDCClientID = getEnv("OIDC_CLIENT_ID", "")
+	cfg.OIDCClientSecret = getEnv("OIDC_CLIENT_SECRET", "")
+	cfg.OIDCRedirectURL = getEnv("OIDC_REDIRECT_URL", cfg.AppURL+"/api/v1/auth/oidc/callback")
+	cfg.OIDCScopes = strings.Fields(getEnv("OIDC_SCOPES", "openid email profile"))
+
+	return cfg
 }
 
 func getEnv(key, fallback string) string {
@@ -33,4 +278,60 @@ func getEnv(key, fallback string) string {
 	}
 
 	return fallback
-}
\ No newline at end of file
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err == nil {
+			return b
+		}
+	}
+
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		i, err := strconv.Atoi(value)
+		if err == nil {
+			return i
+		}
+	}
+
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return f
+		}
+	}
+
+	return fallback
+}
+
+// getEnvList splits a comma separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		d, err := time.ParseDuration(value)
+		if err == nil {
+			return d
+		}
+	}
+
+	return fallback
+}
@@ -1,30 +1,99 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
+// Backoff between attempts to reach the database at startup.
+const (
+	connectBackoff    = 500 * time.Millisecond
+	maxConnectBackoff = 15 * time.Second
+)
+
 type MySQLStorage struct {
 	db *sql.DB
+	// migrated is set once Init has brought the schema up to date, and
+	// columns then lists the columns it added to existing tables.
+	migrated atomic.Bool
+	columns  []column
 }
 
-func NewMysqlStorage(cfg mysql.Config) *MySQLStorage {
+type column struct {
+	table, name string
+}
+
+// NewMysqlStorage connects to the database. The database may come up after
+// the API, as it does with docker-compose, so it is retried with exponential
+// backoff until ctx is done.
+func NewMysqlStorage(ctx context.Context, cfg mysql.Config) (*MySQLStorage, error) {
 	db, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	backoff := connectBackoff
+	for {
+		err = db.PingContext(ctx)
+		if err == nil {
+			break
+		}
+
+		slog.Warn("NewMysqlStorage: database is not reachable, retrying", "error", err, "retry_in", backoff.String())
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("db: giving up connecting to the database: %w", err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+
+	slog.Info("Connected to mysql database")
+	return &MySQLStorage{db: db}, nil
+}
+
+// Ping checks that the database is reachable.
+func (s *MySQLStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// CheckMigrations reports whether the schema is up to date: Init has run,
+// and the columns it added are still there, so that a database restored
+// from an older backup, or replaced, is noticed.
+func (s *MySQLStorage) CheckMigrations(ctx context.Context) error {
+	if !s.migrated.Load() {
+		return errors.New("db: migrations have not been applied")
+	}
+
+	pairs := make([]string, len(s.columns))
+	args := make([]any, 0, 2*len(s.columns))
+	for i, c := range s.columns {
+		pairs[i] = "(?, ?)"
+		args = append(args, c.table, c.name)
 	}
 
-	err = db.Ping()
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND (TABLE_NAME, COLUMN_NAME) IN ("+strings.Join(pairs, ", ")+")",
+		args...,
+	).Scan(&count)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	fmt.Println("Connected to mysql database...")
-	return &MySQLStorage{db: db}
+	if count != len(s.columns) {
+		return fmt.Errorf("db: %d of %d migrated columns are missing", len(s.columns)-count, len(s.columns))
+	}
+	return nil
 }
 
 func (s *MySQLStorage) Init() (*sql.DB, error) {
@@ -38,6 +107,100 @@ func (s *MySQLStorage) Init() (*sql.DB, error) {
 	if err := s.createTasksTable(); err != nil {
 		return nil, err
 	}
+	if err := s.createUserTokensTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createUserTOTPTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createUserRecoveryCodesTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createLoginThrottlesTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createAccessTokensTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createUserIdentitiesTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createSessionsTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createUserAvatarsTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createAuditEventsTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createOrganizationsTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createOrgMembersTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createOrgInvitationsTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createTeamsTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createTeamMembersTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createProjectGrantsTables(); err != nil {
+		return nil, err
+	}
+	if err := s.createProjectInvitationsTable(); err != nil {
+		return nil, err
+	}
+	if err := s.createShareLinksTable(); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "verified", "BOOLEAN NOT NULL DEFAULT FALSE AFTER password"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "pendingEmail", "VARCHAR(255) NULL DEFAULT NULL AFTER verified"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "timezone", "VARCHAR(64) NOT NULL DEFAULT 'UTC' AFTER pendingEmail"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "locale", "VARCHAR(35) NOT NULL DEFAULT 'en' AFTER timezone"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "avatarUpdatedAt", "TIMESTAMP NULL DEFAULT NULL AFTER locale"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "deletedAt", "TIMESTAMP NULL DEFAULT NULL AFTER avatarUpdatedAt"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "role", "VARCHAR(20) NOT NULL DEFAULT 'user' AFTER deletedAt"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "deactivatedAt", "TIMESTAMP NULL DEFAULT NULL AFTER role"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("users", "passwordResetRequired", "BOOLEAN NOT NULL DEFAULT FALSE AFTER deactivatedAt"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("sessions", "impersonatorId", "INT UNSIGNED NULL DEFAULT NULL AFTER revokedAt"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("projects", "orgId", "INT UNSIGNED NULL DEFAULT NULL AFTER name, ADD KEY (orgId)"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("projects", "version", "INT UNSIGNED NOT NULL DEFAULT 1 AFTER orgId"); err != nil {
+		return nil, err
+	}
+	if err := s.addColumnIfMissing("tasks", "version", "INT UNSIGNED NOT NULL DEFAULT 1 AFTER assignedToID"); err != nil {
+		return nil, err
+	}
+	if err := s.migrateDefaultOrganization(); err != nil {
+		return nil, err
+	}
+	s.migrated.Store(true)
 	return s.db, nil
 }
 
@@ -49,6 +212,15 @@ func (s *MySQLStorage) createUsersTable() error {
 				firstName VARCHAR(255) NOT NULL,
 				lastName VARCHAR(255) NOT NULL,
 				password VARCHAR(255) NOT NULL,
+				verified BOOLEAN NOT NULL DEFAULT FALSE,
+				pendingEmail VARCHAR(255) NULL DEFAULT NULL,
+				timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+				locale VARCHAR(35) NOT NULL DEFAULT 'en',
+				avatarUpdatedAt TIMESTAMP NULL DEFAULT NULL,
+				deletedAt TIMESTAMP NULL DEFAULT NULL,
+				role VARCHAR(20) NOT NULL DEFAULT 'user',
+				deactivatedAt TIMESTAMP NULL DEFAULT NULL,
+				passwordResetRequired BOOLEAN NOT NULL DEFAULT FALSE,
 				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 
 				PRIMARY KEY (id),
@@ -64,12 +236,15 @@ func (s *MySQLStorage) createProjectsTable() error {
 			CREATE TABLE IF NOT EXISTS projects (
 				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
 				name VARCHAR(255) NOT NULL,
+				orgId INT UNSIGNED NULL DEFAULT NULL,
+				version INT UNSIGNED NOT NULL DEFAULT 1,
 				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 
-				PRIMARY KEY (id)
+				PRIMARY KEY (id),
+				KEY (orgId)
 			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 	`)
-	
+
 	return err
 }
 
@@ -81,6 +256,7 @@ func (s *MySQLStorage) createTasksTable() error {
 				status ENUM('TODO', 'IN_PROGRESS', 'IN_TESTING', 'DONE') NOT NULL DEFAULT 'TODO',
 				projectId INT UNSIGNED NOT NULL,
 				AssignedToID INT UNSIGNED NOT NULL,
+				version INT UNSIGNED NOT NULL DEFAULT 1,
 				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 
 				PRIMARY KEY (id),
@@ -94,3 +270,420 @@ func (s *MySQLStorage) createTasksTable() error {
 
 	return nil
 }
+
+func (s *MySQLStorage) createUserTokensTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS user_tokens (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				userId INT UNSIGNED NOT NULL,
+				purpose VARCHAR(32) NOT NULL,
+				tokenHash CHAR(64) NOT NULL,
+				expiresAt TIMESTAMP NOT NULL,
+				usedAt TIMESTAMP NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (tokenHash),
+				KEY (userId, purpose),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createUserTOTPTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS user_totp (
+				userId INT UNSIGNED NOT NULL,
+				secret VARCHAR(64) NOT NULL,
+				enabled BOOLEAN NOT NULL DEFAULT FALSE,
+				lastUsedStep BIGINT NOT NULL DEFAULT 0,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (userId),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createUserRecoveryCodesTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS user_recovery_codes (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				userId INT UNSIGNED NOT NULL,
+				codeHash CHAR(64) NOT NULL,
+				usedAt TIMESTAMP NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				KEY (userId, codeHash),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createLoginThrottlesTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS login_throttles (
+				scope VARCHAR(16) NOT NULL,
+				throttleKey VARCHAR(255) NOT NULL,
+				failures INT UNSIGNED NOT NULL DEFAULT 0,
+				lastFailureAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				lockedUntil TIMESTAMP NULL DEFAULT NULL,
+
+				PRIMARY KEY (scope, throttleKey),
+				KEY (lockedUntil)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createAccessTokensTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS access_tokens (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				userId INT UNSIGNED NOT NULL,
+				name VARCHAR(100) NOT NULL,
+				scopes VARCHAR(255) NOT NULL,
+				tokenHash CHAR(64) NOT NULL,
+				expiresAt TIMESTAMP NOT NULL,
+				lastUsedAt TIMESTAMP NULL DEFAULT NULL,
+				revokedAt TIMESTAMP NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (tokenHash),
+				KEY (userId),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createUserIdentitiesTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS user_identities (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				userId INT UNSIGNED NOT NULL,
+				issuer VARCHAR(255) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				email VARCHAR(255) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (issuer, subject),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createSessionsTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS sessions (
+				id VARCHAR(64) NOT NULL,
+				userId INT UNSIGNED NOT NULL,
+				device VARCHAR(100) NOT NULL,
+				ip VARCHAR(45) NOT NULL,
+				userAgent VARCHAR(512) NOT NULL,
+				expiresAt TIMESTAMP NOT NULL,
+				lastSeenAt TIMESTAMP NOT NULL,
+				revokedAt TIMESTAMP NULL DEFAULT NULL,
+				impersonatorId INT UNSIGNED NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				KEY (userId),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createUserAvatarsTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS user_avatars (
+				userId INT UNSIGNED NOT NULL,
+				contentType VARCHAR(50) NOT NULL,
+				data MEDIUMBLOB NOT NULL,
+				updatedAt TIMESTAMP NOT NULL,
+
+				PRIMARY KEY (userId),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+// createAuditEventsTable creates the audit log of administrative actions.
+// It has no foreign keys so that events outlive the users they mention.
+func (s *MySQLStorage) createAuditEventsTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS audit_events (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				actorId INT UNSIGNED NULL DEFAULT NULL,
+				action VARCHAR(50) NOT NULL,
+				targetUserId INT UNSIGNED NOT NULL,
+				detail VARCHAR(255) NOT NULL,
+				ip VARCHAR(45) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				KEY (targetUserId)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createOrganizationsTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS organizations (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				name VARCHAR(255) NOT NULL,
+				slug VARCHAR(50) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (slug)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createOrgMembersTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS org_members (
+				orgId INT UNSIGNED NOT NULL,
+				userId INT UNSIGNED NOT NULL,
+				role VARCHAR(20) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (orgId, userId),
+				KEY (userId),
+				FOREIGN KEY (orgId) REFERENCES organizations(id) ON DELETE CASCADE,
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createOrgInvitationsTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS org_invitations (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				orgId INT UNSIGNED NOT NULL,
+				email VARCHAR(255) NOT NULL,
+				role VARCHAR(20) NOT NULL,
+				tokenHash CHAR(64) NOT NULL,
+				invitedById INT UNSIGNED NOT NULL,
+				expiresAt TIMESTAMP NOT NULL,
+				acceptedAt TIMESTAMP NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (tokenHash),
+				FOREIGN KEY (orgId) REFERENCES organizations(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createTeamsTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS teams (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				orgId INT UNSIGNED NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (orgId, name),
+				FOREIGN KEY (orgId) REFERENCES organizations(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createTeamMembersTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS team_members (
+				teamId INT UNSIGNED NOT NULL,
+				userId INT UNSIGNED NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (teamId, userId),
+				KEY (userId),
+				FOREIGN KEY (teamId) REFERENCES teams(id) ON DELETE CASCADE,
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+// createProjectGrantsTables creates the tables granting users and teams roles
+// on projects. Grants are removed with the project, user or team they name.
+func (s *MySQLStorage) createProjectGrantsTables() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS project_user_grants (
+				projectId INT UNSIGNED NOT NULL,
+				userId INT UNSIGNED NOT NULL,
+				role VARCHAR(20) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (projectId, userId),
+				KEY (userId),
+				FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE,
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS project_team_grants (
+				projectId INT UNSIGNED NOT NULL,
+				teamId INT UNSIGNED NOT NULL,
+				role VARCHAR(20) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (projectId, teamId),
+				KEY (teamId),
+				FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE,
+				FOREIGN KEY (teamId) REFERENCES teams(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createProjectInvitationsTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS project_invitations (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				projectId INT UNSIGNED NOT NULL,
+				email VARCHAR(255) NOT NULL,
+				role VARCHAR(20) NOT NULL,
+				tokenHash CHAR(64) NOT NULL,
+				invitedById INT UNSIGNED NOT NULL,
+				expiresAt TIMESTAMP NOT NULL,
+				acceptedAt TIMESTAMP NULL DEFAULT NULL,
+				declinedAt TIMESTAMP NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (tokenHash),
+				FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+func (s *MySQLStorage) createShareLinksTable() error {
+	_, err := s.db.Exec(`
+			CREATE TABLE IF NOT EXISTS project_share_links (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				projectId INT UNSIGNED NOT NULL,
+				tokenHash CHAR(64) NOT NULL,
+				passwordHash VARCHAR(255) NOT NULL DEFAULT '',
+				createdById INT UNSIGNED NOT NULL,
+				expiresAt TIMESTAMP NULL DEFAULT NULL,
+				revokedAt TIMESTAMP NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				KEY (projectId),
+				FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+
+	return err
+}
+
+// migrateDefaultOrganization moves data created before organizations existed
+// into a "default" organization. Every project is assigned to it and every
+// user joins it, administrators as owners. It runs once: as soon as any
+// organization exists it does nothing.
+func (s *MySQLStorage) migrateDefaultOrganization() error {
+	var orgs, users, projects int
+	err := s.db.QueryRow("SELECT (SELECT COUNT(*) FROM organizations), (SELECT COUNT(*) FROM users), (SELECT COUNT(*) FROM projects)").Scan(&orgs, &users, &projects)
+	if err != nil {
+		return err
+	}
+
+	if orgs > 0 || (users == 0 && projects == 0) {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO organizations (name, slug) VALUES ('Default', 'default')")
+	if err != nil {
+		return err
+	}
+
+	orgID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE projects SET orgId = ? WHERE orgId IS NULL", orgID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO org_members (orgId, userId, role) SELECT ?, id, IF(role = 'admin', 'owner', 'member') FROM users WHERE deletedAt IS NULL",
+		orgID,
+	)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Moved projects and users into the default organization", "projects", projects, "users", users)
+	return tx.Commit()
+}
+
+// addColumnIfMissing adds a column to a table created by an earlier version
+// of the schema. CREATE TABLE IF NOT EXISTS leaves existing tables untouched,
+// so new columns on old tables have to be added explicitly. CheckMigrations
+// checks later that the column is still there.
+func (s *MySQLStorage) addColumnIfMissing(table, name, definition string) error {
+	s.columns = append(s.columns, column{table, name})
+
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, name,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, name, definition))
+	return err
+}
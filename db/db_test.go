@@ -0,0 +1,82 @@
+package db
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ddlPattern = regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\w+)|REFERENCES (\w+)\(`)
+
+// TestInitCreatesEveryTable reads db.go rather than a database, so that a
+// create*Table method Init forgets to call, or calls before a table it has
+// a foreign key to, fails here instead of at startup.
+func TestInitCreatesEveryTable(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "db.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := map[string]*ast.FuncDecl{}
+	var init *ast.FuncDecl
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		switch {
+		case fn.Name.Name == "Init":
+			init = fn
+		case strings.HasPrefix(fn.Name.Name, "create"):
+			methods[fn.Name.Name] = fn
+		}
+	}
+	if init == nil {
+		t.Fatal("Init not found")
+	}
+
+	created := map[string]bool{}
+	ast.Inspect(init.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		fn, ok := methods[sel.Sel.Name]
+		if !ok {
+			return true
+		}
+		delete(methods, sel.Sel.Name)
+
+		for _, m := range ddlPattern.FindAllStringSubmatch(literals(fn), -1) {
+			if m[1] != "" {
+				created[m[1]] = true
+			} else if !created[m[2]] {
+				t.Errorf("%s references %s before it is created", fn.Name.Name, m[2])
+			}
+		}
+		return true
+	})
+
+	for name := range methods {
+		t.Errorf("%s is never called from Init", name)
+	}
+}
+
+// literals joins the string literals in fn's body, in source order.
+func literals(fn *ast.FuncDecl) string {
+	var b strings.Builder
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			b.WriteString(lit.Value)
+		}
+		return true
+	})
+	return b.String()
+}
@@ -0,0 +1,276 @@
+// Package keyring holds the keys the API signs and verifies its JWTs with.
+//
+// Keys are identified by kid and scheduled by activation time. The newest
+// active key signs new tokens; a key that has been superseded keeps
+// verifying tokens for an overlap window, after which it is retired. Keys
+// scheduled for the future are already published in the JWKS, so services
+// verifying our tokens can pick them up before they are used.
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/jwk"
+	"github.com/golang-jwt/jwt"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys.
+const minRSABits = 2048
+
+// clockSkew lets other instances verify tokens from a key that has just
+// become active even if their clock runs slightly behind.
+const clockSkew = time.Minute
+
+var ErrUnknownKey = errors.New("keyring: unknown or retired key")
+
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   any
+	Public    any
+	NotBefore time.Time
+}
+
+type Keyring struct {
+	keys    []Key
+	overlap time.Duration
+	now     func() time.Time
+}
+
+// New returns a keyring for keys. overlap is how long a superseded key keeps
+// verifying tokens, and should be at least the lifetime of a token.
+func New(overlap time.Duration, keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring: no keys")
+	}
+
+	sorted := append([]Key(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].NotBefore.Before(sorted[j].NotBefore) })
+
+	seen := map[string]bool{}
+	for i, k := range sorted {
+		if seen[k.ID] {
+			return nil, fmt.Errorf("keyring: duplicate key id %q", k.ID)
+		}
+		seen[k.ID] = true
+
+		if i > 0 && k.NotBefore.Equal(sorted[i-1].NotBefore) {
+			return nil, fmt.Errorf("keyring: keys %q and %q have the same activation time", sorted[i-1].ID, k.ID)
+		}
+	}
+
+	return &Keyring{keys: sorted, overlap: overlap, now: time.Now}, nil
+}
+
+// NewHMAC returns a keyring with a single HS256 key, the legacy setup where
+// tokens are signed with JWT_SECRET.
+func NewHMAC(secret []byte) *Keyring {
+	return &Keyring{
+		keys: []Key{{Method: jwt.SigningMethodHS256, Private: secret, Public: secret}},
+		now:  time.Now,
+	}
+}
+
+// Load builds the keyring described by cfg. Without JWT_KEYS the legacy
+// HS256 secret is used.
+func Load(cfg config.Config) (*Keyring, error) {
+	if len(cfg.JWTKeys) == 0 {
+		return NewHMAC([]byte(cfg.JWTSecret)), nil
+	}
+
+	keys := make([]Key, 0, len(cfg.JWTKeys))
+	for _, spec := range cfg.JWTKeys {
+		key, err := loadKeySpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return New(cfg.JWTKeyOverlap, keys...)
+}
+
+// loadKeySpec loads a key described as "kid=path/to/key.pem", optionally
+// followed by "@" and an RFC 3339 activation time.
+func loadKeySpec(spec string) (Key, error) {
+	kid, path, ok := strings.Cut(spec, "=")
+	if !ok || kid == "" || path == "" {
+		return Key{}, fmt.Errorf("keyring: invalid key %q, expected kid=path[@activation]", spec)
+	}
+
+	var notBefore time.Time
+	if at := strings.LastIndex(path, "@"); at >= 0 {
+		t, err := time.Parse(time.RFC3339, path[at+1:])
+		if err != nil {
+			return Key{}, fmt.Errorf("keyring: invalid activation time for key %q: %v", kid, err)
+		}
+		notBefore, path = t, path[:at]
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("keyring: reading key %q: %w", kid, err)
+	}
+
+	key, err := ParsePrivateKey(kid, data)
+	if err != nil {
+		return Key{}, err
+	}
+	key.NotBefore = notBefore
+
+	return key, nil
+}
+
+// ParsePrivateKey parses a PEM encoded RSA (PKCS #1 or PKCS #8) or Ed25519
+// (PKCS #8) private key. RSA keys sign with RS256 and Ed25519 keys with EdDSA.
+func ParsePrivateKey(kid string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("keyring: key %q is not PEM encoded", kid)
+	}
+
+	var private any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("keyring: key %q: %v", kid, err)
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if bits := private.N.BitLen(); bits < minRSABits {
+			return Key{}, fmt.Errorf("keyring: key %q is a %d bit RSA key, at least %d bits are required", kid, bits, minRSABits)
+		}
+		return Key{ID: kid, Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return Key{ID: kid, Method: jwt.SigningMethodEdDSA, Private: private, Public: private.Public()}, nil
+	default:
+		return Key{}, fmt.Errorf("keyring: key %q has unsupported type %T", kid, private)
+	}
+}
+
+// Sign signs claims with the current signing key.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key, err := k.signingKey(k.now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+
+	return token.SignedString(key.Private)
+}
+
+// Parse verifies a token signed by one of the keyring's keys. Tokens must
+// carry an expiry, and the algorithm must be the one the key signs with.
+func (k *Keyring) Parse(tokenStr string) (*jwt.Token, error) {
+	now := k.now()
+
+	// claims are checked below against the keyring's clock
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := k.verificationKey(kid, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+
+		return key.Public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !claims.VerifyExpiresAt(now.Unix(), true) {
+		return nil, errors.New("token is expired or has no expiry")
+	}
+	if !claims.VerifyNotBefore(now.Unix(), false) {
+		return nil, errors.New("token is not valid yet")
+	}
+
+	return token, nil
+}
+
+// JWKS returns the public keys of every asymmetric key that is active,
+// scheduled or still within its overlap window.
+func (k *Keyring) JWKS() (jwk.Set, error) {
+	now := k.now()
+	set := jwk.Set{Keys: []jwk.Key{}}
+
+	for i, key := range k.keys {
+		if _, ok := key.Public.([]byte); ok || k.retired(i, now) {
+			continue
+		}
+
+		pub, err := jwk.FromPublicKey(key.ID, key.Method.Alg(), key.Public)
+		if err != nil {
+			return jwk.Set{}, err
+		}
+		set.Keys = append(set.Keys, pub)
+	}
+
+	return set, nil
+}
+
+// signingKey returns the most recently activated key.
+func (k *Keyring) signingKey(now time.Time) (*Key, error) {
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if !k.keys[i].NotBefore.After(now) {
+			return &k.keys[i], nil
+		}
+	}
+
+	return nil, errors.New("keyring: no key is active yet")
+}
+
+func (k *Keyring) verificationKey(kid string, now time.Time) (*Key, error) {
+	for i := range k.keys {
+		key := &k.keys[i]
+		if key.ID != kid {
+			continue
+		}
+
+		if key.NotBefore.After(now.Add(clockSkew)) || k.retired(i, now) {
+			return nil, ErrUnknownKey
+		}
+
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// retired reports whether the key at index i was superseded more than the
+// overlap window ago.
+func (k *Keyring) retired(i int, now time.Time) bool {
+	if i+1 >= len(k.keys) {
+		return false
+	}
+
+	return !k.keys[i+1].NotBefore.Add(k.overlap).After(now)
+}
@@ -0,0 +1,212 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func rsaKey(t *testing.T, kid string, bits int) Key {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	key, err := ParsePrivateKey(kid, pemBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func edKey(t *testing.T, kid string) Key {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePrivateKey(kid, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func claims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{"userID": "1", "exp": now.Add(time.Hour).Unix()}
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, key := range []Key{rsaKey(t, "rsa", 2048), edKey(t, "ed")} {
+		t.Run("should round trip "+key.Method.Alg(), func(t *testing.T) {
+			k, err := New(time.Hour, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := k.Sign(claims(time.Now()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := k.Parse(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if token.Header["kid"] != key.ID {
+				t.Errorf("expected kid %q, got %v", key.ID, token.Header["kid"])
+			}
+		})
+	}
+
+	t.Run("should reject weak RSA keys", func(t *testing.T) {
+		private, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+		if _, err := ParsePrivateKey("weak", pemBytes); err == nil {
+			t.Error("expected 1024 bit key to be rejected")
+		}
+	})
+
+	t.Run("should reject tokens without expiry", func(t *testing.T) {
+		k, err := New(time.Hour, edKey(t, "ed"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := k.Sign(jwt.MapClaims{"userID": "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := k.Parse(raw); err == nil {
+			t.Error("expected token without exp to be rejected")
+		}
+	})
+
+	t.Run("should reject HMAC tokens keyed with the public key", func(t *testing.T) {
+		key := rsaKey(t, "rsa", 2048)
+		k, err := New(time.Hour, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pub, err := x509.MarshalPKIXPublicKey(key.Public)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(time.Now()))
+		token.Header["kid"] = "rsa"
+		raw, err := token.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := k.Parse(raw); err == nil {
+			t.Error("expected algorithm confusion to be rejected")
+		}
+	})
+}
+
+func TestRotation(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := edKey(t, "2026-01")
+	next := edKey(t, "2026-02")
+	next.NotBefore = start.Add(30 * 24 * time.Hour)
+
+	k, err := New(24*time.Hour, next, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(now time.Time) { k.now = func() time.Time { return now } }
+
+	at(start)
+	oldToken, err := k.Sign(claims(next.NotBefore.Add(48 * time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should publish the scheduled key before it signs", func(t *testing.T) {
+		at(start)
+
+		set, err := k.JWKS()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(set.Keys) != 2 {
+			t.Fatalf("expected 2 published keys, got %d", len(set.Keys))
+		}
+
+		raw, _ := k.Sign(claims(start))
+		token, err := k.Parse(raw)
+		if err != nil || token.Header["kid"] != current.ID {
+			t.Errorf("expected current key to sign, got %v (%v)", token, err)
+		}
+	})
+
+	t.Run("should sign with the next key once active", func(t *testing.T) {
+		at(next.NotBefore.Add(time.Hour))
+
+		raw, _ := k.Sign(claims(next.NotBefore))
+		token, err := k.Parse(raw)
+		if err != nil || token.Header["kid"] != next.ID {
+			t.Errorf("expected next key to sign, got %v (%v)", token, err)
+		}
+	})
+
+	t.Run("should verify the old key during the overlap window", func(t *testing.T) {
+		at(next.NotBefore.Add(23 * time.Hour))
+
+		if _, err := k.Parse(oldToken); err != nil {
+			t.Errorf("expected old token to verify, got %v", err)
+		}
+	})
+
+	t.Run("should retire the old key after the overlap window", func(t *testing.T) {
+		at(next.NotBefore.Add(25 * time.Hour))
+
+		if _, err := k.Parse(oldToken); err == nil {
+			t.Error("expected token from retired key to be rejected")
+		}
+
+		set, err := k.JWKS()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(set.Keys) != 1 || set.Keys[0].Kid != next.ID {
+			t.Errorf("expected only %q to be published, got %+v", next.ID, set.Keys)
+		}
+	})
+
+	t.Run("should reject duplicate activation times", func(t *testing.T) {
+		if _, err := New(time.Hour, edKey(t, "a"), edKey(t, "b")); err == nil {
+			t.Error("expected keys without distinct activation times to be rejected")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in the logs.
+const Redacted = "[REDACTED]"
+
+// Secret wraps a value, such as a password, a hash or a token, that must
+// never be logged. It prints as Redacted in log lines, with fmt and in JSON.
+type Secret string
+
+func (Secret) LogValue() slog.Value {
+	return slog.StringValue(Redacted)
+}
+
+func (Secret) String() string {
+	return Redacted
+}
+
+func (Secret) MarshalText() ([]byte, error) {
+	return []byte(Redacted), nil
+}
+
+// PII wraps personal data, such as an email address, that identifies a
+// person. It is logged as a fingerprint, so that the lines about one person
+// can still be told apart without revealing who they are.
+type PII string
+
+func (p PII) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(string(p)))
+}
+
+func (p PII) String() string {
+	return fingerprint(string(p))
+}
+
+func (p PII) MarshalText() ([]byte, error) {
+	return []byte(fingerprint(string(p))), nil
+}
+
+func fingerprint(s string) string {
+	if s == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(s)))
+	return "pii:" + hex.EncodeToString(sum[:4])
+}
+
+// secretKeys are attribute keys whose values are always redacted, whatever
+// their type. Keys containing "password" or "secret", and keys ending in
+// "token" or "hash", are redacted as well.
+var secretKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"set_cookie":    true,
+	"code":          true,
+	"recovery_code": true,
+	"api_key":       true,
+}
+
+// secretPatterns catch secrets that made it into messages and error texts:
+// bcrypt hashes, JWTs and personal access tokens.
+var secretPatterns = regexp.MustCompile(`\$2[aby]?\$\d\d\$[./A-Za-z0-9]{53}|eyJ[\w-]*\.[\w-]+\.[\w-]+|pmp_[\w-]+`)
+
+func secretKey(key string) bool {
+	key = strings.ToLower(key)
+	if secretKeys[key] {
+		return true
+	}
+	return strings.Contains(key, "password") || strings.Contains(key, "secret") ||
+		strings.HasSuffix(key, "token") || strings.HasSuffix(key, "hash")
+}
+
+// redactor returns the ReplaceAttr function of the handlers built by New. It
+// redacts secrets by key and by pattern, and logs the values of piiFields as
+// PII.
+func redactor(piiFields []string) func(groups []string, a slog.Attr) slog.Attr {
+	pii := map[string]bool{}
+	for _, field := range piiFields {
+		pii[strings.ToLower(field)] = true
+	}
+
+	return func(groups []string, a slog.Attr) slog.Attr {
+		switch {
+		case secretKey(a.Key):
+			return slog.String(a.Key, Redacted)
+		case pii[strings.ToLower(a.Key)]:
+			return slog.String(a.Key, fingerprint(a.Value.String()))
+		}
+
+		switch a.Value.Kind() {
+		case slog.KindString:
+			if s := a.Value.String(); secretPatterns.MatchString(s) {
+				return slog.String(a.Key, Scrub(s))
+			}
+		case slog.KindAny:
+			if err, ok := a.Value.Any().(error); ok && secretPatterns.MatchString(err.Error()) {
+				return slog.String(a.Key, Scrub(err.Error()))
+			}
+		}
+		return a
+	}
+}
+
+// Scrub replaces the hashes and tokens found in s.
+func Scrub(s string) string {
+	return secretPatterns.ReplaceAllString(s, Redacted)
+}
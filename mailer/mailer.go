@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails such as verification and password
+// reset links.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns an SMTP mailer when SMTP_HOST is configured and a LogMailer
+// otherwise, so local development works without a mail server.
+func New(cfg config.Config) Mailer {
+	if cfg.SMTPHost == "" {
+		return &LogMailer{LogBody: cfg.DevMode()}
+	}
+
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		Host:     cfg.SMTPHost,
+		Username: cfg.SMTPUser,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+	}
+}
+
+// LogMailer writes messages to the application log instead of sending them.
+// The bodies hold links with tokens, so they are only logged if LogBody is
+// set, which New does in dev mode.
+type LogMailer struct {
+	LogBody bool
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	attrs := []any{"to", logging.PII(msg.To), "subject", msg.Subject}
+	if m.LogBody {
+		attrs = append(attrs, "body", msg.Body)
+	}
+	slog.Info("LogMailer: message not sent", attrs...)
+	return nil
+}
+
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("mailer: invalid header value")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, []byte(b.String()))
+}
+
+// MockMailer records sent messages for testing purposes
+type MockMailer struct {
+	Sent []Message
+}
+
+func (m *MockMailer) Send(msg Message) error {
+	m.Sent = append(m.Sent, msg)
+	return nil
+}
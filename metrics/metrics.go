@@ -0,0 +1,160 @@
+// Package metrics exposes Prometheus metrics of the API: requests by route,
+// Store calls, the database connection pool and business totals.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/buildinfo"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "projectmanager"
+
+// statsTimeout bounds the queries run for every scrape.
+const statsTimeout = 5 * time.Second
+
+// Registry holds every metric of the API, along with the Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	storeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_query_duration_seconds",
+		Help:      "Latency of Store methods.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	buildInfo = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "build_info",
+		Help:        "Always 1, labelled with the version and commit of the running build.",
+		ConstLabels: buildLabels(),
+	}, func() float64 { return 1 })
+
+	storeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_query_errors_total",
+		Help:      "Store methods that failed, not counting rows that were not found.",
+	}, []string{"method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, storeDuration, storeErrors, buildInfo,
+	)
+}
+
+func buildLabels() prometheus.Labels {
+	info := buildinfo.Get()
+	return prometheus.Labels{"version": info.Version, "commit": info.Commit, "goversion": info.GoVersion}
+}
+
+// ObserveRequest records a served request. route is the template of the
+// matched route, or "" if no route matched.
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	labels := []string{method, route, strconv.Itoa(status)}
+	httpRequests.WithLabelValues(labels...).Inc()
+	httpDuration.WithLabelValues(labels...).Observe(duration.Seconds())
+}
+
+// RegisterDatabase adds the connection pool statistics of db and the
+// business totals read through store.
+func RegisterDatabase(db *sql.DB, dbName string, store repository.Store) {
+	Registry.MustRegister(
+		collectors.NewDBStatsCollector(db, dbName),
+		newStatsCollector(store),
+	)
+}
+
+// Handler serves the metrics. When token is set, scrapers must send it as a
+// bearer token.
+func Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return metrics
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			utils.WriteError(w, http.StatusUnauthorized, "permission denied")
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// statsCollector reads the business totals from the database on every
+// scrape, so they are never stale and cost nothing between scrapes.
+type statsCollector struct {
+	store         repository.Store
+	users         *prometheus.Desc
+	organizations *prometheus.Desc
+	projects      *prometheus.Desc
+	tasks         *prometheus.Desc
+}
+
+func newStatsCollector(store repository.Store) *statsCollector {
+	return &statsCollector{
+		store:         store,
+		users:         prometheus.NewDesc(namespace+"_users", "Users that have not deleted their account.", nil, nil),
+		organizations: prometheus.NewDesc(namespace+"_organizations", "Organizations.", nil, nil),
+		projects:      prometheus.NewDesc(namespace+"_projects", "Projects.", nil, nil),
+		tasks:         prometheus.NewDesc(namespace+"_tasks", "Tasks by status.", []string{"status"}, nil),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.users
+	ch <- c.organizations
+	ch <- c.projects
+	ch <- c.tasks
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	stats, err := c.store.GetStats(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("statsCollector: error loading stats", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.tasks, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.users, prometheus.GaugeValue, float64(stats.Users))
+	ch <- prometheus.MustNewConstMetric(c.organizations, prometheus.GaugeValue, float64(stats.Organizations))
+	ch <- prometheus.MustNewConstMetric(c.projects, prometheus.GaugeValue, float64(stats.Projects))
+	for status, count := range stats.TasksByStatus {
+		ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.GaugeValue, float64(count), status)
+	}
+}
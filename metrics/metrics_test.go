@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type statsStore struct {
+	repository.MockStore
+}
+
+func (s *statsStore) GetStats(ctx context.Context) (*model.Stats, error) {
+	return &model.Stats{Users: 3, Organizations: 2, Projects: 5, TasksByStatus: map[string]int64{model.TaskStatusTodo: 4, model.TaskStatusDone: 1}}, nil
+}
+
+func (s *statsStore) GetTask(ctx context.Context, orgID int64, id string) (*model.Task, error) {
+	if id == "missing" {
+		return nil, sql.ErrNoRows
+	}
+	return nil, errors.New("connection refused")
+}
+
+func TestInstrumentStore(t *testing.T) {
+	store := InstrumentStore(&statsStore{})
+
+	store.GetTask(context.Background(), 1, "missing")
+	store.GetTask(context.Background(), 1, "1")
+	if _, err := store.CreateProject(context.Background(), 1, &model.Project{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.ToFloat64(storeErrors.WithLabelValues("GetTask")); n != 1 {
+		t.Errorf("expected 1 error, got %v", n)
+	}
+	if n := testutil.ToFloat64(storeErrors.WithLabelValues("CreateProject")); n != 0 {
+		t.Errorf("expected no errors, got %v", n)
+	}
+	if n := testutil.CollectAndCount(storeDuration, namespace+"_store_query_duration_seconds"); n != 2 {
+		t.Errorf("expected latencies of 2 methods, got %d", n)
+	}
+}
+
+func TestObserveRequest(t *testing.T) {
+	ObserveRequest(http.MethodGet, "/api/v1/projects/{id}", http.StatusOK, 0)
+	ObserveRequest(http.MethodGet, "/api/v1/projects/{id}", http.StatusOK, 0)
+	ObserveRequest(http.MethodGet, "", http.StatusNotFound, 0)
+
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/v1/projects/{id}", "200")); n != 2 {
+		t.Errorf("expected 2 requests, got %v", n)
+	}
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "unmatched", "404")); n != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", n)
+	}
+}
+
+func TestStatsCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newStatsCollector(&statsStore{}))
+
+	expected := `
+# HELP projectmanager_tasks Tasks by status.
+# TYPE projectmanager_tasks gauge
+projectmanager_tasks{status="DONE"} 1
+projectmanager_tasks{status="TODO"} 4
+# HELP projectmanager_projects Projects.
+# TYPE projectmanager_projects gauge
+projectmanager_projects 5
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), namespace+"_tasks", namespace+"_projects"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler("scrape-token")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "go_goroutines") {
+		t.Error("expected the Go runtime metrics")
+	}
+}
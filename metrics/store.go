@@ -0,0 +1,421 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// InstrumentStore wraps store so that the latency and errors of every Store
+// method are recorded. sql.ErrNoRows means "not found" and is not counted as
+// an error.
+func InstrumentStore(store repository.Store) repository.Store {
+	return &instrumentedStore{next: store}
+}
+
+type instrumentedStore struct {
+	next repository.Store
+}
+
+func observe(method string, call func() error) error {
+	start := time.Now()
+	err := call()
+	storeDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil && err != sql.ErrNoRows {
+		storeErrors.WithLabelValues(method).Inc()
+	}
+	return err
+}
+
+func observeResult[T any](method string, call func() (T, error)) (T, error) {
+	var result T
+	err := observe(method, func() error {
+		var err error
+		result, err = call()
+		return err
+	})
+	return result, err
+}
+
+func (s *instrumentedStore) CreateUser(ctx context.Context, u *model.User) (*model.User, error) {
+	return observeResult("CreateUser", func() (*model.User, error) { return s.next.CreateUser(ctx, u) })
+}
+
+func (s *instrumentedStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	return observeResult("GetUserByID", func() (*model.User, error) { return s.next.GetUserByID(ctx, id) })
+}
+
+func (s *instrumentedStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return observeResult("GetUserByEmail", func() (*model.User, error) { return s.next.GetUserByEmail(ctx, email) })
+}
+
+func (s *instrumentedStore) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error {
+	return observe("UpdateUserPassword", func() error { return s.next.UpdateUserPassword(ctx, userID, passwordHash) })
+}
+
+func (s *instrumentedStore) SetUserVerified(ctx context.Context, userID int64) error {
+	return observe("SetUserVerified", func() error { return s.next.SetUserVerified(ctx, userID) })
+}
+
+func (s *instrumentedStore) UpdateUserProfile(ctx context.Context, u *model.User) error {
+	return observe("UpdateUserProfile", func() error { return s.next.UpdateUserProfile(ctx, u) })
+}
+
+func (s *instrumentedStore) SetPendingEmail(ctx context.Context, userID int64, email string) error {
+	return observe("SetPendingEmail", func() error { return s.next.SetPendingEmail(ctx, userID, email) })
+}
+
+func (s *instrumentedStore) ConfirmEmailChange(ctx context.Context, userID int64) error {
+	return observe("ConfirmEmailChange", func() error { return s.next.ConfirmEmailChange(ctx, userID) })
+}
+
+func (s *instrumentedStore) DeleteUser(ctx context.Context, userID int64) error {
+	return observe("DeleteUser", func() error { return s.next.DeleteUser(ctx, userID) })
+}
+
+func (s *instrumentedStore) ListUsers(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	return observeResult("ListUsers", func() ([]model.User, error) { return s.next.ListUsers(ctx, filter) })
+}
+
+func (s *instrumentedStore) SetUserRole(ctx context.Context, userID int64, role string) error {
+	return observe("SetUserRole", func() error { return s.next.SetUserRole(ctx, userID, role) })
+}
+
+func (s *instrumentedStore) SetUserDeactivated(ctx context.Context, userID int64, deactivatedAt *time.Time) error {
+	return observe("SetUserDeactivated", func() error { return s.next.SetUserDeactivated(ctx, userID, deactivatedAt) })
+}
+
+func (s *instrumentedStore) SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error {
+	return observe("SetPasswordResetRequired", func() error { return s.next.SetPasswordResetRequired(ctx, userID, required) })
+}
+
+func (s *instrumentedStore) CreateAuditEvent(ctx context.Context, e *model.AuditEvent) (*model.AuditEvent, error) {
+	return observeResult("CreateAuditEvent", func() (*model.AuditEvent, error) { return s.next.CreateAuditEvent(ctx, e) })
+}
+
+func (s *instrumentedStore) ListAuditEvents(ctx context.Context, targetUserID int64, limit int) ([]model.AuditEvent, error) {
+	return observeResult("ListAuditEvents", func() ([]model.AuditEvent, error) { return s.next.ListAuditEvents(ctx, targetUserID, limit) })
+}
+
+func (s *instrumentedStore) SaveUserAvatar(ctx context.Context, a *model.UserAvatar) error {
+	return observe("SaveUserAvatar", func() error { return s.next.SaveUserAvatar(ctx, a) })
+}
+
+func (s *instrumentedStore) GetUserAvatar(ctx context.Context, userID int64) (*model.UserAvatar, error) {
+	return observeResult("GetUserAvatar", func() (*model.UserAvatar, error) { return s.next.GetUserAvatar(ctx, userID) })
+}
+
+func (s *instrumentedStore) DeleteUserAvatar(ctx context.Context, userID int64) error {
+	return observe("DeleteUserAvatar", func() error { return s.next.DeleteUserAvatar(ctx, userID) })
+}
+
+func (s *instrumentedStore) CreateUserToken(ctx context.Context, t *model.UserToken) (*model.UserToken, error) {
+	return observeResult("CreateUserToken", func() (*model.UserToken, error) { return s.next.CreateUserToken(ctx, t) })
+}
+
+func (s *instrumentedStore) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	return observeResult("ConsumeUserToken", func() (*model.UserToken, error) { return s.next.ConsumeUserToken(ctx, purpose, tokenHash) })
+}
+
+func (s *instrumentedStore) GetUserTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error) {
+	return observeResult("GetUserTOTP", func() (*model.UserTOTP, error) { return s.next.GetUserTOTP(ctx, userID) })
+}
+
+func (s *instrumentedStore) SaveUserTOTP(ctx context.Context, t *model.UserTOTP) error {
+	return observe("SaveUserTOTP", func() error { return s.next.SaveUserTOTP(ctx, t) })
+}
+
+func (s *instrumentedStore) EnableUserTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	return observe("EnableUserTOTP", func() error { return s.next.EnableUserTOTP(ctx, userID, recoveryCodeHashes) })
+}
+
+func (s *instrumentedStore) DeleteUserTOTP(ctx context.Context, userID int64) error {
+	return observe("DeleteUserTOTP", func() error { return s.next.DeleteUserTOTP(ctx, userID) })
+}
+
+func (s *instrumentedStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return observe("UseTOTPStep", func() error { return s.next.UseTOTPStep(ctx, userID, step) })
+}
+
+func (s *instrumentedStore) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	return observe("ConsumeRecoveryCode", func() error { return s.next.ConsumeRecoveryCode(ctx, userID, codeHash) })
+}
+
+func (s *instrumentedStore) GetLoginThrottle(ctx context.Context, scope, key string) (*model.LoginThrottle, error) {
+	return observeResult("GetLoginThrottle", func() (*model.LoginThrottle, error) { return s.next.GetLoginThrottle(ctx, scope, key) })
+}
+
+func (s *instrumentedStore) RecordLoginFailure(ctx context.Context, scope, key string, since time.Time) (*model.LoginThrottle, error) {
+	return observeResult("RecordLoginFailure", func() (*model.LoginThrottle, error) { return s.next.RecordLoginFailure(ctx, scope, key, since) })
+}
+
+func (s *instrumentedStore) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	return observe("LockLogin", func() error { return s.next.LockLogin(ctx, scope, key, until) })
+}
+
+func (s *instrumentedStore) ClearLoginThrottle(ctx context.Context, scope, key string) error {
+	return observe("ClearLoginThrottle", func() error { return s.next.ClearLoginThrottle(ctx, scope, key) })
+}
+
+func (s *instrumentedStore) ListLoginLockouts(ctx context.Context, now time.Time) ([]model.LoginThrottle, error) {
+	return observeResult("ListLoginLockouts", func() ([]model.LoginThrottle, error) { return s.next.ListLoginLockouts(ctx, now) })
+}
+
+func (s *instrumentedStore) CreateAccessToken(ctx context.Context, t *model.AccessToken) (*model.AccessToken, error) {
+	return observeResult("CreateAccessToken", func() (*model.AccessToken, error) { return s.next.CreateAccessToken(ctx, t) })
+}
+
+func (s *instrumentedStore) GetAccessTokenByHash(ctx context.Context, tokenHash string) (*model.AccessToken, error) {
+	return observeResult("GetAccessTokenByHash", func() (*model.AccessToken, error) { return s.next.GetAccessTokenByHash(ctx, tokenHash) })
+}
+
+func (s *instrumentedStore) ListAccessTokens(ctx context.Context, userID int64) ([]model.AccessToken, error) {
+	return observeResult("ListAccessTokens", func() ([]model.AccessToken, error) { return s.next.ListAccessTokens(ctx, userID) })
+}
+
+func (s *instrumentedStore) RevokeAccessToken(ctx context.Context, userID, id int64) error {
+	return observe("RevokeAccessToken", func() error { return s.next.RevokeAccessToken(ctx, userID, id) })
+}
+
+func (s *instrumentedStore) RevokeUserAccessTokens(ctx context.Context, userID int64) (int64, error) {
+	return observeResult("RevokeUserAccessTokens", func() (int64, error) { return s.next.RevokeUserAccessTokens(ctx, userID) })
+}
+
+func (s *instrumentedStore) TouchAccessToken(ctx context.Context, id int64, usedAt time.Time) error {
+	return observe("TouchAccessToken", func() error { return s.next.TouchAccessToken(ctx, id, usedAt) })
+}
+
+func (s *instrumentedStore) CreateSession(ctx context.Context, sess *model.Session) (*model.Session, error) {
+	return observeResult("CreateSession", func() (*model.Session, error) { return s.next.CreateSession(ctx, sess) })
+}
+
+func (s *instrumentedStore) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	return observeResult("GetSession", func() (*model.Session, error) { return s.next.GetSession(ctx, id) })
+}
+
+func (s *instrumentedStore) ListSessions(ctx context.Context, userID int64, now time.Time) ([]model.Session, error) {
+	return observeResult("ListSessions", func() ([]model.Session, error) { return s.next.ListSessions(ctx, userID, now) })
+}
+
+func (s *instrumentedStore) RevokeSession(ctx context.Context, userID int64, id string) error {
+	return observe("RevokeSession", func() error { return s.next.RevokeSession(ctx, userID, id) })
+}
+
+func (s *instrumentedStore) RevokeOtherSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	return observeResult("RevokeOtherSessions", func() (int64, error) { return s.next.RevokeOtherSessions(ctx, userID, keepID) })
+}
+
+func (s *instrumentedStore) TouchSession(ctx context.Context, id string, seenAt time.Time, ip string) error {
+	return observe("TouchSession", func() error { return s.next.TouchSession(ctx, id, seenAt, ip) })
+}
+
+func (s *instrumentedStore) GetUserIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error) {
+	return observeResult("GetUserIdentity", func() (*model.UserIdentity, error) { return s.next.GetUserIdentity(ctx, issuer, subject) })
+}
+
+func (s *instrumentedStore) CreateUserIdentity(ctx context.Context, i *model.UserIdentity) (*model.UserIdentity, error) {
+	return observeResult("CreateUserIdentity", func() (*model.UserIdentity, error) { return s.next.CreateUserIdentity(ctx, i) })
+}
+
+func (s *instrumentedStore) CreateOrganization(ctx context.Context, o *model.Organization, ownerID int64) (*model.Organization, error) {
+	return observeResult("CreateOrganization", func() (*model.Organization, error) { return s.next.CreateOrganization(ctx, o, ownerID) })
+}
+
+func (s *instrumentedStore) GetOrganization(ctx context.Context, id int64) (*model.Organization, error) {
+	return observeResult("GetOrganization", func() (*model.Organization, error) { return s.next.GetOrganization(ctx, id) })
+}
+
+func (s *instrumentedStore) GetOrganizationBySlug(ctx context.Context, slug string) (*model.Organization, error) {
+	return observeResult("GetOrganizationBySlug", func() (*model.Organization, error) { return s.next.GetOrganizationBySlug(ctx, slug) })
+}
+
+func (s *instrumentedStore) ListUserOrganizations(ctx context.Context, userID int64) ([]model.Organization, error) {
+	return observeResult("ListUserOrganizations", func() ([]model.Organization, error) { return s.next.ListUserOrganizations(ctx, userID) })
+}
+
+func (s *instrumentedStore) DeleteOrganization(ctx context.Context, id int64) error {
+	return observe("DeleteOrganization", func() error { return s.next.DeleteOrganization(ctx, id) })
+}
+
+func (s *instrumentedStore) GetOrgMember(ctx context.Context, orgID, userID int64) (*model.OrgMember, error) {
+	return observeResult("GetOrgMember", func() (*model.OrgMember, error) { return s.next.GetOrgMember(ctx, orgID, userID) })
+}
+
+func (s *instrumentedStore) ListOrgMembers(ctx context.Context, orgID int64) ([]model.OrgMember, error) {
+	return observeResult("ListOrgMembers", func() ([]model.OrgMember, error) { return s.next.ListOrgMembers(ctx, orgID) })
+}
+
+func (s *instrumentedStore) UpdateOrgMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	return observe("UpdateOrgMemberRole", func() error { return s.next.UpdateOrgMemberRole(ctx, orgID, userID, role) })
+}
+
+func (s *instrumentedStore) RemoveOrgMember(ctx context.Context, orgID, userID int64) error {
+	return observe("RemoveOrgMember", func() error { return s.next.RemoveOrgMember(ctx, orgID, userID) })
+}
+
+func (s *instrumentedStore) CreateOrgInvitation(ctx context.Context, inv *model.OrgInvitation) (*model.OrgInvitation, error) {
+	return observeResult("CreateOrgInvitation", func() (*model.OrgInvitation, error) { return s.next.CreateOrgInvitation(ctx, inv) })
+}
+
+func (s *instrumentedStore) GetOrgInvitationByHash(ctx context.Context, tokenHash string) (*model.OrgInvitation, error) {
+	return observeResult("GetOrgInvitationByHash", func() (*model.OrgInvitation, error) { return s.next.GetOrgInvitationByHash(ctx, tokenHash) })
+}
+
+func (s *instrumentedStore) ListOrgInvitations(ctx context.Context, orgID int64, now time.Time) ([]model.OrgInvitation, error) {
+	return observeResult("ListOrgInvitations", func() ([]model.OrgInvitation, error) { return s.next.ListOrgInvitations(ctx, orgID, now) })
+}
+
+func (s *instrumentedStore) RevokeOrgInvitation(ctx context.Context, orgID, id int64) error {
+	return observe("RevokeOrgInvitation", func() error { return s.next.RevokeOrgInvitation(ctx, orgID, id) })
+}
+
+func (s *instrumentedStore) AcceptOrgInvitation(ctx context.Context, id, userID int64) error {
+	return observe("AcceptOrgInvitation", func() error { return s.next.AcceptOrgInvitation(ctx, id, userID) })
+}
+
+func (s *instrumentedStore) CreateTeam(ctx context.Context, orgID int64, t *model.Team) (*model.Team, error) {
+	return observeResult("CreateTeam", func() (*model.Team, error) { return s.next.CreateTeam(ctx, orgID, t) })
+}
+
+func (s *instrumentedStore) GetTeam(ctx context.Context, orgID, id int64) (*model.Team, error) {
+	return observeResult("GetTeam", func() (*model.Team, error) { return s.next.GetTeam(ctx, orgID, id) })
+}
+
+func (s *instrumentedStore) ListTeams(ctx context.Context, orgID int64) ([]model.Team, error) {
+	return observeResult("ListTeams", func() ([]model.Team, error) { return s.next.ListTeams(ctx, orgID) })
+}
+
+func (s *instrumentedStore) DeleteTeam(ctx context.Context, orgID, id int64) error {
+	return observe("DeleteTeam", func() error { return s.next.DeleteTeam(ctx, orgID, id) })
+}
+
+func (s *instrumentedStore) AddTeamMember(ctx context.Context, orgID, teamID, userID int64) error {
+	return observe("AddTeamMember", func() error { return s.next.AddTeamMember(ctx, orgID, teamID, userID) })
+}
+
+func (s *instrumentedStore) RemoveTeamMember(ctx context.Context, orgID, teamID, userID int64) error {
+	return observe("RemoveTeamMember", func() error { return s.next.RemoveTeamMember(ctx, orgID, teamID, userID) })
+}
+
+func (s *instrumentedStore) ListTeamMembers(ctx context.Context, orgID, teamID int64) ([]model.OrgMember, error) {
+	return observeResult("ListTeamMembers", func() ([]model.OrgMember, error) { return s.next.ListTeamMembers(ctx, orgID, teamID) })
+}
+
+func (s *instrumentedStore) ListProjectGrants(ctx context.Context, orgID, projectID int64) ([]model.ProjectGrant, error) {
+	return observeResult("ListProjectGrants", func() ([]model.ProjectGrant, error) { return s.next.ListProjectGrants(ctx, orgID, projectID) })
+}
+
+func (s *instrumentedStore) ListUserProjectGrants(ctx context.Context, orgID, projectID, userID int64) ([]model.ProjectGrant, error) {
+	return observeResult("ListUserProjectGrants", func() ([]model.ProjectGrant, error) {
+		return s.next.ListUserProjectGrants(ctx, orgID, projectID, userID)
+	})
+}
+
+func (s *instrumentedStore) SetProjectUserGrant(ctx context.Context, orgID, projectID, userID int64, role string) error {
+	return observe("SetProjectUserGrant", func() error { return s.next.SetProjectUserGrant(ctx, orgID, projectID, userID, role) })
+}
+
+func (s *instrumentedStore) DeleteProjectUserGrant(ctx context.Context, orgID, projectID, userID int64) error {
+	return observe("DeleteProjectUserGrant", func() error { return s.next.DeleteProjectUserGrant(ctx, orgID, projectID, userID) })
+}
+
+func (s *instrumentedStore) SetProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64, role string) error {
+	return observe("SetProjectTeamGrant", func() error { return s.next.SetProjectTeamGrant(ctx, orgID, projectID, teamID, role) })
+}
+
+func (s *instrumentedStore) DeleteProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64) error {
+	return observe("DeleteProjectTeamGrant", func() error { return s.next.DeleteProjectTeamGrant(ctx, orgID, projectID, teamID) })
+}
+
+func (s *instrumentedStore) CreateProjectInvitation(ctx context.Context, inv *model.ProjectInvitation) (*model.ProjectInvitation, error) {
+	return observeResult("CreateProjectInvitation", func() (*model.ProjectInvitation, error) { return s.next.CreateProjectInvitation(ctx, inv) })
+}
+
+func (s *instrumentedStore) GetProjectInvitationByHash(ctx context.Context, tokenHash string) (*model.ProjectInvitation, error) {
+	return observeResult("GetProjectInvitationByHash", func() (*model.ProjectInvitation, error) { return s.next.GetProjectInvitationByHash(ctx, tokenHash) })
+}
+
+func (s *instrumentedStore) ListProjectInvitations(ctx context.Context, orgID, projectID int64, now time.Time) ([]model.ProjectInvitation, error) {
+	return observeResult("ListProjectInvitations", func() ([]model.ProjectInvitation, error) {
+		return s.next.ListProjectInvitations(ctx, orgID, projectID, now)
+	})
+}
+
+func (s *instrumentedStore) RevokeProjectInvitation(ctx context.Context, orgID, projectID, id int64) error {
+	return observe("RevokeProjectInvitation", func() error { return s.next.RevokeProjectInvitation(ctx, orgID, projectID, id) })
+}
+
+func (s *instrumentedStore) AcceptProjectInvitation(ctx context.Context, id, userID int64) error {
+	return observe("AcceptProjectInvitation", func() error { return s.next.AcceptProjectInvitation(ctx, id, userID) })
+}
+
+func (s *instrumentedStore) DeclineProjectInvitation(ctx context.Context, id int64) error {
+	return observe("DeclineProjectInvitation", func() error { return s.next.DeclineProjectInvitation(ctx, id) })
+}
+
+func (s *instrumentedStore) CreateShareLink(ctx context.Context, link *model.ShareLink) (*model.ShareLink, error) {
+	return observeResult("CreateShareLink", func() (*model.ShareLink, error) { return s.next.CreateShareLink(ctx, link) })
+}
+
+func (s *instrumentedStore) GetShareLink(ctx context.Context, id int64) (*model.ShareLink, error) {
+	return observeResult("GetShareLink", func() (*model.ShareLink, error) { return s.next.GetShareLink(ctx, id) })
+}
+
+func (s *instrumentedStore) ListShareLinks(ctx context.Context, orgID, projectID int64) ([]model.ShareLink, error) {
+	return observeResult("ListShareLinks", func() ([]model.ShareLink, error) { return s.next.ListShareLinks(ctx, orgID, projectID) })
+}
+
+func (s *instrumentedStore) RevokeShareLink(ctx context.Context, orgID, projectID, id int64) error {
+	return observe("RevokeShareLink", func() error { return s.next.RevokeShareLink(ctx, orgID, projectID, id) })
+}
+
+func (s *instrumentedStore) GetSharedProject(ctx context.Context, projectID int64) (*model.SharedProject, error) {
+	return observeResult("GetSharedProject", func() (*model.SharedProject, error) { return s.next.GetSharedProject(ctx, projectID) })
+}
+
+func (s *instrumentedStore) GetStats(ctx context.Context) (*model.Stats, error) {
+	return observeResult("GetStats", func() (*model.Stats, error) { return s.next.GetStats(ctx) })
+}
+
+func (s *instrumentedStore) CreateTask(ctx context.Context, orgID int64, t *model.Task) (*model.Task, error) {
+	return observeResult("CreateTask", func() (*model.Task, error) { return s.next.CreateTask(ctx, orgID, t) })
+}
+
+func (s *instrumentedStore) GetTask(ctx context.Context, orgID int64, id string) (*model.Task, error) {
+	return observeResult("GetTask", func() (*model.Task, error) { return s.next.GetTask(ctx, orgID, id) })
+}
+
+func (s *instrumentedStore) DeleteTask(ctx context.Context, orgID int64, id string, version int64) error {
+	return observe("DeleteTask", func() error { return s.next.DeleteTask(ctx, orgID, id, version) })
+}
+
+func (s *instrumentedStore) UpdateTask(ctx context.Context, orgID int64, t *model.Task) (*model.Task, error) {
+	return observeResult("UpdateTask", func() (*model.Task, error) { return s.next.UpdateTask(ctx, orgID, t) })
+}
+
+func (s *instrumentedStore) PatchTask(ctx context.Context, orgID int64, id string, version int64, patch *model.TaskPatch) (*model.Task, error) {
+	return observeResult("PatchTask", func() (*model.Task, error) { return s.next.PatchTask(ctx, orgID, id, version, patch) })
+}
+
+func (s *instrumentedStore) CreateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error) {
+	return observeResult("CreateProject", func() (*model.Project, error) { return s.next.CreateProject(ctx, orgID, p) })
+}
+
+func (s *instrumentedStore) GetProject(ctx context.Context, orgID int64, id string) (*model.Project, error) {
+	return observeResult("GetProject", func() (*model.Project, error) { return s.next.GetProject(ctx, orgID, id) })
+}
+
+func (s *instrumentedStore) DeleteProject(ctx context.Context, orgID int64, id string, version int64) error {
+	return observe("DeleteProject", func() error { return s.next.DeleteProject(ctx, orgID, id, version) })
+}
+
+func (s *instrumentedStore) UpdateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error) {
+	return observeResult("UpdateProject", func() (*model.Project, error) { return s.next.UpdateProject(ctx, orgID, p) })
+}
+
+func (s *instrumentedStore) PatchProject(ctx context.Context, orgID int64, id string, version int64, patch *model.ProjectPatch) (*model.Project, error) {
+	return observeResult("PatchProject", func() (*model.Project, error) { return s.next.PatchProject(ctx, orgID, id, version, patch) })
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// AccessTokenPrefix marks personal access tokens so AuthHandler can tell them
+// apart from JWTs, and so leaked tokens are easy to spot in secret scanners.
+const AccessTokenPrefix = "pmp_"
+
+// accessTokenTouchInterval limits how often last-used timestamps are written.
+const accessTokenTouchInterval = time.Minute
+
+// GenerateAccessToken returns a new personal access token and its hash.
+func GenerateAccessToken() (token string, hash string, err error) {
+	raw, _, err := GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	token = AccessTokenPrefix + raw
+	return token, HashToken(token), nil
+}
+
+// authenticateAccessToken returns the owner of a personal access token that is
+// active and holds every required scope, along with the owner's account. A
+// route that requires no scopes does not accept access tokens at all.
+func authenticateAccessToken(ctx context.Context, store repository.Store, tokenStr string, scopes []string) (int64, *model.User, error) {
+	if len(scopes) == 0 {
+		return 0, nil, errors.New("access tokens are not accepted on this route")
+	}
+
+	token, err := store.GetAccessTokenByHash(ctx, HashToken(tokenStr))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil {
+		return 0, nil, errors.New("access token has been revoked")
+	}
+	if !token.ExpiresAt.After(now) {
+		return 0, nil, errors.New("access token has expired")
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(token.Scopes, scope) {
+			return 0, nil, errors.New("access token is missing scope " + scope)
+		}
+	}
+
+	user, err := store.GetUserByID(ctx, strconv.FormatInt(token.UserID, 10))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenTouchInterval {
+		if err := store.TouchAccessToken(ctx, token.ID, now); err != nil {
+			logging.FromContext(ctx).Error("authenticateAccessToken: error updating last used time", "error", err)
+		}
+	}
+
+	return token.UserID, user, nil
+}
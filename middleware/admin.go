@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+)
+
+// RequireRole authenticates the request like AuthHandler and additionally
+// requires the user to hold role or a more privileged one.
+func RequireRole(role string, handlerFunc http.HandlerFunc, store repository.Store, scopes ...string) http.HandlerFunc {
+	return AuthHandler(func(w http.ResponseWriter, r *http.Request) {
+		if !HasRole(GetUserRoleFromContext(r.Context()), role) {
+			logging.FromContext(r.Context()).Info("RequireRole: access denied", "required_role", role)
+			utils.WriteError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+
+		handlerFunc(w, r)
+	}, store, scopes...)
+}
+
+// AdminHandler only lets administrators through to handlerFunc.
+func AdminHandler(handlerFunc http.HandlerFunc, store repository.Store) http.HandlerFunc {
+	return RequireRole(model.RoleAdmin, handlerFunc, store)
+}
+
+// HasRole reports whether role is at least as privileged as required.
+// Unknown roles are not privileged at all.
+func HasRole(role, required string) bool {
+	have := slices.Index(model.Roles, role)
+	return have >= 0 && have >= slices.Index(model.Roles, required)
+}
@@ -1,62 +1,161 @@
 package middleware
 
 import (
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
 	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
 	"github.com/golang-jwt/jwt"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func AuthHandler(handlerFunc http.HandlerFunc, store repository.Store) http.HandlerFunc {
+// AuthHandler only lets authenticated requests through to handlerFunc. It
+// accepts session JWTs, from the Authorization header or the session cookie,
+// and, on routes that list the scopes they need, personal access tokens
+// holding all of those scopes. Requests authenticated by the cookie must
+// pass the CSRF check. Authentication is traced in its own span, which
+// ends before handlerFunc runs.
+func AuthHandler(handlerFunc http.HandlerFunc, store repository.Store, scopes ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		parent := trace.SpanFromContext(r.Context())
+		ctx, span := tracer.Start(r.Context(), "AuthHandler")
+		defer span.End()
+		r = r.WithContext(ctx)
 
 		// get the token from the request header (auth)
 		tokenStr := GetToken(r)
+
+		fromCookie := false
+		if tokenStr == "" {
+			if cookie, err := r.Cookie(SessionCookie); err == nil {
+				tokenStr, fromCookie = cookie.Value, true
+			}
+		}
+
+		if strings.HasPrefix(tokenStr, AccessTokenPrefix) && !fromCookie {
+			userID, user, err := authenticateAccessToken(r.Context(), store, tokenStr, scopes)
+			if err != nil {
+				logging.FromContext(r.Context()).Info("AuthHandler: invalid access token", "error", err)
+				permmissionDenied(w)
+				return
+			}
+
+			if user.DeactivatedAt != nil {
+				logging.FromContext(r.Context()).Info("AuthHandler: user is deactivated", "user_id", userID)
+				permmissionDenied(w)
+				return
+			}
+
+			if !allowUser(w, r, userID) {
+				return
+			}
+
+			ctx := WithUserID(r.Context(), userID)
+			ctx = WithUserRole(ctx, user.Role)
+			span.End()
+			handlerFunc(w, r.WithContext(trace.ContextWithSpan(ctx, parent)))
+			return
+		}
+
 		// validate the token
 		token, err := ValidateJWT(tokenStr)
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(r.Context()).Info("AuthHandler: invalid token", "error", err)
 			permmissionDenied(w)
 			return
 		}
 
 		if !token.Valid {
-			log.Println("token is not valid")
+			logging.FromContext(r.Context()).Info("AuthHandler: token is not valid")
 			permmissionDenied(w)
 			return
 		}
 		// get the userId from the token with claims
 		claims := token.Claims.(jwt.MapClaims)
-		userID := claims["userID"].(string)
+		userID, ok := claims["userID"].(string)
+		if !ok {
+			logging.FromContext(r.Context()).Info("AuthHandler: token has no user id")
+			permmissionDenied(w)
+			return
+		}
 
-		_, err = store.GetUserByID(userID)
+		user, err := store.GetUserByID(r.Context(), userID)
 		if err != nil {
-			log.Println("failed to get user")
+			logging.FromContext(r.Context()).Info("AuthHandler: failed to get user", "error", err)
 			permmissionDenied(w)
 			return
 		}
+
+		if user.DeactivatedAt != nil {
+			logging.FromContext(r.Context()).Info("AuthHandler: user is deactivated", "user_id", user.ID)
+			permmissionDenied(w)
+			return
+		}
+
+		if fromCookie {
+			if err := checkCSRF(r, claims); err != nil {
+				logging.FromContext(r.Context()).Info("AuthHandler: CSRF check failed", "error", err)
+				utils.WriteProblem(w, model.Problem{Status: http.StatusForbidden, Code: model.ProblemCSRFFailed, Detail: err.Error()})
+				return
+			}
+		}
+
+		sessionID, _ := claims["sid"].(string)
+		session, err := authenticateSession(store, sessionID, user.ID, r)
+		if err != nil {
+			logging.FromContext(r.Context()).Info("AuthHandler: invalid session", "error", err)
+			permmissionDenied(w)
+			return
+		}
+
+		if !allowUser(w, r, user.ID) {
+			return
+		}
+
 		// call the handler func and continue to the next endpoint
-		handlerFunc(w, r)
+		ctx = WithUserID(r.Context(), user.ID)
+		ctx = WithSessionID(ctx, sessionID)
+		ctx = WithUserRole(ctx, user.Role)
+		if session.ImpersonatorID != nil {
+			ctx = WithImpersonatorID(ctx, *session.ImpersonatorID)
+			logging.FromContext(ctx).Info("AuthHandler: admin acting as user", "method", r.Method, "path", r.URL.Path)
+		}
+		span.End()
+		handlerFunc(w, r.WithContext(trace.ContextWithSpan(ctx, parent)))
 
 	}
 }
 
+// OwnerHandler is AuthHandler for endpoints that mint credentials or change
+// how the account is secured. Administrators in a support session are
+// refused with 403, as what they did there would outlive the session and
+// escape its audit trail.
+func OwnerHandler(handlerFunc http.HandlerFunc, store repository.Store) http.HandlerFunc {
+	return AuthHandler(func(w http.ResponseWriter, r *http.Request) {
+		if GetImpersonatorIDFromContext(r.Context()) != 0 {
+			logging.FromContext(r.Context()).Info("OwnerHandler: refused in a support session", "method", r.Method, "path", r.URL.Path)
+			utils.WriteError(w, http.StatusForbidden, "not allowed while acting as another user")
+			return
+		}
+
+		handlerFunc(w, r)
+	}, store)
+}
+
 func permmissionDenied(w http.ResponseWriter) {
-	utils.WriteJSON(w, http.StatusUnauthorized, model.ErrorResponse{
-		Error: fmt.Errorf("permission denied").Error(),
-	})
+	utils.WriteError(w, http.StatusUnauthorized, "permission denied")
 }
 
 func GetToken(r *http.Request) string {
-	tokenAuth := r.Header.Get("Authorization")
+	tokenAuth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 	tokenQuery := r.URL.Query().Get("token")
 
 	if tokenAuth != "" {
@@ -70,16 +169,10 @@ func GetToken(r *http.Request) string {
 	return ""
 }
 
+// ValidateJWT verifies a token signed by any key of the keyring that has not
+// been retired.
 func ValidateJWT(token string) (*jwt.Token, error) {
-	secretKey := config.Envs.JWTSecret
-
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return []byte(secretKey), nil
-	})
+	return signingKeys().Parse(token)
 }
 
 func HashPassword(password string) (string, error) {
@@ -92,16 +185,47 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func CreateJWT(secretKey []byte, userID int64) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// CreateJWT issues a session token for the given server-side session. The
+// CSRF token is bound to the session through the "csrf" claim.
+func CreateJWT(userID int64, sessionID, csrfToken string) (string, error) {
+	return SignJWT(jwt.MapClaims{
 		"userID": strconv.Itoa(int(userID)),
-		"expiresAt": time.Now().Add(time.Minute * 1).Unix(), 
+		"sid":    sessionID,
+		"csrf":   csrfToken,
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(config.Envs.JWTTTL).Unix(),
 	})
+}
 
-	tokenString, err := token.SignedString(secretKey)
+const challengeTokenTTL = 5 * time.Minute
+
+// CreateChallengeJWT issues the short-lived token returned by the first login
+// step when two-factor authentication is enabled. It carries no "userID"
+// claim, so AuthHandler never accepts it as a session token.
+func CreateChallengeJWT(userID int64) (string, error) {
+	return SignJWT(jwt.MapClaims{
+		"challengeUserID": strconv.Itoa(int(userID)),
+		"exp":             time.Now().Add(challengeTokenTTL).Unix(),
+	})
+}
+
+// ValidateChallengeJWT returns the user ID held by a valid, unexpired
+// challenge token.
+func ValidateChallengeJWT(tokenStr string) (int64, error) {
+	token, err := ValidateJWT(tokenStr)
 	if err != nil {
-		return "", err
+		return 0, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return 0, errors.New("invalid challenge token")
+	}
+
+	userID, ok := claims["challengeUserID"].(string)
+	if !ok {
+		return 0, errors.New("invalid challenge token")
 	}
 
-	return tokenString, nil
+	return strconv.ParseInt(userID, 10, 64)
 }
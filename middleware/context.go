@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const (
+	userIDKey         contextKey = "userID"
+	sessionIDKey      contextKey = "sessionID"
+	userRoleKey       contextKey = "userRole"
+	impersonatorIDKey contextKey = "impersonatorID"
+	orgIDKey          contextKey = "orgID"
+	orgRoleKey        contextKey = "orgRole"
+	rateLimitKey      contextKey = "rateLimit"
+	requestIDKey      contextKey = "requestID"
+	accessLogKey      contextKey = "accessLog"
+)
+
+// GetUserIDFromContext returns the ID of the user authenticated by
+// AuthHandler, or 0 if the request is unauthenticated.
+func GetUserIDFromContext(ctx context.Context) int64 {
+	userID, _ := ctx.Value(userIDKey).(int64)
+	return userID
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID. The
+// ID is added to the request logger, the access log and the current span as
+// well.
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	if entry, ok := ctx.Value(accessLogKey).(*accessLog); ok {
+		entry.userID = userID
+	}
+	trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserID(strconv.FormatInt(userID, 10)))
+	ctx = logging.With(ctx, "user_id", userID)
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// GetSessionIDFromContext returns the session the request was authenticated
+// with, or "" for personal access tokens and unauthenticated requests.
+func GetSessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey).(string)
+	return sessionID
+}
+
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// GetUserRoleFromContext returns the global role of the user authenticated
+// by AuthHandler, or "" if the request is unauthenticated.
+func GetUserRoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(userRoleKey).(string)
+	return role
+}
+
+func WithUserRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, userRoleKey, role)
+}
+
+// GetImpersonatorIDFromContext returns the administrator acting as the user
+// in a support session, or 0 if the user is acting for themselves.
+func GetImpersonatorIDFromContext(ctx context.Context) int64 {
+	impersonatorID, _ := ctx.Value(impersonatorIDKey).(int64)
+	return impersonatorID
+}
+
+func WithImpersonatorID(ctx context.Context, impersonatorID int64) context.Context {
+	ctx = logging.With(ctx, "impersonator_id", impersonatorID)
+	return context.WithValue(ctx, impersonatorIDKey, impersonatorID)
+}
+
+// GetOrgIDFromContext returns the organization selected by OrgHandler, or 0
+// outside of an organization.
+func GetOrgIDFromContext(ctx context.Context) int64 {
+	orgID, _ := ctx.Value(orgIDKey).(int64)
+	return orgID
+}
+
+// WithOrgID returns a copy of ctx carrying the ID of the organization the
+// request works in, which is added to the current span as well.
+func WithOrgID(ctx context.Context, orgID int64) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("app.org_id", orgID))
+	return context.WithValue(ctx, orgIDKey, orgID)
+}
+
+// GetOrgRoleFromContext returns the user's role in the organization selected
+// by OrgHandler.
+func GetOrgRoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(orgRoleKey).(string)
+	return role
+}
+
+func WithOrgRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, orgRoleKey, role)
+}
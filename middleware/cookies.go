@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// SessionCookie holds the session JWT for browsers. It is HttpOnly, so
+	// scripts on the page can never read the token.
+	SessionCookie = "session"
+	// CSRFCookie holds the CSRF token. Scripts must read it and echo it in
+	// CSRFHeader on state-changing requests authenticated by SessionCookie.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+
+	cookiePath = "/api/v1"
+)
+
+var errInvalidCSRFToken = errors.New("missing or invalid CSRF token")
+
+// SetSessionCookies stores a session token and its CSRF token in cookies
+// that expire together with the session.
+func SetSessionCookies(w http.ResponseWriter, token, csrfToken string, expiresAt time.Time) {
+	http.SetCookie(w, sessionCookie(SessionCookie, token, expiresAt, true))
+	http.SetCookie(w, sessionCookie(CSRFCookie, csrfToken, expiresAt, false))
+	w.Header().Set(CSRFHeader, csrfToken)
+}
+
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(SessionCookie, "", time.Unix(0, 0), true))
+	http.SetCookie(w, sessionCookie(CSRFCookie, "", time.Unix(0, 0), false))
+}
+
+func sessionCookie(name, value string, expiresAt time.Time, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cookiePath,
+		Domain:   config.Envs.CookieDomain,
+		Expires:  expiresAt,
+		HttpOnly: httpOnly,
+		Secure:   config.Envs.CookieSecure,
+		SameSite: cookieSameSite(),
+	}
+
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
+
+func cookieSameSite() http.SameSite {
+	switch config.Envs.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// checkCSRF verifies the CSRF header of a cookie-authenticated request
+// against the token bound to the session. Safe methods are exempt.
+func checkCSRF(r *http.Request, claims jwt.MapClaims) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	expected, _ := claims["csrf"].(string)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(r.Header.Get(CSRFHeader))) != 1 {
+		return errInvalidCSRFToken
+	}
+
+	return nil
+}
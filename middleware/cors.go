@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const corsMaxAge = "600"
+
+var (
+	corsAllowedMethods = strings.Join([]string{"GET", "POST", "PUT", "PATCH", "DELETE"}, ", ")
+	corsAllowedHeaders = strings.Join([]string{"Authorization", "Content-Type", CSRFHeader, RequestIDHeader, OrgHeader, "X-Share-Password", "If-Match", "If-None-Match", "traceparent", "tracestate"}, ", ")
+	corsExposedHeaders = strings.Join([]string{CSRFHeader, RequestIDHeader, "ETag", "Retry-After"}, ", ")
+)
+
+// CORS lets browsers on the allowed origins call the API with credentials.
+// It must wrap the whole router, because preflight requests use OPTIONS and
+// would not match any route.
+func CORS(allowedOrigins []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+
+		if origin == "" || !slices.Contains(allowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	handler := CORS([]string{"https://app.example.com"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	t.Run("should answer preflight requests from allowed origins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/api/v1/projects", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if rr.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || rr.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("unexpected CORS headers %v", rr.Header())
+		}
+
+		allowed := strings.Split(rr.Header().Get("Access-Control-Allow-Headers"), ", ")
+		for _, header := range []string{"If-Match", "If-None-Match", OrgHeader, "X-Share-Password"} {
+			if !slices.Contains(allowed, header) {
+				t.Errorf("expected %s to be allowed, got %v", header, allowed)
+			}
+		}
+	})
+
+	t.Run("should not allow other origins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/projects", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusTeapot {
+			t.Errorf("expected the request to reach the handler, got %d", rr.Code)
+		}
+		if rr.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Error("expected no Access-Control-Allow-Origin header")
+		}
+	})
+
+	t.Run("should expose the CSRF, request ID and ETag headers to allowed origins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/projects", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Header().Get("Access-Control-Expose-Headers") != CSRFHeader+", "+RequestIDHeader+", ETag, Retry-After" {
+			t.Errorf("unexpected exposed headers %q", rr.Header().Get("Access-Control-Expose-Headers"))
+		}
+	})
+}
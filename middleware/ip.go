@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+)
+
+// ClientIP returns the IP address of the client that sent the request.
+// Forwarding headers are only honoured when TRUST_PROXY_HEADERS is set,
+// otherwise any client could pick its own address.
+//
+// Each proxy appends the address it received the request from to
+// X-Forwarded-For, after whatever the client sent, so only the last
+// TRUSTED_PROXY_HOPS entries can be believed and the client is the first of
+// them.
+func ClientIP(r *http.Request) string {
+	if config.Envs.TrustProxyHeaders {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(header, ",")...)
+		}
+
+		if len(hops) > 0 {
+			i := max(len(hops)-max(config.Envs.TrustedProxyHops, 1), 0)
+			if ip := strings.TrimSpace(hops[i]); ip != "" {
+				return ip
+			}
+		}
+
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
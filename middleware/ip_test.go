@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+)
+
+func TestClientIP(t *testing.T) {
+	defer func(trust bool, hops int) {
+		config.Envs.TrustProxyHeaders, config.Envs.TrustedProxyHops = trust, hops
+	}(config.Envs.TrustProxyHeaders, config.Envs.TrustedProxyHops)
+
+	request := func(forwarded ...string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:4321"
+		for _, f := range forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		return req
+	}
+
+	t.Run("should ignore forwarding headers unless trusted", func(t *testing.T) {
+		config.Envs.TrustProxyHeaders = false
+
+		if ip := ClientIP(request("203.0.113.9")); ip != "10.0.0.1" {
+			t.Errorf("expected 10.0.0.1, got %q", ip)
+		}
+	})
+
+	t.Run("should ignore entries the client sent", func(t *testing.T) {
+		config.Envs.TrustProxyHeaders, config.Envs.TrustedProxyHops = true, 1
+
+		if ip := ClientIP(request("198.51.100.7, 203.0.113.9")); ip != "203.0.113.9" {
+			t.Errorf("expected the entry the proxy appended, got %q", ip)
+		}
+
+		if ip := ClientIP(request("198.51.100.7", "203.0.113.9")); ip != "203.0.113.9" {
+			t.Errorf("expected the entry the proxy appended across headers, got %q", ip)
+		}
+	})
+
+	t.Run("should count trusted hops from the right", func(t *testing.T) {
+		config.Envs.TrustProxyHeaders, config.Envs.TrustedProxyHops = true, 2
+
+		if ip := ClientIP(request("198.51.100.7, 203.0.113.9, 10.0.0.2")); ip != "203.0.113.9" {
+			t.Errorf("expected 203.0.113.9, got %q", ip)
+		}
+
+		if ip := ClientIP(request("203.0.113.9")); ip != "203.0.113.9" {
+			t.Errorf("expected the only entry, got %q", ip)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"sync"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	keysMu sync.RWMutex
+	keys   *keyring.Keyring
+)
+
+// SetKeyring replaces the keys JWTs are signed and verified with. Until it
+// is called, tokens use HS256 with config.Envs.JWTSecret.
+func SetKeyring(k *keyring.Keyring) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	keys = k
+}
+
+func signingKeys() *keyring.Keyring {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	if keys == nil {
+		return keyring.NewHMAC([]byte(config.Envs.JWTSecret))
+	}
+
+	return keys
+}
+
+// SignJWT signs claims with the current signing key. Every token the API
+// verifies must expire, so claims need an "exp".
+func SignJWT(claims jwt.MapClaims) (string, error) {
+	return signingKeys().Sign(claims)
+}
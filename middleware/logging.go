@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/metrics"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID that ties the log lines of a request
+// together. A valid ID sent by the client or a proxy is kept, otherwise one
+// is generated; either way it is returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLen = 128
+
+// accessLog collects what the access log line reports but only the inner
+// handlers know, such as the route and the authenticated user.
+type accessLog struct {
+	route  string
+	userID int64
+}
+
+// RequestLogger assigns the request ID, puts a logger carrying it, and the
+// trace ID of a traced request, into the request context and, once the
+// request is served, logs one line for it and records it in the request
+// metrics. It must wrap the whole router, so that requests no route matches
+// are logged too.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		logger := logging.FromContext(r.Context()).With("request_id", requestID)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		entry := &accessLog{}
+		ctx := logging.WithLogger(r.Context(), logger)
+		ctx = context.WithValue(ctx, requestIDKey, requestID)
+		ctx = context.WithValue(ctx, accessLogKey, entry)
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		duration := time.Since(start)
+		metrics.ObserveRequest(r.Method, entry.route, sw.status, duration)
+
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", entry.route),
+			slog.Int("status", sw.status),
+			slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+			slog.Int("bytes", sw.bytes),
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", entry.userID))
+		}
+		logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// LogRoute is a mux middleware that records the template of the matched
+// route, such as "/api/v1/projects/{id}", for the access log and adds it to
+// the request logger. Templates are logged rather than paths, which may hold
+// tokens.
+func LogRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if entry, ok := r.Context().Value(accessLogKey).(*accessLog); ok {
+			entry.route = template
+		}
+		next.ServeHTTP(w, r.WithContext(logging.With(r.Context(), "route", template)))
+	})
+}
+
+// GetRequestIDFromContext returns the ID RequestLogger assigned to the
+// request, or "" outside of RequestLogger.
+func GetRequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// validRequestID accepts IDs of letters, digits, '-', '_' and '.', so that
+// clients cannot inject arbitrary text into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusWriter records the status code and size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
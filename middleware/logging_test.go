@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/gorilla/mux"
+)
+
+func TestRequestLogger(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(LogRoute)
+	router.HandleFunc("/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// stands in for AuthHandler
+		ctx := WithUserID(r.Context(), 7)
+		logging.FromContext(ctx).Info("handler")
+		w.WriteHeader(http.StatusTeapot)
+	}).Methods("GET")
+	handler := RequestLogger(router)
+
+	send := func(requestID string) (*httptest.ResponseRecorder, []map[string]any) {
+		var buf bytes.Buffer
+		req := httptest.NewRequest(http.MethodGet, "/projects/42?token=secret", nil)
+		req = req.WithContext(logging.WithLogger(req.Context(), logging.New(&buf, "json", "info", nil)))
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var lines []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var line map[string]any
+			if err := dec.Decode(&line); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, line)
+		}
+		return rr, lines
+	}
+
+	t.Run("should log every request", func(t *testing.T) {
+		rr, lines := send("")
+		requestID := rr.Header().Get(RequestIDHeader)
+		if requestID == "" {
+			t.Fatal("expected a request ID to be assigned")
+		}
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 log lines, got %d", len(lines))
+		}
+
+		handlerLine, access := lines[0], lines[1]
+		if handlerLine["request_id"] != requestID || handlerLine["user_id"] != float64(7) || handlerLine["route"] != "/projects/{id}" {
+			t.Errorf("unexpected handler log line %v", handlerLine)
+		}
+
+		if access["msg"] != "request" || access["request_id"] != requestID || access["method"] != "GET" {
+			t.Errorf("unexpected access log line %v", access)
+		}
+		if access["route"] != "/projects/{id}" || access["status"] != float64(http.StatusTeapot) || access["user_id"] != float64(7) {
+			t.Errorf("unexpected access log line %v", access)
+		}
+		if _, ok := access["duration_ms"]; !ok {
+			t.Error("expected the latency to be logged")
+		}
+	})
+
+	t.Run("should propagate the request ID", func(t *testing.T) {
+		rr, lines := send("abc-123")
+		if rr.Header().Get(RequestIDHeader) != "abc-123" {
+			t.Errorf("expected the request ID to be kept, got %q", rr.Header().Get(RequestIDHeader))
+		}
+		if lines[len(lines)-1]["request_id"] != "abc-123" {
+			t.Errorf("unexpected access log line %v", lines[len(lines)-1])
+		}
+	})
+
+	t.Run("should replace invalid request IDs", func(t *testing.T) {
+		rr, _ := send("abc\n{\"level\":\"ERROR\"}")
+		if id := rr.Header().Get(RequestIDHeader); id == "" || id == "abc\n{\"level\":\"ERROR\"}" {
+			t.Errorf("expected a new request ID, got %q", id)
+		}
+	})
+}
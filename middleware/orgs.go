@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+// OrgHeader selects the organization for routes that are not mounted under
+// /orgs/{org}. It holds the organization's ID or slug.
+const OrgHeader = "X-Organization"
+
+var (
+	errOrgRequired = errors.New("organization required")
+	errOrgNotFound = errors.New("organization not found")
+)
+
+// OrgHandler selects the organization the request acts in and requires the
+// authenticated user to hold role or a more privileged one in it. It must run
+// inside AuthHandler.
+//
+// The organization comes from the {org} route variable, else the
+// X-Organization header, else the user's only organization. Organizations
+// the user is not a member of are reported as not found so that their
+// existence is not leaked.
+func OrgHandler(role string, handlerFunc http.HandlerFunc, store repository.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := GetUserIDFromContext(r.Context())
+
+		orgID, err := resolveOrg(r, store, userID)
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, errOrgRequired) {
+				status = http.StatusBadRequest
+			} else if !errors.Is(err, errOrgNotFound) {
+				logging.FromContext(r.Context()).Error("OrgHandler: failed to resolve organization", "error", err)
+				status = http.StatusInternalServerError
+				err = errors.New("internal server error")
+			}
+			utils.WriteError(w, status, err.Error())
+			return
+		}
+
+		member, err := store.GetOrgMember(r.Context(), orgID, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				utils.WriteError(w, http.StatusNotFound, errOrgNotFound.Error())
+				return
+			}
+			logging.FromContext(r.Context()).Error("OrgHandler: failed to get member", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		if !HasOrgRole(member.Role, role) {
+			logging.FromContext(r.Context()).Info("OrgHandler: access denied", "user_id", userID, "required_role", role, "org_id", orgID)
+			utils.WriteError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+
+		ctx := WithOrgID(r.Context(), orgID)
+		ctx = WithOrgRole(ctx, member.Role)
+		handlerFunc(w, r.WithContext(ctx))
+	}
+}
+
+// HasOrgRole reports whether role is at least as privileged as required
+// within an organization.
+func HasOrgRole(role, required string) bool {
+	have := slices.Index(model.OrgRoles, role)
+	return have >= 0 && have >= slices.Index(model.OrgRoles, required)
+}
+
+func resolveOrg(r *http.Request, store repository.Store, userID int64) (int64, error) {
+	ref := mux.Vars(r)["org"]
+	if ref == "" {
+		ref = r.Header.Get(OrgHeader)
+	}
+
+	if ref == "" {
+		orgs, err := store.ListUserOrganizations(r.Context(), userID)
+		if err != nil {
+			return 0, err
+		}
+		if len(orgs) != 1 {
+			return 0, errOrgRequired
+		}
+		return orgs[0].ID, nil
+	}
+
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return id, nil
+	}
+
+	org, err := store.GetOrganizationBySlug(r.Context(), ref)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errOrgNotFound
+		}
+		return 0, err
+	}
+
+	return org.ID, nil
+}
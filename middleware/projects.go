@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+// orgProjectRoles is the role every member of an organization has on all of
+// its projects, by organization role. Direct and team grants can only add to
+// it. Guests have no role here, so only their grants give them access.
+var orgProjectRoles = map[string]string{
+	model.OrgRoleViewer: model.ProjectRoleViewer,
+	model.OrgRoleMember: model.ProjectRoleEditor,
+	model.OrgRoleAdmin:  model.ProjectRoleAdmin,
+	model.OrgRoleOwner:  model.ProjectRoleAdmin,
+}
+
+// ProjectHandler requires the authenticated user to hold role or a more
+// privileged one on the project named by the {id} route variable. It must run
+// inside OrgHandler.
+func ProjectHandler(role string, handlerFunc http.HandlerFunc, store repository.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := RequireProjectRole(r, store, mux.Vars(r)["id"], role)
+		if err != nil {
+			utils.WriteError(w, status, err.Error())
+			return
+		}
+
+		handlerFunc(w, r)
+	}
+}
+
+// RequireProjectRole checks that the authenticated user holds role on one of
+// the current organization's projects. It returns the status to respond with
+// when they don't.
+func RequireProjectRole(r *http.Request, store repository.Store, projectID string, role string) (int, error) {
+	orgID := GetOrgIDFromContext(r.Context())
+	userID := GetUserIDFromContext(r.Context())
+
+	project, err := store.GetProject(r.Context(), orgID, projectID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return http.StatusNotFound, errors.New("Project not found")
+		}
+		logging.FromContext(r.Context()).Error("RequireProjectRole: error loading project", "project_id", projectID, "error", err)
+		return http.StatusInternalServerError, errors.New("internal server error")
+	}
+
+	access, err := ProjectAccess(r.Context(), store, orgID, GetOrgRoleFromContext(r.Context()), project.ID, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("RequireProjectRole: error loading grants", "project_id", project.ID, "error", err)
+		return http.StatusInternalServerError, errors.New("internal server error")
+	}
+
+	if !HasProjectRole(access.Role, role) {
+		logging.FromContext(r.Context()).Info("RequireProjectRole: access denied", "user_id", userID, "required_role", role, "project_id", project.ID)
+		return http.StatusForbidden, errors.New("forbidden")
+	}
+
+	return 0, nil
+}
+
+// ProjectAccess computes a member's effective role on one of the
+// organization's projects: the most privileged of the role their
+// organization role implies and the roles granted to them directly or
+// through their teams.
+func ProjectAccess(ctx context.Context, store repository.Store, orgID int64, orgRole string, projectID, userID int64) (*model.ProjectAccess, error) {
+	access := &model.ProjectAccess{ProjectID: projectID, UserID: userID, Sources: []model.AccessSource{}}
+
+	if role, ok := orgProjectRoles[orgRole]; ok {
+		access.Role = role
+		access.Sources = append(access.Sources, model.AccessSource{Type: model.AccessSourceOrganization, Role: role})
+	}
+
+	grants, err := store.ListUserProjectGrants(ctx, orgID, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range grants {
+		source := model.AccessSource{Type: model.AccessSourceDirect, Role: g.Role}
+		if g.TeamID != nil {
+			source = model.AccessSource{Type: model.AccessSourceTeam, Role: g.Role, TeamID: g.TeamID, TeamName: g.TeamName}
+		}
+		access.Sources = append(access.Sources, source)
+
+		if !HasProjectRole(access.Role, g.Role) {
+			access.Role = g.Role
+		}
+	}
+
+	return access, nil
+}
+
+// HasProjectRole reports whether role is at least as privileged as required
+// on a project.
+func HasProjectRole(role, required string) bool {
+	have := slices.Index(model.ProjectRoles, role)
+	return have >= 0 && have >= slices.Index(model.ProjectRoles, required)
+}
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+// RateLimit lets Burst requests through at once and refills at Burst per
+// Window. The zero value means no limit.
+type RateLimit struct {
+	Burst  int
+	Window time.Duration
+}
+
+// RateLimitResult is the state of a bucket after a request was counted.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again, RetryAfter how long
+	// until the next request is allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the token buckets. Take refills the bucket for key,
+// then takes cost tokens from it if at least one is left. A cost of zero
+// only reports whether a request would be allowed, and a negative cost
+// gives tokens back, up to the burst.
+type RateLimitStore interface {
+	Take(key string, limit RateLimit, cost int, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimiter throttles requests with a token bucket per client and route.
+// Authenticated requests are counted against the user AuthHandler resolved,
+// anonymous ones against the client IP.
+type RateLimiter struct {
+	store        RateLimitStore
+	defaultLimit RateLimit
+	routes       map[string]RateLimit
+}
+
+// NewRateLimiter parses the default limit, such as "300/m", and the route
+// limits, given as "METHOD /path/template=limit" or "/path/template=limit".
+// A default limit of "off" only limits the listed routes.
+func NewRateLimiter(store RateLimitStore, defaultLimit string, routes []string) (*RateLimiter, error) {
+	l := &RateLimiter{store: store, routes: map[string]RateLimit{}}
+
+	if defaultLimit != "off" {
+		limit, err := ParseRateLimit(defaultLimit)
+		if err != nil {
+			return nil, err
+		}
+		l.defaultLimit = limit
+	}
+
+	for _, route := range routes {
+		i := strings.LastIndexByte(route, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("ratelimit: route limit %q must look like \"POST /api/v1/users/login=10/m\"", route)
+		}
+
+		limit, err := ParseRateLimit(route[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		l.routes[strings.Join(strings.Fields(route[:i]), " ")] = limit
+	}
+
+	return l, nil
+}
+
+// ParseRateLimit parses limits such as "10/s", "300/m" or "1000/h".
+func ParseRateLimit(s string) (RateLimit, error) {
+	count, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("ratelimit: invalid limit %q, use a count per s, m or h such as \"300/m\"", s)
+	}
+
+	windows := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	window, ok := windows[unit]
+	if !ok {
+		return RateLimit{}, fmt.Errorf("ratelimit: invalid limit %q, use a count per s, m or h such as \"300/m\"", s)
+	}
+
+	return RateLimit{Burst: n, Window: window}, nil
+}
+
+// Middleware is a mux middleware, so the route template is known when the
+// limit is picked. Every request is counted against the client IP up front,
+// so that concurrent requests cannot all pass before any is counted. For
+// requests with credentials that token is only reserved: AuthHandler gives
+// it back once it knows who the user is and counts the request against
+// them instead. Requests no AuthHandler authenticates, because the route is
+// public or the credentials are bogus, stay counted against the IP.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := l.scope(r)
+		if scope == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ipKey := "ip:" + ClientIP(r)
+		if !scope.take(w, r, ipKey, 1) {
+			return
+		}
+
+		if hasCredentials(r) {
+			scope.reserved = ipKey
+			r = r.WithContext(context.WithValue(r.Context(), rateLimitKey, scope))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scope returns the limit that applies to the matched route, or nil if the
+// route is not limited.
+func (l *RateLimiter) scope(r *http.Request) *rateLimitScope {
+	route := "*"
+	limit := l.defaultLimit
+
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			if routeLimit, ok := l.routes[r.Method+" "+template]; ok {
+				route, limit = r.Method+" "+template, routeLimit
+			} else if routeLimit, ok := l.routes[template]; ok {
+				route, limit = template, routeLimit
+			}
+		}
+	}
+
+	if limit.Burst == 0 {
+		return nil
+	}
+
+	return &rateLimitScope{limiter: l, route: route, limit: limit}
+}
+
+// rateLimitScope is handed to AuthHandler through the request context.
+// reserved is the client holding the token taken up front, until it is
+// given back.
+type rateLimitScope struct {
+	limiter  *RateLimiter
+	route    string
+	limit    RateLimit
+	reserved string
+}
+
+// bucket keys the bucket by client and route. Routes without a limit of
+// their own share one bucket per client.
+func (s *rateLimitScope) bucket(client string) string {
+	return client + " " + s.route
+}
+
+// take counts the request against client and sets the RateLimit headers.
+// When the request is refused it writes the 429 response and returns false.
+// Errors of the store let the request through.
+func (s *rateLimitScope) take(w http.ResponseWriter, r *http.Request, client string, cost int) bool {
+	result, err := s.limiter.store.Take(s.bucket(client), s.limit, cost, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("RateLimiter: error counting request", "error", err)
+		return true
+	}
+	if cost > 0 || !result.Allowed {
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", s.limit.Burst, int(s.limit.Window.Seconds())))
+		h.Set("RateLimit-Limit", strconv.Itoa(s.limit.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	}
+
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		utils.WriteError(w, http.StatusTooManyRequests, "too many requests, try again later")
+		return false
+	}
+
+	return true
+}
+
+// allowUser counts an authenticated request against the user, giving back
+// the token reserved against the client IP. It is a no-op outside
+// RateLimiter.Middleware and for requests that were already counted.
+func allowUser(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	scope, _ := r.Context().Value(rateLimitKey).(*rateLimitScope)
+	if scope == nil || scope.reserved == "" {
+		return true
+	}
+
+	if _, err := scope.limiter.store.Take(scope.bucket(scope.reserved), scope.limit, -1, time.Now()); err != nil {
+		logging.FromContext(r.Context()).Error("RateLimiter: error returning reserved token", "error", err)
+	}
+	scope.reserved = ""
+
+	return scope.take(w, r, "user:"+strconv.FormatInt(userID, 10), 1)
+}
+
+func hasCredentials(r *http.Request) bool {
+	if GetToken(r) != "" {
+		return true
+	}
+
+	_, err := r.Cookie(SessionCookie)
+	return err == nil
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// memoryRateLimitSweep is how often full buckets are dropped.
+const memoryRateLimitSweep = time.Minute
+
+// MemoryRateLimitStore keeps token buckets in process memory. Each instance
+// of the API counts on its own, so behind a load balancer the effective
+// limit is multiplied by the number of instances.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   RateLimit
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit, cost int, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	allowed := b.tokens >= 1 || cost < 0
+	if allowed {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens-float64(cost))
+	}
+
+	perToken := limit.Window / time.Duration(limit.Burst)
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(b.tokens))),
+		Reset:     time.Duration((float64(limit.Burst) - b.tokens) * float64(perToken)),
+	}
+	if b.tokens < 1 {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+
+	return result, nil
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*float64(b.limit.Burst)/b.limit.Window.Seconds())
+	b.updated = now
+}
+
+// sweep drops buckets that have refilled completely, as they are no
+// different from a new bucket. It keeps memory bounded by the clients seen
+// within one window.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryRateLimitSweep {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("300/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit.Burst != 300 || limit.Window != time.Minute {
+		t.Errorf("unexpected limit %+v", limit)
+	}
+
+	for _, s := range []string{"", "300", "0/m", "ten/m", "10/d"} {
+		if _, err := ParseRateLimit(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Burst: 2, Window: time.Minute}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if result, _ := store.Take("key", limit, 1, now); !result.Allowed {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	result, _ := store.Take("key", limit, 1, now)
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("expected the bucket to be empty, got %+v", result)
+	}
+	if result.RetryAfter != 30*time.Second {
+		t.Errorf("expected to retry after 30s, got %s", result.RetryAfter)
+	}
+
+	if result, _ := store.Take("key", limit, 1, now.Add(30*time.Second)); !result.Allowed {
+		t.Error("expected the bucket to refill")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter, err := NewRateLimiter(NewMemoryRateLimitStore(), "2/m", []string{"POST /login=1/m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(limiter.Middleware)
+	router.HandleFunc("/public", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	router.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+	// stands in for AuthHandler, with the user ID taken from the header
+	router.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		userID := map[string]int64{"Bearer joe": 7, "Bearer ann": 8}[r.Header.Get("Authorization")]
+		allowUser(w, r, userID)
+	}).Methods("GET")
+
+	send := func(method, path, ip, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should limit anonymous requests per IP", func(t *testing.T) {
+		send(http.MethodGet, "/public", "10.0.0.1", "")
+		rr := send(http.MethodGet, "/public", "10.0.0.1", "")
+		if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != "0" || rr.Header().Get("RateLimit-Limit") != "2" {
+			t.Fatalf("unexpected response %d %v", rr.Code, rr.Header())
+		}
+
+		rr = send(http.MethodGet, "/public", "10.0.0.1", "")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr.Header().Get("Retry-After") != "30" {
+			t.Errorf("expected to retry after 30 seconds, got %q", rr.Header().Get("Retry-After"))
+		}
+
+		if rr := send(http.MethodGet, "/public", "10.0.0.2", ""); rr.Code != http.StatusOK {
+			t.Errorf("expected other clients to be unaffected, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should apply route limits", func(t *testing.T) {
+		if rr := send(http.MethodPost, "/login", "10.0.0.3", ""); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if rr := send(http.MethodPost, "/login", "10.0.0.3", ""); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr := send(http.MethodGet, "/public", "10.0.0.3", ""); rr.Code != http.StatusOK {
+			t.Errorf("expected other routes to keep their own bucket, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should limit authenticated requests per user", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if rr := send(http.MethodGet, "/private", "10.0.0.4", "Bearer joe"); rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+		}
+		if rr := send(http.MethodGet, "/private", "10.0.0.4", "Bearer joe"); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr := send(http.MethodGet, "/private", "10.0.0.4", "Bearer ann"); rr.Code != http.StatusOK {
+			t.Errorf("expected users behind the same IP to be counted apart, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should count credentials no handler checked against the IP", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			send(http.MethodGet, "/public", "10.0.0.5", "Bearer forged")
+		}
+		if rr := send(http.MethodGet, "/public", "10.0.0.5", "Bearer forged"); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+	})
+}
+
+func TestRateLimiterConcurrentCredentials(t *testing.T) {
+	limiter, err := NewRateLimiter(NewMemoryRateLimitStore(), "off", []string{"POST /login=1/m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the handler holds every request it lets through until the others are
+	// answered, so none is finished before the rest are checked
+	var inside atomic.Int32
+	release := make(chan struct{})
+	router := mux.NewRouter()
+	router.Use(limiter.Middleware)
+	router.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		inside.Add(1)
+		<-release
+	}).Methods("POST")
+
+	const n = 5
+	codes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/login", nil)
+			req.RemoteAddr = "10.0.0.9:1234"
+			req.Header.Set("Authorization", "Bearer x")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			codes <- rr.Code
+		}()
+	}
+
+	var got []int
+	for len(got)+int(inside.Load()) < n {
+		select {
+		case code := <-codes:
+			got = append(got, code)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(release)
+	for len(got) < n {
+		got = append(got, <-codes)
+	}
+
+	allowed := 0
+	for _, code := range got {
+		if code == http.StatusOK {
+			allowed++
+		}
+	}
+	if allowed != 1 {
+		t.Errorf("expected 1 of %d concurrent requests with bogus credentials to pass, got %d (%v)", n, allowed, got)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// sessionTouchInterval limits how often last-seen timestamps are written.
+const sessionTouchInterval = time.Minute
+
+// authenticateSession checks that the session behind a JWT belongs to the
+// user and has been neither revoked nor expired, and records the activity.
+func authenticateSession(store repository.Store, sessionID string, userID int64, r *http.Request) (*model.Session, error) {
+	if sessionID == "" {
+		return nil, errors.New("token has no session")
+	}
+
+	session, err := store.GetSession(r.Context(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if session.UserID != userID {
+		return nil, errors.New("session belongs to another user")
+	}
+	if session.RevokedAt != nil {
+		return nil, errors.New("session has been revoked")
+	}
+	if !session.ExpiresAt.After(now) {
+		return nil, errors.New("session has expired")
+	}
+
+	ip := ClientIP(r)
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval || ip != session.IP {
+		if err := store.TouchSession(r.Context(), session.ID, now, ip); err != nil {
+			logging.FromContext(r.Context()).Error("authenticateSession: error updating last seen time", "error", err)
+		}
+	}
+
+	return session, nil
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+)
+
+var errInvalidShareToken = errors.New("invalid share link token")
+
+// SignShareToken returns the token of a share link: the link ID and a random
+// secret, signed with config.Envs.ShareLinkSecret so that forged tokens are
+// rejected before the database is queried.
+func SignShareToken(id int64, secret string) string {
+	payload := strconv.FormatInt(id, 10) + "." + secret
+	return payload + "." + shareTokenSignature(payload)
+}
+
+// ParseShareToken verifies a share link token and returns the link ID and
+// random secret it carries.
+func ParseShareToken(token string) (id int64, secret string, err error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return 0, "", errInvalidShareToken
+	}
+
+	payload, signature := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(shareTokenSignature(payload))) {
+		return 0, "", errInvalidShareToken
+	}
+
+	rawID, secret, ok := strings.Cut(payload, ".")
+	if !ok || secret == "" {
+		return 0, "", errInvalidShareToken
+	}
+
+	id, err = strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return 0, "", errInvalidShareToken
+	}
+
+	return id, secret, nil
+}
+
+func shareTokenSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.Envs.ShareLinkSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors for SHA1, truncated to six digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should accept the current code", func(t *testing.T) {
+		if step, ok := ValidateTOTP(secret, code, now); !ok || step != now.Unix()/totpPeriod {
+			t.Errorf("expected code to be valid for the current step, got step %d ok %v", step, ok)
+		}
+	})
+
+	t.Run("should tolerate one step of clock drift", func(t *testing.T) {
+		if _, ok := ValidateTOTP(secret, code, now.Add(totpPeriod*time.Second)); !ok {
+			t.Error("expected code from the previous step to be accepted")
+		}
+	})
+
+	t.Run("should reject stale codes", func(t *testing.T) {
+		if _, ok := ValidateTOTP(secret, code, now.Add(5*time.Minute)); ok {
+			t.Error("expected code to be rejected")
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/DaffaJatmiko/go-rest-project-manager/middleware")
+
+// Trace serves every request in a server span, continuing the trace of the
+// caller when the request carries a traceparent header. Like RequestLogger,
+// it must wrap the whole router; it goes outside RequestLogger so that log
+// lines carry the trace ID.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.UserAgentOriginal(r.UserAgent()),
+		))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// TraceRoute is a mux middleware that names the server span after the
+// matched route, such as "GET /api/v1/projects/{id}", and serves the route
+// in a "handler" span holding the entity IDs of the path. Paths are not
+// recorded, as they may hold tokens.
+func TraceRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		server := trace.SpanFromContext(r.Context())
+		server.SetName(r.Method + " " + template)
+		server.SetAttributes(semconv.HTTPRoute(template))
+
+		var attrs []attribute.KeyValue
+		for name, value := range mux.Vars(r) {
+			if isEntityID(name) {
+				attrs = append(attrs, attribute.String("app.route."+name, value))
+			}
+		}
+
+		ctx, span := tracer.Start(r.Context(), "handler", trace.WithAttributes(attrs...))
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isEntityID tells the route variables holding IDs, such as "id", "userID"
+// and the organization "org", from those holding tokens or email addresses.
+func isEntityID(name string) bool {
+	return name == "id" || name == "org" || strings.HasSuffix(name, "ID")
+}
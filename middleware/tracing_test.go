@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type sessionStore struct {
+	repository.MockStore
+}
+
+func (s *sessionStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	return &model.User{ID: 7, Role: model.RoleUser}, nil
+}
+
+func (s *sessionStore) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	return &model.Session{ID: id, UserID: 7, ExpiresAt: time.Now().Add(time.Hour), LastSeenAt: time.Now(), IP: "192.0.2.1"}, nil
+}
+
+func TestTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var handlerSpan trace.SpanContext
+	router := mux.NewRouter()
+	router.Use(LogRoute, TraceRoute)
+	router.HandleFunc("/projects/{id}/links/{token}", AuthHandler(func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}, &sessionStore{})).Methods("GET")
+
+	token, err := CreateJWT(7, "s1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	req := httptest.NewRequest(http.MethodGet, "/projects/42/links/share-secret", nil)
+	req = req.WithContext(logging.WithLogger(req.Context(), logging.New(&logs, "json", "info", nil)))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	rr := httptest.NewRecorder()
+	Trace(RequestLogger(router)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+		if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected %s to continue the trace of the caller", span.Name)
+		}
+	}
+
+	server, ok := spans["GET /projects/{id}/links/{token}"]
+	if !ok {
+		t.Fatalf("expected the server span to be named after the route, got %v", spans)
+	}
+	if server.Parent.SpanID().String() != "00f067aa0ba902b7" || server.SpanKind != trace.SpanKindServer {
+		t.Error("expected the server span to be a child of the caller's span")
+	}
+	assertAttribute(t, server.Attributes, "http.route", "/projects/{id}/links/{token}")
+	assertAttribute(t, server.Attributes, "http.response.status_code", "204")
+
+	handler := spans["handler"]
+	if handler.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("expected the handler span to be a child of the server span")
+	}
+	if handlerSpan.SpanID() != handler.SpanContext.SpanID() {
+		t.Error("expected the handler to run in the handler span, not the AuthHandler span")
+	}
+	assertAttribute(t, handler.Attributes, "app.route.id", "42")
+	for _, attr := range handler.Attributes {
+		if strings.Contains(attr.Value.Emit(), "share-secret") {
+			t.Errorf("expected tokens in the path not to be recorded, got %s", attr.Key)
+		}
+	}
+
+	auth := spans["AuthHandler"]
+	if auth.Parent.SpanID() != handler.SpanContext.SpanID() {
+		t.Error("expected the AuthHandler span to be a child of the handler span")
+	}
+	assertAttribute(t, auth.Attributes, "enduser.id", "7")
+
+	if !strings.Contains(logs.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Errorf("expected the trace ID in the logs, got %s", logs.String())
+	}
+}
+
+func assertAttribute(t *testing.T, attrs []attribute.KeyValue, key, value string) {
+	t.Helper()
+
+	for _, attr := range attrs {
+		if string(attr.Key) == key {
+			if attr.Value.Emit() != value {
+				t.Errorf("expected %s to be %q, got %q", key, value, attr.Value.Emit())
+			}
+			return
+		}
+	}
+	t.Errorf("expected attribute %s", key)
+}
@@ -1,35 +1,211 @@
 package model
 
-import "time"
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// Problem is an error response in the RFC 7807 problem details format,
+// served as application/problem+json. Code identifies the kind of error and
+// is stable, so clients can branch on it; Detail is written for people and
+// may change. Errors lists the invalid fields of the request, if any.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Code   string       `json:"code"`
+	Detail string       `json:"detail,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
+// FieldError is an invalid field of a request body or query. Field is the
+// JSON name of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error lets a FieldError be returned by validation functions.
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// FieldErrors are all the invalid fields of a request.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Field error codes.
+const (
+	FieldRequired   = "required"
+	FieldInvalid    = "invalid"
+	FieldTooShort   = "too_short"
+	FieldTooLong    = "too_long"
+	FieldOutOfRange = "out_of_range"
+	FieldUnknown    = "unknown"
+)
+
+// Problem codes. Each HTTP status has a default code; the others name
+// errors clients may want to handle on their own.
+const (
+	ProblemBadRequest           = "bad_request"
+	ProblemInvalidJSON          = "invalid_json"
+	ProblemValidationFailed     = "validation_failed"
+	ProblemUnauthorized         = "unauthorized"
+	ProblemForbidden            = "forbidden"
+	ProblemCSRFFailed           = "csrf_failed"
+	ProblemNotFound             = "not_found"
+	ProblemMethodNotAllowed     = "method_not_allowed"
+	ProblemConflict             = "conflict"
+	ProblemAlreadyExists        = "already_exists"
+	ProblemGone                 = "gone"
+	ProblemPreconditionFailed   = "precondition_failed"
+	ProblemPreconditionRequired = "precondition_required"
+	ProblemPayloadTooLarge      = "payload_too_large"
+	ProblemUnsupportedMediaType = "unsupported_media_type"
+	ProblemRateLimited          = "rate_limited"
+	ProblemInternalError        = "internal_error"
+	ProblemBadGateway           = "bad_gateway"
+	ProblemUnavailable          = "unavailable"
+)
+
+// Task statuses, as allowed by the tasks.status column.
+const (
+	TaskStatusTodo       = "TODO"
+	TaskStatusInProgress = "IN_PROGRESS"
+	TaskStatusInTesting  = "IN_TESTING"
+	TaskStatusDone       = "DONE"
+)
+
+var TaskStatuses = []string{TaskStatusTodo, TaskStatusInProgress, TaskStatusInTesting, TaskStatusDone}
+
+// Task is a task of a project. Version counts the changes to the task and
+// is its ETag; it is ignored in request bodies.
 type Task struct {
 	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	Status       string    `json:"status"`
-	ProjectID    int64     `json:"projectID"`
-	AssignedToID int64     `json:"assignedTo"`
+	Name         string    `json:"name" validate:"required,max=255"`
+	Status       string    `json:"status" validate:"enum=taskstatus"`
+	ProjectID    int64     `json:"projectID" validate:"required"`
+	AssignedToID int64     `json:"assignedTo" validate:"required"`
+	Version      int64     `json:"version"`
 	CreatedAt    time.Time `json:"createdAt"`
 }
 
 type User struct {
-	ID        int64     `json:"id"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID        int64  `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Password  string `json:"password,omitempty"`
+	Verified  bool   `json:"verified"`
+	// PendingEmail is the new address of an email change awaiting
+	// confirmation.
+	PendingEmail    string     `json:"pendingEmail,omitempty"`
+	Timezone        string     `json:"timezone"`
+	Locale          string     `json:"locale"`
+	AvatarURL       string     `json:"avatarURL,omitempty"`
+	AvatarUpdatedAt *time.Time `json:"-"`
+	Role            string     `json:"role"`
+	// DeactivatedAt is set while an administrator has disabled the account.
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+	// PasswordResetRequired blocks password logins until the user resets
+	// their password through the emailed link.
+	PasswordResetRequired bool      `json:"passwordResetRequired,omitempty"`
+	CreatedAt             time.Time `json:"createdAt"`
+}
+
+// LogValue keeps the password hash and personal data of a user out of the
+// logs, should a whole user ever be logged.
+func (u User) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int64("id", u.ID), slog.String("role", u.Role))
+}
+
+// Global roles, from least to most privileged. Guests can only read, users
+// can also write, and admins can manage other accounts.
+const (
+	RoleGuest = "guest"
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles lists every global role, from least to most privileged.
+var Roles = []string{RoleGuest, RoleUser, RoleAdmin}
+
+// UserFilter narrows down the users listed by administrators.
+type UserFilter struct {
+	// Query matches the start of the email, first name or last name.
+	Query       string
+	Role        string
+	Deactivated *bool
+	Limit       int
+	Offset      int
+}
+
+// SetRolePayload changes the global role of a user.
+type SetRolePayload struct {
+	Role string `json:"role" validate:"required,enum=role"`
+}
+
+const (
+	AuditRoleChanged          = "role_changed"
+	AuditUserDeactivated      = "user_deactivated"
+	AuditUserReactivated      = "user_reactivated"
+	AuditPasswordResetForced  = "password_reset_forced"
+	AuditImpersonationStarted = "impersonation_started"
+)
+
+// AuditEvent records an administrative action. ActorID is nil for actions
+// taken by the server itself, such as bootstrapping the first admin.
+type AuditEvent struct {
+	ID           int64     `json:"id"`
+	ActorID      *int64    `json:"actorID"`
+	Action       string    `json:"action"`
+	TargetUserID int64     `json:"targetUserID"`
+	Detail       string    `json:"detail"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
 
+// ImpersonationToken is returned to an administrator who starts a support
+// session as another user.
+type ImpersonationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Project groups the tasks of an organization. Version counts the changes to
+// the project and is its ETag; it is ignored in request bodies.
 type Project struct {
-	ID 				int64 `json:"id"`
-	Name 			string `json:"name"`
+	ID        int64     `json:"id"`
+	OrgID     int64     `json:"orgID"`
+	Name      string    `json:"name" validate:"required,max=255"`
+	Version   int64     `json:"version"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+// TaskPatch is a JSON merge patch of a task. Fields left out of the patch
+// are nil and keep their value.
+type TaskPatch struct {
+	Name         *string `json:"name" validate:"required,max=255"`
+	Status       *string `json:"status" validate:"required,enum=taskstatus"`
+	ProjectID    *int64  `json:"projectID" validate:"required"`
+	AssignedToID *int64  `json:"assignedTo" validate:"required"`
+}
+
+// ProjectPatch is a JSON merge patch of a project. Fields left out of the
+// patch are nil and keep their value.
+type ProjectPatch struct {
+	Name *string `json:"name" validate:"required,max=255"`
+}
+
 type CreateTaskPayload struct {
 	Name         string `json:"name"`
 	ProjectID    int64  `json:"projectID"`
@@ -37,13 +213,430 @@ type CreateTaskPayload struct {
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
+	Email    string `json:"email" validate:"required"`
 	Password string `json:"password"`
 }
 
 type RegisterPayload struct {
-	Email     string `json:"email"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
-	Password  string `json:"password"`
-}
\ No newline at end of file
+	Email     string `json:"email" validate:"required,email,max=255"`
+	FirstName string `json:"firstName" validate:"required,max=255"`
+	LastName  string `json:"lastName" validate:"required,max=255"`
+	Password  string `json:"password" validate:"required,max=72"`
+}
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailChange       = "email_change"
+)
+
+// UserToken is a single-use token emailed to a user. Only the SHA-256 hash
+// of the token is stored.
+type UserToken struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"userID"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type VerifyEmailPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// UserTOTP holds a user's TOTP secret. The secret is pending until the user
+// confirms enrollment with a valid code.
+type UserTOTP struct {
+	UserID       int64     `json:"userID"`
+	Secret       string    `json:"-"`
+	Enabled      bool      `json:"enabled"`
+	LastUsedStep int64     `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthURI"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type TwoFactorLoginPayload struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+const (
+	LoginScopeAccount   = "account"
+	LoginScopeIP        = "ip"
+	LoginScopeShareLink = "share_link"
+)
+
+// LoginThrottle tracks recent failed logins for an account (keyed by email)
+// or a client IP, and wrong passwords for a share link (keyed by its ID).
+type LoginThrottle struct {
+	Scope         string     `json:"scope"`
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+}
+
+const (
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+)
+
+// AccessTokenScopes lists every scope a personal access token can be granted.
+var AccessTokenScopes = []string{ScopeProjectsRead, ScopeProjectsWrite, ScopeTasksRead, ScopeTasksWrite}
+
+// AccessToken is a personal access token used by scripts instead of a
+// password login. Only the SHA-256 hash of the token is stored.
+type AccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"userID"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type CreateAccessTokenPayload struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,enum=scope"`
+	ExpiresInDays int      `json:"expiresInDays" validate:"min=1,max=365"`
+}
+
+// CreatedAccessToken is returned once, when the token is created. The raw
+// token cannot be retrieved afterwards.
+type CreatedAccessToken struct {
+	AccessToken
+	Token string `json:"token"`
+}
+
+// UserIdentity links a user to an account at an external OpenID provider.
+type UserIdentity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"userID"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Session is a login on one device. Session JWTs carry the session ID in
+// their "sid" claim, so revoking the session invalidates the token.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"userID"`
+	Device     string     `json:"device"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"userAgent"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	RevokedAt  *time.Time `json:"-"`
+	// ImpersonatorID is the administrator acting as the user, for support
+	// sessions started through impersonation.
+	ImpersonatorID *int64    `json:"impersonatorID,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// UpdateProfilePayload holds the profile fields to change. Fields left out
+// of the request are not modified.
+type UpdateProfilePayload struct {
+	FirstName *string `json:"firstName" validate:"required,max=255"`
+	LastName  *string `json:"lastName" validate:"required,max=255"`
+	Timezone  *string `json:"timezone" validate:"required,timezone"`
+	Locale    *string `json:"locale" validate:"required,locale,max=35"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,max=72"`
+}
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type UserAvatar struct {
+	UserID      int64
+	ContentType string
+	Data        []byte
+	UpdatedAt   time.Time
+}
+
+// Organization roles, from least to most privileged. Guests only see the
+// projects they have been granted, viewers can read every project, members
+// can also write, admins manage members and invitations, and owners can
+// delete the organization.
+const (
+	OrgRoleGuest  = "guest"
+	OrgRoleViewer = "viewer"
+	OrgRoleMember = "member"
+	OrgRoleAdmin  = "admin"
+	OrgRoleOwner  = "owner"
+)
+
+// OrgRoles lists every organization role, from least to most privileged.
+var OrgRoles = []string{OrgRoleGuest, OrgRoleViewer, OrgRoleMember, OrgRoleAdmin, OrgRoleOwner}
+
+// Organization owns projects and the users working on them. Data never
+// crosses organizations.
+type Organization struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Role is the requesting user's role, when listing their organizations.
+	Role string `json:"role,omitempty"`
+}
+
+type CreateOrganizationPayload struct {
+	Name string `json:"name" validate:"required,max=255"`
+	Slug string `json:"slug" validate:"slug"`
+}
+
+type OrgMember struct {
+	OrgID     int64     `json:"orgID"`
+	UserID    int64     `json:"userID"`
+	Role      string    `json:"role"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OrgInvitation invites an email address to join an organization. Only the
+// SHA-256 hash of the emailed token is stored.
+type OrgInvitation struct {
+	ID          int64      `json:"id"`
+	OrgID       int64      `json:"orgID"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	TokenHash   string     `json:"-"`
+	InvitedByID int64      `json:"invitedByID"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	AcceptedAt  *time.Time `json:"acceptedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+type CreateOrgInvitationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"enum=orgrole"`
+}
+
+// SetMemberRolePayload changes the role of an organization member.
+type SetMemberRolePayload struct {
+	Role string `json:"role" validate:"required,enum=orgrole"`
+}
+
+type AcceptOrgInvitationPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// Project roles, from least to most privileged. Viewers can read a project
+// and its tasks, editors can also change them, and admins manage who has
+// access to the project.
+const (
+	ProjectRoleViewer = "viewer"
+	ProjectRoleEditor = "editor"
+	ProjectRoleAdmin  = "admin"
+)
+
+// ProjectRoles lists every project role, from least to most privileged.
+var ProjectRoles = []string{ProjectRoleViewer, ProjectRoleEditor, ProjectRoleAdmin}
+
+// Team groups members of an organization so that they can be granted access
+// to projects together.
+type Team struct {
+	ID        int64       `json:"id"`
+	OrgID     int64       `json:"orgID"`
+	Name      string      `json:"name"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Members   []OrgMember `json:"members,omitempty"`
+}
+
+type CreateTeamPayload struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type AddTeamMemberPayload struct {
+	UserID int64 `json:"userID" validate:"required"`
+}
+
+// ProjectGrant gives a user or a team a role on a project. Exactly one of
+// UserID and TeamID is set.
+type ProjectGrant struct {
+	ProjectID int64     `json:"projectID"`
+	UserID    *int64    `json:"userID,omitempty"`
+	TeamID    *int64    `json:"teamID,omitempty"`
+	TeamName  string    `json:"teamName,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SetProjectGrantPayload struct {
+	Role string `json:"role" validate:"required,enum=projectrole"`
+}
+
+// Where a user's access to a project comes from.
+const (
+	AccessSourceOrganization = "organization"
+	AccessSourceDirect       = "direct"
+	AccessSourceTeam         = "team"
+)
+
+// AccessSource is one of the grants that make up a user's access to a
+// project.
+type AccessSource struct {
+	Type     string `json:"type"`
+	Role     string `json:"role"`
+	TeamID   *int64 `json:"teamID,omitempty"`
+	TeamName string `json:"teamName,omitempty"`
+}
+
+// ProjectAccess is a user's effective role on a project: the most privileged
+// role among all of its sources.
+type ProjectAccess struct {
+	ProjectID int64          `json:"projectID"`
+	UserID    int64          `json:"userID"`
+	Role      string         `json:"role"`
+	Sources   []AccessSource `json:"sources"`
+}
+
+// ProjectInvitation invites an email address, with or without an account, to
+// a project. Accepting it makes the user a viewer of the project's
+// organization and grants them Role on the project. Only the SHA-256 hash of
+// the emailed token is stored.
+type ProjectInvitation struct {
+	ID          int64      `json:"id"`
+	OrgID       int64      `json:"orgID"`
+	ProjectID   int64      `json:"projectID"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	TokenHash   string     `json:"-"`
+	InvitedByID int64      `json:"invitedByID"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	AcceptedAt  *time.Time `json:"acceptedAt,omitempty"`
+	DeclinedAt  *time.Time `json:"declinedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+type CreateProjectInvitationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"enum=projectrole"`
+}
+
+type ProjectInvitationTokenPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// AcceptProjectInvitationSignupPayload creates an account for the invited
+// email address and accepts the invitation with it.
+type AcceptProjectInvitationSignupPayload struct {
+	Token     string `json:"token" validate:"required"`
+	FirstName string `json:"firstName" validate:"required,max=255"`
+	LastName  string `json:"lastName" validate:"required,max=255"`
+	Password  string `json:"password" validate:"required,max=72"`
+}
+
+// ShareLink gives anyone holding its token read-only access to a project
+// without an account. Only the SHA-256 hash of the token's random part and
+// the bcrypt hash of the optional password are stored.
+type ShareLink struct {
+	ID           int64      `json:"id"`
+	OrgID        int64      `json:"orgID"`
+	ProjectID    int64      `json:"projectID"`
+	TokenHash    string     `json:"-"`
+	PasswordHash string     `json:"-"`
+	HasPassword  bool       `json:"hasPassword"`
+	CreatedByID  int64      `json:"createdByID"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// CreateShareLinkPayload creates a share link. A link without expiresInDays
+// does not expire, and one without a password is open to anyone holding it.
+type CreateShareLinkPayload struct {
+	ExpiresInDays int    `json:"expiresInDays" validate:"min=0,max=365"`
+	Password      string `json:"password" validate:"max=72"`
+}
+
+// CreatedShareLink is returned once, when the link is created. The token
+// cannot be retrieved afterwards.
+type CreatedShareLink struct {
+	ShareLink
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// SharedProject is the read-only view of a project served to share links.
+type SharedProject struct {
+	Name      string       `json:"name"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Tasks     []SharedTask `json:"tasks"`
+}
+
+// SharedTask is a task as seen through a share link. The assignee is only
+// named, their email address and user ID are left out.
+type SharedTask struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Assignee  string    `json:"assignee"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Stats are the totals exposed as business metrics. Deleted users are not
+// counted.
+type Stats struct {
+	Users         int64
+	Organizations int64
+	Projects      int64
+	TasksByStatus map[string]int64
+}
+
+// HealthStatus is served by the liveness and readiness probes. Checks holds
+// "ok" or "failing" for each readiness check.
+type HealthStatus struct {
+	Status  string            `json:"status"`
+	Version string            `json:"version,omitempty"`
+	Commit  string            `json:"commit,omitempty"`
+	Checks  map[string]string `json:"checks,omitempty"`
+}
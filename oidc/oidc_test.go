@@ -0,0 +1,104 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/oidc"
+	"github.com/DaffaJatmiko/go-rest-project-manager/oidc/oidctest"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	idp, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	provider := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: idp.ClientID}, idp.Client())
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.Issuer(),
+			"aud":   idp.ClientID,
+			"sub":   "user-123",
+			"nonce": "n-0S6_WzA2Mj",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	t.Run("should accept a valid token", func(t *testing.T) {
+		raw, err := idp.SignIDToken(valid())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := provider.VerifyIDToken(raw, "n-0S6_WzA2Mj")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Subject != "user-123" || claims.Issuer != idp.Issuer() {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+	}{
+		{"should reject another audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{"should reject another issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"should reject a nonce mismatch", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"should reject an expired token", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"should reject a token without expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.mutate(claims)
+
+			raw, err := idp.SignIDToken(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := provider.VerifyIDToken(raw, "n-0S6_WzA2Mj"); err == nil {
+				t.Error("expected token to be rejected")
+			}
+		})
+	}
+
+	t.Run("should reject a token signed by another key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, valid())
+		token.Header["kid"] = idp.KeyID
+		raw, err := token.SignedString(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := provider.VerifyIDToken(raw, "n-0S6_WzA2Mj"); err == nil {
+			t.Error("expected token to be rejected")
+		}
+	})
+
+	t.Run("should reject symmetric algorithms", func(t *testing.T) {
+		raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte(idp.ClientSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := provider.VerifyIDToken(raw, "n-0S6_WzA2Mj"); err == nil {
+			t.Error("expected token to be rejected")
+		}
+	})
+}
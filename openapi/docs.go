@@ -0,0 +1,9 @@
+package openapi
+
+import _ "embed"
+
+// DocsPage is a self-contained HTML page that renders the document served
+// next to it as openapi.json. It loads nothing from other origins.
+//
+//go:embed docs.html
+var DocsPage []byte
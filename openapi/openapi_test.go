@@ -0,0 +1,46 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func TestSchemas(t *testing.T) {
+	schemas := Schemas{}
+
+	if got := schemas.For(model.Task{}); got.Ref != "#/components/schemas/Task" {
+		t.Fatalf("expected a reference to Task, got %+v", got)
+	}
+
+	task := schemas["Task"]
+	if want := []string{"name", "projectID", "assignedTo"}; !reflect.DeepEqual(task.Required, want) {
+		t.Errorf("expected required %v, got %v", want, task.Required)
+	}
+	if name := task.Properties["name"]; *name.MinLength != 1 || *name.MaxLength != 255 {
+		t.Errorf("expected the length of name to be limited, got %+v", name)
+	}
+	if status := task.Properties["status"]; !reflect.DeepEqual(status.Enum, model.TaskStatuses) {
+		t.Errorf("expected the task statuses, got %v", status.Enum)
+	}
+	if createdAt := task.Properties["createdAt"]; createdAt.Type != "string" || createdAt.Format != "date-time" {
+		t.Errorf("expected a date-time, got %+v", createdAt)
+	}
+
+	schemas.For(model.CreateAccessTokenPayload{})
+	token := schemas["CreateAccessTokenPayload"]
+	if scopes := token.Properties["scopes"]; scopes.Type != "array" || !reflect.DeepEqual(scopes.Items.Enum, model.AccessTokenScopes) {
+		t.Errorf("expected an array of scopes, got %+v", scopes)
+	}
+	if days := token.Properties["expiresInDays"]; *days.Minimum != 1 || *days.Maximum != 365 {
+		t.Errorf("expected expiresInDays to be bounded, got %+v", days)
+	}
+
+	// the fields of a partial update are optional, but not blank
+	schemas.For(model.UpdateProfilePayload{})
+	profile := schemas["UpdateProfilePayload"]
+	if len(profile.Required) != 0 || !reflect.DeepEqual(profile.Properties["firstName"].Type, []string{"string", "null"}) {
+		t.Errorf("expected optional nullable fields, got %+v", profile)
+	}
+}
@@ -0,0 +1,261 @@
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/buildinfo"
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+)
+
+// BasePath is the prefix of every path in the document.
+const BasePath = "/api/v1"
+
+// OrgPrefix is the path under which organization scoped routes are also
+// served.
+const OrgPrefix = "/orgs/{org}"
+
+// route describes one operation of the API.
+type route struct {
+	method  string
+	path    string
+	id      string
+	summary string
+	tag     string
+	// auth requires a session. scope additionally lets personal access
+	// tokens holding it through.
+	auth  bool
+	scope string
+	// inOrg routes are also served under OrgPrefix. Elsewhere their
+	// organization comes from the X-Organization header.
+	inOrg bool
+	// versioned routes send the ETag of the resource they return. Reads
+	// honour If-None-Match, and changes other than creation If-Match.
+	versioned bool
+	// params overrides the descriptions of path parameters.
+	params map[string]*Parameter
+	// body and response are model values, a *Schema or a oneOf. A nil
+	// response has no content.
+	body         any
+	bodyType     string
+	status       int
+	response     any
+	responseType string
+}
+
+var tokenSchema = &Schema{Type: "string", Description: "A session JWT, also set in the session and CSRF cookies"}
+
+var routes = []route{
+	{method: "POST", path: "/users/register", id: "register", summary: "Create an account and log in", tag: "users", body: model.RegisterPayload{}, status: http.StatusCreated, response: tokenSchema},
+	{method: "POST", path: "/users/login", id: "login", summary: "Log in with email and password", tag: "users", body: model.LoginRequest{}, status: http.StatusOK, response: oneOf{tokenSchema, model.TwoFactorChallenge{}}},
+	{method: "POST", path: "/users/login/2fa", id: "loginTwoFactor", summary: "Complete a login with a second factor", tag: "users", body: model.TwoFactorLoginPayload{}, status: http.StatusOK, response: tokenSchema},
+	{method: "POST", path: "/users/password/forgot", id: "forgotPassword", summary: "Email a password reset link", tag: "users", body: model.ForgotPasswordPayload{}, status: http.StatusAccepted},
+	{method: "POST", path: "/users/password/reset", id: "resetPassword", summary: "Set a new password with a reset token", tag: "users", body: model.ResetPasswordPayload{}, status: http.StatusNoContent},
+	{method: "POST", path: "/users/verify", id: "verifyEmail", summary: "Verify an email address", tag: "users", body: model.VerifyEmailPayload{}, status: http.StatusNoContent},
+	{method: "POST", path: "/users/2fa/enroll", id: "enrollTOTP", summary: "Start enrolling an authenticator app", tag: "users", auth: true, status: http.StatusOK, response: model.TOTPEnrollment{}},
+	{method: "POST", path: "/users/2fa/confirm", id: "confirmTOTP", summary: "Enable two-factor authentication", tag: "users", auth: true, body: model.TOTPCodePayload{}, status: http.StatusOK, response: model.RecoveryCodes{}},
+	{method: "POST", path: "/users/2fa/disable", id: "disableTOTP", summary: "Disable two-factor authentication", tag: "users", auth: true, body: model.TOTPCodePayload{}, status: http.StatusNoContent},
+	{method: "POST", path: "/users/email/confirm", id: "confirmEmailChange", summary: "Confirm a new email address", tag: "users", body: model.VerifyEmailPayload{}, status: http.StatusNoContent},
+	{method: "GET", path: "/users/me", id: "getProfile", summary: "Get the current user", tag: "users", auth: true, status: http.StatusOK, response: model.User{}},
+	{method: "PATCH", path: "/users/me", id: "updateProfile", summary: "Update the fields sent of the current user", tag: "users", auth: true, body: model.UpdateProfilePayload{}, status: http.StatusOK, response: model.User{}},
+	{method: "DELETE", path: "/users/me", id: "deleteAccount", summary: "Delete the current user", tag: "users", auth: true, body: model.DeleteAccountPayload{}, status: http.StatusNoContent},
+	{method: "POST", path: "/users/me/password", id: "changePassword", summary: "Change the password", tag: "users", auth: true, body: model.ChangePasswordPayload{}, status: http.StatusNoContent},
+	{method: "POST", path: "/users/me/email", id: "changeEmail", summary: "Email a link confirming a new address", tag: "users", auth: true, body: model.ChangeEmailPayload{}, status: http.StatusAccepted},
+	{method: "PUT", path: "/users/me/avatar", id: "uploadAvatar", summary: "Upload an avatar", tag: "users", auth: true, body: avatarForm, bodyType: "multipart/form-data", status: http.StatusOK, response: model.User{}},
+	{method: "DELETE", path: "/users/me/avatar", id: "deleteAvatar", summary: "Remove the avatar", tag: "users", auth: true, status: http.StatusNoContent},
+	{method: "GET", path: "/users/{id}/avatar", id: "getAvatar", summary: "Download a user's avatar", tag: "users", auth: true, params: map[string]*Parameter{"id": {Description: "A user ID, or me", Schema: &Schema{Type: "string"}}}, status: http.StatusOK, response: &Schema{Type: "string", Format: "binary"}, responseType: "image/*"},
+
+	{method: "POST", path: "/projects", id: "createProject", summary: "Create a project", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, versioned: true, body: model.Project{}, status: http.StatusCreated, response: model.Project{}},
+	{method: "GET", path: "/projects/{id}", id: "getProject", summary: "Get a project", tag: "projects", auth: true, scope: model.ScopeProjectsRead, inOrg: true, versioned: true, status: http.StatusOK, response: model.Project{}},
+	{method: "PUT", path: "/projects/{id}", id: "updateProject", summary: "Replace a project", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, versioned: true, body: model.Project{}, status: http.StatusOK, response: model.Project{}},
+	{method: "PATCH", path: "/projects/{id}", id: "patchProject", summary: "Change the fields of a project sent in a JSON merge patch", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, versioned: true, body: model.ProjectPatch{}, bodyType: utils.MergePatchContentType, status: http.StatusOK, response: model.Project{}},
+	{method: "DELETE", path: "/projects/{id}", id: "deleteProject", summary: "Delete a project and its tasks", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, versioned: true, status: http.StatusNoContent},
+	{method: "GET", path: "/projects/{id}/grants", id: "listProjectGrants", summary: "List the roles granted on a project", tag: "projects", auth: true, scope: model.ScopeProjectsRead, inOrg: true, status: http.StatusOK, response: []model.ProjectGrant{}},
+	{method: "PUT", path: "/projects/{id}/grants/users/{userID}", id: "setUserGrant", summary: "Grant a user a role on a project", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, body: model.SetProjectGrantPayload{}, status: http.StatusOK, response: model.ProjectGrant{}},
+	{method: "DELETE", path: "/projects/{id}/grants/users/{userID}", id: "deleteUserGrant", summary: "Revoke a user's role on a project", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, status: http.StatusNoContent},
+	{method: "PUT", path: "/projects/{id}/grants/teams/{teamID}", id: "setTeamGrant", summary: "Grant a team a role on a project", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, body: model.SetProjectGrantPayload{}, status: http.StatusOK, response: model.ProjectGrant{}},
+	{method: "DELETE", path: "/projects/{id}/grants/teams/{teamID}", id: "deleteTeamGrant", summary: "Revoke a team's role on a project", tag: "projects", auth: true, scope: model.ScopeProjectsWrite, inOrg: true, status: http.StatusNoContent},
+	{method: "GET", path: "/projects/{id}/access/{userID}", id: "getProjectAccess", summary: "Explain a user's effective access to a project", tag: "projects", auth: true, scope: model.ScopeProjectsRead, inOrg: true, status: http.StatusOK, response: model.ProjectAccess{}},
+
+	{method: "POST", path: "/tasks", id: "createTask", summary: "Create a task", tag: "tasks", auth: true, scope: model.ScopeTasksWrite, inOrg: true, versioned: true, body: model.Task{}, status: http.StatusCreated, response: model.Task{}},
+	{method: "GET", path: "/tasks/{id}", id: "getTask", summary: "Get a task", tag: "tasks", auth: true, scope: model.ScopeTasksRead, inOrg: true, versioned: true, status: http.StatusOK, response: model.Task{}},
+	{method: "PUT", path: "/tasks/{id}", id: "updateTask", summary: "Replace a task", tag: "tasks", auth: true, scope: model.ScopeTasksWrite, inOrg: true, versioned: true, body: model.Task{}, status: http.StatusOK, response: model.Task{}},
+	{method: "PATCH", path: "/tasks/{id}", id: "patchTask", summary: "Change the fields of a task sent in a JSON merge patch", tag: "tasks", auth: true, scope: model.ScopeTasksWrite, inOrg: true, versioned: true, body: model.TaskPatch{}, bodyType: utils.MergePatchContentType, status: http.StatusOK, response: model.Task{}},
+	{method: "DELETE", path: "/tasks/{id}", id: "deleteTask", summary: "Delete a task", tag: "tasks", auth: true, scope: model.ScopeTasksWrite, inOrg: true, versioned: true, status: http.StatusNoContent},
+}
+
+// oneOf is a response that takes one of several shapes.
+type oneOf []any
+
+var avatarForm = &Schema{
+	Type:       "object",
+	Properties: map[string]*Schema{"avatar": {Type: "string", Format: "binary", Description: "A PNG, JPEG, GIF or WebP image"}},
+	Required:   []string{"avatar"},
+}
+
+var pathParams = regexp.MustCompile(`\{(\w+)\}`)
+
+var paramDescriptions = map[string]*Parameter{
+	"id":     {Schema: &Schema{Type: "integer", Format: "int64"}},
+	"userID": {Schema: &Schema{Type: "integer", Format: "int64"}},
+	"teamID": {Schema: &Schema{Type: "integer", Format: "int64"}},
+	"org":    {Description: "The ID or slug of the organization", Schema: &Schema{Type: "string"}},
+}
+
+// Build returns the document describing every route.
+func Build() *Document {
+	schemas := Schemas{}
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       "Project Manager API",
+			Description: "Errors are returned as RFC 7807 problem details with a machine-readable code.",
+			Version:     buildinfo.Version,
+		},
+		Servers: []Server{{URL: BasePath}},
+		Tags: []Tag{
+			{Name: "users", Description: "Accounts, logins and profiles"},
+			{Name: "projects", Description: "Projects and the roles granted on them"},
+			{Name: "tasks", Description: "Tasks within projects"},
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: schemas,
+			Responses: map[string]*Response{
+				"Problem": {
+					Description: "An error",
+					Content:     map[string]*MediaType{"application/problem+json": {Schema: schemas.For(model.Problem{})}},
+				},
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"session": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "A session token returned by register or login"},
+				"sessionCookie": {Type: "apiKey", In: "cookie", Name: middleware.SessionCookie,
+					Description: "The session cookie set by register or login. State-changing requests must echo the " + middleware.CSRFCookie + " cookie in the " + middleware.CSRFHeader + " header."},
+				"accessToken": {Type: "http", Scheme: "bearer", Description: "A personal access token, limited to the operations allowed by its scopes"},
+			},
+		},
+	}
+
+	for _, rt := range routes {
+		doc.add(rt.path, rt.id, rt, schemas)
+		if rt.inOrg {
+			doc.add(OrgPrefix+rt.path, rt.id+"InOrg", rt, schemas)
+		}
+	}
+	return doc
+}
+
+var etagSchema = &Schema{Type: "string", Description: "The version of the resource, such as \"3\""}
+
+func (d *Document) add(path, id string, rt route, schemas Schemas) {
+	op := &Operation{
+		OperationID: id,
+		Summary:     rt.summary,
+		Tags:        []string{rt.tag},
+		Responses: map[string]*Response{
+			strconv.Itoa(rt.status): response(rt, schemas),
+			"default":               {Ref: "#/components/responses/Problem"},
+		},
+		Security: []map[string][]string{},
+	}
+
+	for _, match := range pathParams.FindAllStringSubmatch(path, -1) {
+		description, ok := rt.params[match[1]]
+		if !ok {
+			description = paramDescriptions[match[1]]
+		}
+		param := *description
+		param.Name, param.In, param.Required = match[1], "path", true
+		op.Parameters = append(op.Parameters, param)
+	}
+	if rt.inOrg && !strings.HasPrefix(path, OrgPrefix) {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:        middleware.OrgHeader,
+			In:          "header",
+			Description: "The ID or slug of the organization, needed by users of more than one",
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	if rt.versioned {
+		addPreconditions(op, rt)
+	}
+
+	if rt.body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{mediaType(rt.bodyType): {Schema: schemaOf(rt.body, schemas)}},
+		}
+	}
+
+	if rt.auth {
+		op.Security = []map[string][]string{{"session": {}}, {"sessionCookie": {}}}
+		if rt.scope != "" {
+			op.Security = append(op.Security, map[string][]string{"accessToken": {rt.scope}})
+		}
+	}
+
+	if d.Paths[path] == nil {
+		d.Paths[path] = PathItem{}
+	}
+	d.Paths[path][strings.ToLower(rt.method)] = op
+}
+
+func addPreconditions(op *Operation, rt route) {
+	if rt.status != http.StatusNoContent {
+		op.Responses[strconv.Itoa(rt.status)].Headers = map[string]*Header{"ETag": {Schema: etagSchema}}
+	}
+
+	switch rt.method {
+	case "GET":
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:        "If-None-Match",
+			In:          "header",
+			Description: "The ETag of a copy of the resource, which is not sent again if it is current",
+			Schema:      etagSchema,
+		})
+		op.Responses[strconv.Itoa(http.StatusNotModified)] = &Response{Description: http.StatusText(http.StatusNotModified)}
+	case "PUT", "PATCH", "DELETE":
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:        "If-Match",
+			In:          "header",
+			Description: "The ETag of the version the change is based on, or *. Changes to another version fail with 412, and unless IF_MATCH_REQUIRED is false requests without it fail with 428.",
+			Required:    config.Envs.IfMatchRequired,
+			Schema:      etagSchema,
+		})
+	}
+}
+
+func response(rt route, schemas Schemas) *Response {
+	r := &Response{Description: http.StatusText(rt.status)}
+	if rt.response != nil {
+		r.Content = map[string]*MediaType{mediaType(rt.responseType): {Schema: schemaOf(rt.response, schemas)}}
+	}
+	return r
+}
+
+func schemaOf(v any, schemas Schemas) *Schema {
+	switch v := v.(type) {
+	case *Schema:
+		return v
+	case oneOf:
+		schema := &Schema{}
+		for _, alternative := range v {
+			schema.OneOf = append(schema.OneOf, schemaOf(alternative, schemas))
+		}
+		return schema
+	}
+	return schemas.For(v)
+}
+
+func mediaType(t string) string {
+	if t == "" {
+		return "application/json"
+	}
+	return t
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+const accessTokenColumns = "id, userId, name, scopes, tokenHash, expiresAt, lastUsedAt, revokedAt, createdAt"
+
+func (s *Storage) CreateAccessToken(ctx context.Context, t *model.AccessToken) (*model.AccessToken, error) {
+	result, err := s.db.ExecContext(ctx, "INSERT INTO access_tokens (userId, name, scopes, tokenHash, expiresAt) VALUES (?, ?, ?, ?, ?)", t.UserID, t.Name, strings.Join(t.Scopes, ","), t.TokenHash, t.ExpiresAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateAccessToken: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	t.ID = id
+	t.CreatedAt = time.Now()
+	return t, nil
+}
+
+func (s *Storage) GetAccessTokenByHash(ctx context.Context, tokenHash string) (*model.AccessToken, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+accessTokenColumns+" FROM access_tokens WHERE tokenHash = ?", tokenHash)
+	return scanAccessToken(row)
+}
+
+func (s *Storage) ListAccessTokens(ctx context.Context, userID int64) ([]model.AccessToken, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+accessTokenColumns+" FROM access_tokens WHERE userId = ? ORDER BY createdAt DESC", userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListAccessTokens: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []model.AccessToken{}
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAccessToken revokes one of the user's tokens. Tokens that belong to
+// another user or are already revoked yield sql.ErrNoRows.
+func (s *Storage) RevokeAccessToken(ctx context.Context, userID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE access_tokens SET revokedAt = ? WHERE id = ? AND userId = ? AND revokedAt IS NULL", time.Now(), id, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("RevokeAccessToken: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// RevokeUserAccessTokens revokes every token of the user and returns how many
+// were revoked.
+func (s *Storage) RevokeUserAccessTokens(ctx context.Context, userID int64) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE access_tokens SET revokedAt = ? WHERE userId = ? AND revokedAt IS NULL", time.Now(), userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("RevokeUserAccessTokens: error executing query", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *Storage) TouchAccessToken(ctx context.Context, id int64, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE access_tokens SET lastUsedAt = ? WHERE id = ?", usedAt, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("TouchAccessToken: error executing query", "error", err)
+	}
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAccessToken(row scanner) (*model.AccessToken, error) {
+	var t model.AccessToken
+	var scopes string
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.TokenHash, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Scopes = []string{}
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *Storage) CreateAuditEvent(ctx context.Context, e *model.AuditEvent) (*model.AuditEvent, error) {
+	result, err := s.db.ExecContext(ctx, "INSERT INTO audit_events (actorId, action, targetUserId, detail, ip) VALUES (?, ?, ?, ?, ?)", e.ActorID, e.Action, e.TargetUserID, e.Detail, e.IP)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateAuditEvent: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	e.ID = id
+	return e, nil
+}
+
+// ListAuditEvents returns the most recent events, newest first. A non-zero
+// targetUserID only returns the events about that user.
+func (s *Storage) ListAuditEvents(ctx context.Context, targetUserID int64, limit int) ([]model.AuditEvent, error) {
+	query := "SELECT id, actorId, action, targetUserId, detail, ip, createdAt FROM audit_events"
+	var args []any
+	if targetUserID != 0 {
+		query += " WHERE targetUserId = ?"
+		args = append(args, targetUserID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListAuditEvents: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.AuditEvent{}
+	for rows.Next() {
+		var e model.AuditEvent
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetUserID, &e.Detail, &e.IP, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDuplicateEntry is the MySQL error number for unique key violations.
+const mysqlDuplicateEntry = 1062
+
+// ErrDuplicate is matched, through errors.Is, by the errors naming the
+// unique key a write violated, such as ErrSlugTaken.
+var ErrDuplicate = errors.New("duplicate key")
+
+var (
+	ErrEmailTaken    error = duplicateError("email address is already in use")
+	ErrSlugTaken     error = duplicateError("slug is already in use")
+	ErrTeamNameTaken error = duplicateError("a team with this name already exists")
+)
+
+// ErrVersionConflict is returned by conditional writes when the row was
+// changed since the version they are based on was read.
+var ErrVersionConflict = errors.New("the resource has been changed since it was read")
+
+// versionConflict explains why a conditional write changed no rows, given
+// the error of reading the row again: the row is gone, or it is at another
+// version.
+func versionConflict(err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+type duplicateError string
+
+func (e duplicateError) Error() string {
+	return string(e)
+}
+
+func (e duplicateError) Is(target error) bool {
+	return target == ErrDuplicate
+}
+
+// IsDuplicate reports whether err is a unique key violation, whether it was
+// translated into an error like ErrSlugTaken or not.
+func IsDuplicate(err error) bool {
+	return errors.Is(err, ErrDuplicate) || isDuplicateEntry(err)
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *Storage) GetLoginThrottle(ctx context.Context, scope, key string) (*model.LoginThrottle, error) {
+	var t model.LoginThrottle
+	err := s.db.QueryRowContext(ctx, "SELECT scope, throttleKey, failures, lastFailureAt, lockedUntil FROM login_throttles WHERE scope = ? AND throttleKey = ?", scope, key).Scan(&t.Scope, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// RecordLoginFailure increments the failure counter and returns the updated
+// record. Failures that happened before since no longer count, so the
+// counter starts again at one.
+func (s *Storage) RecordLoginFailure(ctx context.Context, scope, key string, since time.Time) (*model.LoginThrottle, error) {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO login_throttles (scope, throttleKey, failures, lastFailureAt) VALUES (?, ?, 1, ?)
+		ON DUPLICATE KEY UPDATE failures = IF(lastFailureAt < ?, 1, failures + 1), lastFailureAt = VALUES(lastFailureAt)`,
+		scope, key, now, since,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("RecordLoginFailure: error executing query", "error", err)
+		return nil, err
+	}
+
+	return s.GetLoginThrottle(ctx, scope, key)
+}
+
+func (s *Storage) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE login_throttles SET lockedUntil = ? WHERE scope = ? AND throttleKey = ?", until, scope, key)
+	if err != nil {
+		logging.FromContext(ctx).Error("LockLogin: error executing query", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Storage) ClearLoginThrottle(ctx context.Context, scope, key string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM login_throttles WHERE scope = ? AND throttleKey = ?", scope, key)
+	if err != nil {
+		logging.FromContext(ctx).Error("ClearLoginThrottle: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// ListLoginLockouts returns every account and IP that is locked at now.
+func (s *Storage) ListLoginLockouts(ctx context.Context, now time.Time) ([]model.LoginThrottle, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT scope, throttleKey, failures, lastFailureAt, lockedUntil FROM login_throttles WHERE lockedUntil > ? ORDER BY lockedUntil DESC", now)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListLoginLockouts: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []model.LoginThrottle{}
+	for rows.Next() {
+		var t model.LoginThrottle
+		if err := rows.Scan(&t.Scope, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, t)
+	}
+
+	return lockouts, rows.Err()
+}
@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+// CreateOrganization creates an organization with ownerID as its owner. It
+// yields ErrSlugTaken if another organization has the slug.
+func (s *Storage) CreateOrganization(ctx context.Context, o *model.Organization, ownerID int64) (*model.Organization, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO organizations (name, slug) VALUES (?, ?)", o.Name, o.Slug)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, ErrSlugTaken
+		}
+		logging.FromContext(ctx).Error("CreateOrganization: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO org_members (orgId, userId, role) VALUES (?, ?, ?)", id, ownerID, model.OrgRoleOwner); err != nil {
+		logging.FromContext(ctx).Error("CreateOrganization: error adding owner", "error", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	o.ID = id
+	o.CreatedAt = time.Now()
+	o.Role = model.OrgRoleOwner
+	return o, nil
+}
+
+func (s *Storage) GetOrganization(ctx context.Context, id int64) (*model.Organization, error) {
+	var o model.Organization
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, slug, createdAt FROM organizations WHERE id = ?", id).Scan(&o.ID, &o.Name, &o.Slug, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+func (s *Storage) GetOrganizationBySlug(ctx context.Context, slug string) (*model.Organization, error) {
+	var o model.Organization
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, slug, createdAt FROM organizations WHERE slug = ?", slug).Scan(&o.ID, &o.Name, &o.Slug, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+// ListUserOrganizations returns the organizations the user belongs to, with
+// the user's role in each.
+func (s *Storage) ListUserOrganizations(ctx context.Context, userID int64) ([]model.Organization, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT o.id, o.name, o.slug, o.createdAt, m.role FROM organizations o JOIN org_members m ON m.orgId = o.id WHERE m.userId = ? ORDER BY o.name", userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListUserOrganizations: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []model.Organization{}
+	for rows.Next() {
+		var o model.Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.Slug, &o.CreatedAt, &o.Role); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+
+	return orgs, rows.Err()
+}
+
+// DeleteOrganization deletes an organization with all of its projects and
+// their tasks.
+func (s *Storage) DeleteOrganization(ctx context.Context, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE t FROM tasks t JOIN projects p ON p.id = t.projectId WHERE p.orgId = ?", id); err != nil {
+		logging.FromContext(ctx).Error("DeleteOrganization: error deleting tasks", "error", err)
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM projects WHERE orgId = ?", id); err != nil {
+		logging.FromContext(ctx).Error("DeleteOrganization: error deleting projects", "error", err)
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM organizations WHERE id = ?", id)
+	if err != nil {
+		logging.FromContext(ctx).Error("DeleteOrganization: error executing query", "error", err)
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const orgMemberColumns = "m.orgId, m.userId, m.role, u.email, u.firstName, u.lastName, m.createdAt"
+
+func (s *Storage) GetOrgMember(ctx context.Context, orgID, userID int64) (*model.OrgMember, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+orgMemberColumns+" FROM org_members m JOIN users u ON u.id = m.userId WHERE m.orgId = ? AND m.userId = ? AND u.deletedAt IS NULL", orgID, userID)
+	return scanOrgMember(row)
+}
+
+func (s *Storage) ListOrgMembers(ctx context.Context, orgID int64) ([]model.OrgMember, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+orgMemberColumns+" FROM org_members m JOIN users u ON u.id = m.userId WHERE m.orgId = ? AND u.deletedAt IS NULL ORDER BY m.createdAt", orgID)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListOrgMembers: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.OrgMember{}
+	for rows.Next() {
+		m, err := scanOrgMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+
+	return members, rows.Err()
+}
+
+func (s *Storage) UpdateOrgMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE org_members SET role = ? WHERE orgId = ? AND userId = ?", role, orgID, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("UpdateOrgMemberRole: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// RemoveOrgMember removes the user from the organization along with their
+// team memberships and project grants in it.
+func (s *Storage) RemoveOrgMember(ctx context.Context, orgID, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM org_members WHERE orgId = ? AND userId = ?", orgID, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("RemoveOrgMember: error executing query", "error", err)
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE tm FROM team_members tm JOIN teams t ON t.id = tm.teamId WHERE t.orgId = ? AND tm.userId = ?", orgID, userID); err != nil {
+		logging.FromContext(ctx).Error("RemoveOrgMember: error removing team memberships", "error", err)
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE g FROM project_user_grants g JOIN projects p ON p.id = g.projectId WHERE p.orgId = ? AND g.userId = ?", orgID, userID); err != nil {
+		logging.FromContext(ctx).Error("RemoveOrgMember: error removing project grants", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanOrgMember(row scanner) (*model.OrgMember, error) {
+	var m model.OrgMember
+	if err := row.Scan(&m.OrgID, &m.UserID, &m.Role, &m.Email, &m.FirstName, &m.LastName, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+const orgInvitationColumns = "id, orgId, email, role, tokenHash, invitedById, expiresAt, acceptedAt, createdAt"
+
+func (s *Storage) CreateOrgInvitation(ctx context.Context, inv *model.OrgInvitation) (*model.OrgInvitation, error) {
+	result, err := s.db.ExecContext(ctx, "INSERT INTO org_invitations (orgId, email, role, tokenHash, invitedById, expiresAt) VALUES (?, ?, ?, ?, ?, ?)", inv.OrgID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedByID, inv.ExpiresAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateOrgInvitation: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	inv.ID = id
+	inv.CreatedAt = time.Now()
+	return inv, nil
+}
+
+func (s *Storage) GetOrgInvitationByHash(ctx context.Context, tokenHash string) (*model.OrgInvitation, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+orgInvitationColumns+" FROM org_invitations WHERE tokenHash = ?", tokenHash)
+	return scanOrgInvitation(row)
+}
+
+// ListOrgInvitations returns the organization's invitations that are neither
+// accepted nor expired.
+func (s *Storage) ListOrgInvitations(ctx context.Context, orgID int64, now time.Time) ([]model.OrgInvitation, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+orgInvitationColumns+" FROM org_invitations WHERE orgId = ? AND acceptedAt IS NULL AND expiresAt > ? ORDER BY createdAt DESC", orgID, now)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListOrgInvitations: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []model.OrgInvitation{}
+	for rows.Next() {
+		inv, err := scanOrgInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// RevokeOrgInvitation deletes an invitation that has not been accepted yet.
+func (s *Storage) RevokeOrgInvitation(ctx context.Context, orgID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM org_invitations WHERE id = ? AND orgId = ? AND acceptedAt IS NULL", id, orgID)
+	if err != nil {
+		logging.FromContext(ctx).Error("RevokeOrgInvitation: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// AcceptOrgInvitation marks the invitation accepted and adds the user to the
+// organization. Members keep their current role. An invitation that has
+// already been accepted, expired or been revoked yields sql.ErrNoRows.
+func (s *Storage) AcceptOrgInvitation(ctx context.Context, id, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orgID int64
+	var role string
+	err = tx.QueryRowContext(ctx, "SELECT orgId, role FROM org_invitations WHERE id = ? AND acceptedAt IS NULL AND expiresAt > ? FOR UPDATE", id, time.Now()).Scan(&orgID, &role)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("AcceptOrgInvitation: error executing query", "error", err)
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE org_invitations SET acceptedAt = ? WHERE id = ?", time.Now(), id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO org_members (orgId, userId, role) VALUES (?, ?, ?)", orgID, userID, role); err != nil {
+		logging.FromContext(ctx).Error("AcceptOrgInvitation: error adding member", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanOrgInvitation(row scanner) (*model.OrgInvitation, error) {
+	var inv model.OrgInvitation
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedByID, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+const projectInvitationColumns = "i.id, p.orgId, i.projectId, i.email, i.role, i.tokenHash, i.invitedById, i.expiresAt, i.acceptedAt, i.declinedAt, i.createdAt"
+
+func (s *Storage) CreateProjectInvitation(ctx context.Context, inv *model.ProjectInvitation) (*model.ProjectInvitation, error) {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO project_invitations (projectId, email, role, tokenHash, invitedById, expiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		inv.ProjectID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedByID, inv.ExpiresAt,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateProjectInvitation: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	inv.ID = id
+	inv.CreatedAt = time.Now()
+	return inv, nil
+}
+
+func (s *Storage) GetProjectInvitationByHash(ctx context.Context, tokenHash string) (*model.ProjectInvitation, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+projectInvitationColumns+" FROM project_invitations i JOIN projects p ON p.id = i.projectId WHERE i.tokenHash = ?", tokenHash)
+	return scanProjectInvitation(row)
+}
+
+// ListProjectInvitations returns the project's invitations that have not been
+// answered and have not expired.
+func (s *Storage) ListProjectInvitations(ctx context.Context, orgID, projectID int64, now time.Time) ([]model.ProjectInvitation, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+projectInvitationColumns+" FROM project_invitations i JOIN projects p ON p.id = i.projectId WHERE p.orgId = ? AND i.projectId = ? AND i.acceptedAt IS NULL AND i.declinedAt IS NULL AND i.expiresAt > ? ORDER BY i.createdAt DESC",
+		orgID, projectID, now,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListProjectInvitations: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []model.ProjectInvitation{}
+	for rows.Next() {
+		inv, err := scanProjectInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	return invitations, rows.Err()
+}
+
+// RevokeProjectInvitation deletes an invitation that has not been answered.
+func (s *Storage) RevokeProjectInvitation(ctx context.Context, orgID, projectID, id int64) error {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE i FROM project_invitations i JOIN projects p ON p.id = i.projectId WHERE i.id = ? AND i.projectId = ? AND p.orgId = ? AND i.acceptedAt IS NULL AND i.declinedAt IS NULL",
+		id, projectID, orgID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("RevokeProjectInvitation: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// AcceptProjectInvitation marks the invitation accepted, adds the user to the
+// project's organization as a guest unless they already belong to it, and
+// grants them the invited role on the project. A role the user was already
+// granted directly is never lowered. An invitation that has been answered,
+// revoked or has expired yields sql.ErrNoRows.
+func (s *Storage) AcceptProjectInvitation(ctx context.Context, id, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orgID, projectID int64
+	var role string
+	err = tx.QueryRowContext(ctx,
+		"SELECT p.orgId, i.projectId, i.role FROM project_invitations i JOIN projects p ON p.id = i.projectId WHERE i.id = ? AND i.acceptedAt IS NULL AND i.declinedAt IS NULL AND i.expiresAt > ? FOR UPDATE",
+		id, time.Now(),
+	).Scan(&orgID, &projectID, &role)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("AcceptProjectInvitation: error executing query", "error", err)
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE project_invitations SET acceptedAt = ? WHERE id = ?", time.Now(), id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO org_members (orgId, userId, role) VALUES (?, ?, ?)", orgID, userID, model.OrgRoleGuest); err != nil {
+		logging.FromContext(ctx).Error("AcceptProjectInvitation: error adding member", "error", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO project_user_grants (projectId, userId, role) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE role = IF(FIELD(VALUES(role), 'viewer', 'editor', 'admin') > FIELD(role, 'viewer', 'editor', 'admin'), VALUES(role), role)",
+		projectID, userID, role,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("AcceptProjectInvitation: error granting access", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) DeclineProjectInvitation(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE project_invitations SET declinedAt = ? WHERE id = ? AND acceptedAt IS NULL AND declinedAt IS NULL", time.Now(), id)
+	if err != nil {
+		logging.FromContext(ctx).Error("DeclineProjectInvitation: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+func scanProjectInvitation(row scanner) (*model.ProjectInvitation, error) {
+	var inv model.ProjectInvitation
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.ProjectID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedByID, &inv.ExpiresAt, &inv.AcceptedAt, &inv.DeclinedAt, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+const sessionColumns = "id, userId, device, ip, userAgent, expiresAt, lastSeenAt, revokedAt, impersonatorId, createdAt"
+
+func (s *Storage) CreateSession(ctx context.Context, sess *model.Session) (*model.Session, error) {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx, "INSERT INTO sessions (id, userId, device, ip, userAgent, expiresAt, lastSeenAt, impersonatorId) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", sess.ID, sess.UserID, sess.Device, sess.IP, sess.UserAgent, sess.ExpiresAt, now, sess.ImpersonatorID)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateSession: error executing query", "error", err)
+		return nil, err
+	}
+
+	sess.LastSeenAt = now
+	sess.CreatedAt = now
+	return sess, nil
+}
+
+func (s *Storage) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id)
+	return scanSession(row)
+}
+
+// ListSessions returns the user's sessions that are neither revoked nor
+// expired, most recently seen first.
+func (s *Storage) ListSessions(ctx context.Context, userID int64, now time.Time) ([]model.Session, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE userId = ? AND revokedAt IS NULL AND expiresAt > ? ORDER BY lastSeenAt DESC", userID, now)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListSessions: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *sess)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes one of the user's sessions. Sessions that belong to
+// another user or are already revoked yield sql.ErrNoRows.
+func (s *Storage) RevokeSession(ctx context.Context, userID int64, id string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE sessions SET revokedAt = ? WHERE id = ? AND userId = ? AND revokedAt IS NULL", time.Now(), id, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("RevokeSession: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID and
+// returns how many were revoked.
+func (s *Storage) RevokeOtherSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE sessions SET revokedAt = ? WHERE userId = ? AND id <> ? AND revokedAt IS NULL", time.Now(), userID, keepID)
+	if err != nil {
+		logging.FromContext(ctx).Error("RevokeOtherSessions: error executing query", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *Storage) TouchSession(ctx context.Context, id string, seenAt time.Time, ip string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET lastSeenAt = ?, ip = ? WHERE id = ?", seenAt, ip, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("TouchSession: error executing query", "error", err)
+	}
+	return err
+}
+
+func scanSession(row scanner) (*model.Session, error) {
+	var sess model.Session
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.Device, &sess.IP, &sess.UserAgent, &sess.ExpiresAt, &sess.LastSeenAt, &sess.RevokedAt, &sess.ImpersonatorID, &sess.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sess, nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+const shareLinkColumns = "l.id, p.orgId, l.projectId, l.tokenHash, l.passwordHash, l.createdById, l.expiresAt, l.revokedAt, l.createdAt"
+
+func (s *Storage) CreateShareLink(ctx context.Context, link *model.ShareLink) (*model.ShareLink, error) {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO project_share_links (projectId, tokenHash, passwordHash, createdById, expiresAt) VALUES (?, ?, ?, ?, ?)",
+		link.ProjectID, link.TokenHash, link.PasswordHash, link.CreatedByID, link.ExpiresAt,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateShareLink: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	link.ID = id
+	link.HasPassword = link.PasswordHash != ""
+	link.CreatedAt = time.Now()
+	return link, nil
+}
+
+func (s *Storage) GetShareLink(ctx context.Context, id int64) (*model.ShareLink, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+shareLinkColumns+" FROM project_share_links l JOIN projects p ON p.id = l.projectId WHERE l.id = ?", id)
+	return scanShareLink(row)
+}
+
+// ListShareLinks returns every link of the project, revoked ones included,
+// newest first.
+func (s *Storage) ListShareLinks(ctx context.Context, orgID, projectID int64) ([]model.ShareLink, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+shareLinkColumns+" FROM project_share_links l JOIN projects p ON p.id = l.projectId WHERE p.orgId = ? AND l.projectId = ? ORDER BY l.createdAt DESC",
+		orgID, projectID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListShareLinks: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []model.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+
+	return links, rows.Err()
+}
+
+func (s *Storage) RevokeShareLink(ctx context.Context, orgID, projectID, id int64) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE project_share_links l JOIN projects p ON p.id = l.projectId SET l.revokedAt = ? WHERE l.id = ? AND l.projectId = ? AND p.orgId = ? AND l.revokedAt IS NULL",
+		time.Now(), id, projectID, orgID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("RevokeShareLink: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// GetSharedProject loads the project with its tasks for a share link. Only
+// the names of assignees are selected, never their email addresses.
+func (s *Storage) GetSharedProject(ctx context.Context, projectID int64) (*model.SharedProject, error) {
+	var project model.SharedProject
+	err := s.db.QueryRowContext(ctx, "SELECT name, createdAt FROM projects WHERE id = ?", projectID).Scan(&project.Name, &project.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT t.id, t.name, t.status, COALESCE(CONCAT(u.firstName, ' ', u.lastName), ''), t.createdAt FROM tasks t LEFT JOIN users u ON u.id = t.assignedToID AND u.deletedAt IS NULL WHERE t.projectId = ? ORDER BY t.createdAt, t.id",
+		projectID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("GetSharedProject: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	project.Tasks = []model.SharedTask{}
+	for rows.Next() {
+		var task model.SharedTask
+		if err := rows.Scan(&task.ID, &task.Name, &task.Status, &task.Assignee, &task.CreatedAt); err != nil {
+			return nil, err
+		}
+		project.Tasks = append(project.Tasks, task)
+	}
+
+	return &project, rows.Err()
+}
+
+func scanShareLink(row scanner) (*model.ShareLink, error) {
+	var link model.ShareLink
+	err := row.Scan(&link.ID, &link.OrgID, &link.ProjectID, &link.TokenHash, &link.PasswordHash, &link.CreatedByID, &link.ExpiresAt, &link.RevokedAt, &link.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	link.HasPassword = link.PasswordHash != ""
+	return &link, nil
+}
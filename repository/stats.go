@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *Storage) GetStats(ctx context.Context) (*model.Stats, error) {
+	stats := model.Stats{TasksByStatus: map[string]int64{}}
+	err := s.db.QueryRowContext(ctx,
+		"SELECT (SELECT COUNT(*) FROM users WHERE deletedAt IS NULL), (SELECT COUNT(*) FROM organizations), (SELECT COUNT(*) FROM projects)",
+	).Scan(&stats.Users, &stats.Organizations, &stats.Projects)
+	if err != nil {
+		logging.FromContext(ctx).Error("GetStats: error executing query", "error", err)
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT status, COUNT(*) FROM tasks GROUP BY status")
+	if err != nil {
+		logging.FromContext(ctx).Error("GetStats: error counting tasks", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for _, status := range model.TaskStatuses {
+		stats.TasksByStatus[status] = 0
+	}
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		stats.TasksByStatus[status] = count
+	}
+
+	return &stats, rows.Err()
+}
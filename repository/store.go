@@ -1,41 +1,153 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 )
 
 type Store interface {
 	// Users
-	CreateUser(u *model.User) (*model.User, error)
-	GetUserByID(id string) (*model.User, error)
-	GetUserByEmail(email string) (*model.User, error)
-	// Tasks
-	CreateTask(t *model.Task) (*model.Task, error)
-	GetTask(id string) (*model.Task, error)
-	DeleteTask(id string) error
-	UpdateTask(t *model.Task) (*model.Task, error)
-	// Projects
-	CreateProject(p *model.Project) (*model.Project, error)
-	GetProject(id string) (*model.Project, error)
-	DeleteProject(id string) error 
-	UpdateProject(p *model.Project) (*model.Project, error)
+	CreateUser(ctx context.Context, u *model.User) (*model.User, error)
+	GetUserByID(ctx context.Context, id string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error
+	SetUserVerified(ctx context.Context, userID int64) error
+	UpdateUserProfile(ctx context.Context, u *model.User) error
+	SetPendingEmail(ctx context.Context, userID int64, email string) error
+	ConfirmEmailChange(ctx context.Context, userID int64) error
+	DeleteUser(ctx context.Context, userID int64) error
+	// User administration
+	ListUsers(ctx context.Context, filter model.UserFilter) ([]model.User, error)
+	SetUserRole(ctx context.Context, userID int64, role string) error
+	SetUserDeactivated(ctx context.Context, userID int64, deactivatedAt *time.Time) error
+	SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error
+	// Audit log
+	CreateAuditEvent(ctx context.Context, e *model.AuditEvent) (*model.AuditEvent, error)
+	ListAuditEvents(ctx context.Context, targetUserID int64, limit int) ([]model.AuditEvent, error)
+	// Avatars
+	SaveUserAvatar(ctx context.Context, a *model.UserAvatar) error
+	GetUserAvatar(ctx context.Context, userID int64) (*model.UserAvatar, error)
+	DeleteUserAvatar(ctx context.Context, userID int64) error
+	// User tokens
+	CreateUserToken(ctx context.Context, t *model.UserToken) (*model.UserToken, error)
+	ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error)
+	// Two-factor authentication
+	GetUserTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error)
+	SaveUserTOTP(ctx context.Context, t *model.UserTOTP) error
+	EnableUserTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error
+	DeleteUserTOTP(ctx context.Context, userID int64) error
+	UseTOTPStep(ctx context.Context, userID int64, step int64) error
+	ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+	// Login throttling
+	GetLoginThrottle(ctx context.Context, scope, key string) (*model.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, scope, key string, since time.Time) (*model.LoginThrottle, error)
+	LockLogin(ctx context.Context, scope, key string, until time.Time) error
+	ClearLoginThrottle(ctx context.Context, scope, key string) error
+	ListLoginLockouts(ctx context.Context, now time.Time) ([]model.LoginThrottle, error)
+	// Personal access tokens
+	CreateAccessToken(ctx context.Context, t *model.AccessToken) (*model.AccessToken, error)
+	GetAccessTokenByHash(ctx context.Context, tokenHash string) (*model.AccessToken, error)
+	ListAccessTokens(ctx context.Context, userID int64) ([]model.AccessToken, error)
+	RevokeAccessToken(ctx context.Context, userID, id int64) error
+	RevokeUserAccessTokens(ctx context.Context, userID int64) (int64, error)
+	TouchAccessToken(ctx context.Context, id int64, usedAt time.Time) error
+	// Sessions
+	CreateSession(ctx context.Context, sess *model.Session) (*model.Session, error)
+	GetSession(ctx context.Context, id string) (*model.Session, error)
+	ListSessions(ctx context.Context, userID int64, now time.Time) ([]model.Session, error)
+	RevokeSession(ctx context.Context, userID int64, id string) error
+	RevokeOtherSessions(ctx context.Context, userID int64, keepID string) (int64, error)
+	TouchSession(ctx context.Context, id string, seenAt time.Time, ip string) error
+	// External identities
+	GetUserIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, i *model.UserIdentity) (*model.UserIdentity, error)
+	// Organizations
+	CreateOrganization(ctx context.Context, o *model.Organization, ownerID int64) (*model.Organization, error)
+	GetOrganization(ctx context.Context, id int64) (*model.Organization, error)
+	GetOrganizationBySlug(ctx context.Context, slug string) (*model.Organization, error)
+	ListUserOrganizations(ctx context.Context, userID int64) ([]model.Organization, error)
+	DeleteOrganization(ctx context.Context, id int64) error
+	GetOrgMember(ctx context.Context, orgID, userID int64) (*model.OrgMember, error)
+	ListOrgMembers(ctx context.Context, orgID int64) ([]model.OrgMember, error)
+	UpdateOrgMemberRole(ctx context.Context, orgID, userID int64, role string) error
+	RemoveOrgMember(ctx context.Context, orgID, userID int64) error
+	// Organization invitations
+	CreateOrgInvitation(ctx context.Context, inv *model.OrgInvitation) (*model.OrgInvitation, error)
+	GetOrgInvitationByHash(ctx context.Context, tokenHash string) (*model.OrgInvitation, error)
+	ListOrgInvitations(ctx context.Context, orgID int64, now time.Time) ([]model.OrgInvitation, error)
+	RevokeOrgInvitation(ctx context.Context, orgID, id int64) error
+	AcceptOrgInvitation(ctx context.Context, id, userID int64) error
+	// Teams
+	CreateTeam(ctx context.Context, orgID int64, t *model.Team) (*model.Team, error)
+	GetTeam(ctx context.Context, orgID, id int64) (*model.Team, error)
+	ListTeams(ctx context.Context, orgID int64) ([]model.Team, error)
+	DeleteTeam(ctx context.Context, orgID, id int64) error
+	AddTeamMember(ctx context.Context, orgID, teamID, userID int64) error
+	RemoveTeamMember(ctx context.Context, orgID, teamID, userID int64) error
+	ListTeamMembers(ctx context.Context, orgID, teamID int64) ([]model.OrgMember, error)
+	// Project grants
+	ListProjectGrants(ctx context.Context, orgID, projectID int64) ([]model.ProjectGrant, error)
+	ListUserProjectGrants(ctx context.Context, orgID, projectID, userID int64) ([]model.ProjectGrant, error)
+	SetProjectUserGrant(ctx context.Context, orgID, projectID, userID int64, role string) error
+	DeleteProjectUserGrant(ctx context.Context, orgID, projectID, userID int64) error
+	SetProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64, role string) error
+	DeleteProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64) error
+	// Project invitations
+	CreateProjectInvitation(ctx context.Context, inv *model.ProjectInvitation) (*model.ProjectInvitation, error)
+	GetProjectInvitationByHash(ctx context.Context, tokenHash string) (*model.ProjectInvitation, error)
+	ListProjectInvitations(ctx context.Context, orgID, projectID int64, now time.Time) ([]model.ProjectInvitation, error)
+	RevokeProjectInvitation(ctx context.Context, orgID, projectID, id int64) error
+	AcceptProjectInvitation(ctx context.Context, id, userID int64) error
+	DeclineProjectInvitation(ctx context.Context, id int64) error
+	// Share links. GetSharedProject leaves out assignee email addresses.
+	CreateShareLink(ctx context.Context, link *model.ShareLink) (*model.ShareLink, error)
+	GetShareLink(ctx context.Context, id int64) (*model.ShareLink, error)
+	ListShareLinks(ctx context.Context, orgID, projectID int64) ([]model.ShareLink, error)
+	RevokeShareLink(ctx context.Context, orgID, projectID, id int64) error
+	GetSharedProject(ctx context.Context, projectID int64) (*model.SharedProject, error)
+	// Totals reported as metrics
+	GetStats(ctx context.Context) (*model.Stats, error)
+
+	// Tasks and projects always belong to an organization, and are only
+	// found through it.
+	CreateTask(ctx context.Context, orgID int64, t *model.Task) (*model.Task, error)
+	GetTask(ctx context.Context, orgID int64, id string) (*model.Task, error)
+	// Changes and deletions are conditional on the version of the task or
+	// project they are based on, and fail with ErrVersionConflict when it
+	// has changed since. PatchTask and PatchProject change only the fields
+	// set in the patch, and return the resource as stored.
+	DeleteTask(ctx context.Context, orgID int64, id string, version int64) error
+	UpdateTask(ctx context.Context, orgID int64, t *model.Task) (*model.Task, error)
+	PatchTask(ctx context.Context, orgID int64, id string, version int64, patch *model.TaskPatch) (*model.Task, error)
+	CreateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error)
+	GetProject(ctx context.Context, orgID int64, id string) (*model.Project, error)
+	DeleteProject(ctx context.Context, orgID int64, id string, version int64) error
+	UpdateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error)
+	PatchProject(ctx context.Context, orgID int64, id string, version int64, patch *model.ProjectPatch) (*model.Project, error)
 }
 
 type Storage struct {
-	db *sql.DB
+	db tracedDB
 }
 
 func NewStore(db *sql.DB) *Storage {
 	return &Storage{
-		db: db,
+		db: tracedDB{db: db},
 	}
 }
 
-func (s *Storage) CreateUser(u *model.User) (*model.User, error) {
-	rows, err := s.db.Exec("INSERT INTO users (email, firstName, lastName, password) VALUES (?, ?, ?, ?)", u.Email, u.FirstName, u.LastName, u.Password)
+func (s *Storage) CreateUser(ctx context.Context, u *model.User) (*model.User, error) {
+	if u.Role == "" {
+		u.Role = model.RoleUser
+	}
+
+	rows, err := s.db.ExecContext(ctx, "INSERT INTO users (email, firstName, lastName, password, role) VALUES (?, ?, ?, ?, ?)", u.Email, u.FirstName, u.LastName, u.Password, u.Role)
 	if err != nil {
 		return nil, err
 	}
@@ -49,27 +161,33 @@ func (s *Storage) CreateUser(u *model.User) (*model.User, error) {
 	return u, nil
 }
 
-func (s *Storage) CreateTask(t *model.Task) (*model.Task, error) {
-	query := "INSERT INTO tasks (name, status, projectId, assignedToID) VALUES (?, ?, ?, ?)"
-	result, err := s.db.Exec(query, t.Name, t.Status, t.ProjectID, t.AssignedToID)
+// CreateTask adds a task to one of the organization's projects. A project of
+// another organization yields sql.ErrNoRows.
+func (s *Storage) CreateTask(ctx context.Context, orgID int64, t *model.Task) (*model.Task, error) {
+	query := "INSERT INTO tasks (name, status, projectId, assignedToID) SELECT ?, ?, id, ? FROM projects WHERE id = ? AND orgId = ?"
+	result, err := s.db.ExecContext(ctx, query, t.Name, t.Status, t.AssignedToID, t.ProjectID, orgID)
 	if err != nil {
-			log.Printf("CreateTask: error executing query: %v", err)
-			return nil, err
+		logging.FromContext(ctx).Error("CreateTask: error executing query", "error", err)
+		return nil, err
+	}
+
+	if err := requireRowsAffected(result); err != nil {
+		return nil, err
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-			log.Printf("CreateTask: error getting last insert ID: %v", err)
-			return nil, err
+		logging.FromContext(ctx).Error("CreateTask: error getting last insert ID", "error", err)
+		return nil, err
 	}
 
 	t.ID = id
+	t.Version = 1
 	return t, nil
 }
 
-
-func (s *Storage) CreateProject(p *model.Project) (*model.Project, error) {
-	rows, err := s.db.Exec("INSERT INTO projects (name) values (?)", p.Name)
+func (s *Storage) CreateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error) {
+	rows, err := s.db.ExecContext(ctx, "INSERT INTO projects (orgId, name) values (?, ?)", orgID, p.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -79,100 +197,195 @@ func (s *Storage) CreateProject(p *model.Project) (*model.Project, error) {
 		return nil, err
 	}
 
-	p.ID = id 
+	p.ID = id
+	p.OrgID = orgID
+	p.Version = 1
 
 	return p, nil
 }
 
-func (s *Storage) GetUserByID(id string) (*model.User, error) {
-	var user model.User
-	err := s.db.QueryRow("SELECT id, email, firstName, lastName, createdAt FROM users WHERE id = ?", id).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.CreatedAt)
+func (s *Storage) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ? AND deletedAt IS NULL", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Println("GetUserByID: user not found for id:", id)
+			logging.FromContext(ctx).Debug("GetUserByID: user not found", "user_id", id)
 			return nil, err
 		}
-		log.Println("GetUserByID: database error:", err)
+		logging.FromContext(ctx).Error("GetUserByID: database error", "error", err)
 		return nil, err
 	}
-	log.Println("GetUserByID: user found:", user)
-	return &user, nil
+	logging.FromContext(ctx).Debug("GetUserByID: user found", "user_id", user.ID)
+	return user, nil
 }
 
-func (s *Storage) GetUserByEmail(email string) (*model.User, error) {
-	var user model.User
-	err := s.db.QueryRow("SELECT id, email, firstName, lastName, password, createdAt FROM users WHERE email = ?", email).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName,&user.Password, &user.CreatedAt)
+func (s *Storage) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	var password string
+	user, err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+", password FROM users WHERE email = ? AND deletedAt IS NULL", email), &password)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Println("GetUserByEmail: user not found for email:", email)
+			logging.FromContext(ctx).Debug("GetUserByEmail: user not found", "email", logging.PII(email))
 			return nil, err
 		}
-		log.Println("GetUserByEmail: database error:", err)
+		logging.FromContext(ctx).Error("GetUserByEmail: database error", "error", err)
 		return nil, err
 	}
-	log.Println("GetUserByEmail: user found:", user)
-	return &user, nil
+	user.Password = password
+	logging.FromContext(ctx).Debug("GetUserByEmail: user found", "user_id", user.ID)
+	return user, nil
 }
 
-
-func (s *Storage) GetTask(id string) (*model.Task, error) {
+func (s *Storage) GetTask(ctx context.Context, orgID int64, id string) (*model.Task, error) {
 	var task model.Task
-	err := s.db.QueryRow("SELECT id, name, status, projectId, assignedToID, createdAt FROM tasks WHERE id = ?", id).Scan(&task.ID, &task.Name, &task.Status, &task.ProjectID, &task.AssignedToID, &task.CreatedAt)
+	err := s.db.QueryRowContext(ctx, "SELECT t.id, t.name, t.status, t.projectId, t.assignedToID, t.version, t.createdAt FROM tasks t JOIN projects p ON p.id = t.projectId WHERE t.id = ? AND p.orgId = ?", id, orgID).Scan(&task.ID, &task.Name, &task.Status, &task.ProjectID, &task.AssignedToID, &task.Version, &task.CreatedAt)
 	return &task, err
 }
 
-func (s *Storage) GetProject(id string) (*model.Project, error) {
+func (s *Storage) GetProject(ctx context.Context, orgID int64, id string) (*model.Project, error) {
 	var project model.Project
-	err := s.db.QueryRow("SELECT id, name, createdAt FROM projects WHERE id = ?", id).Scan(&project.ID, &project.Name, &project.CreatedAt)
+	err := s.db.QueryRowContext(ctx, "SELECT id, orgId, name, version, createdAt FROM projects WHERE id = ? AND orgId = ?", id, orgID).Scan(&project.ID, &project.OrgID, &project.Name, &project.Version, &project.CreatedAt)
 	return &project, err
 }
 
-func (s *Storage) DeleteProject(id string) error {
-	result, err := s.db.Exec("DELETE FROM projects WHERE id = ?", id)
+func (s *Storage) DeleteProject(ctx context.Context, orgID int64, id string, version int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM projects WHERE id = ? AND orgId = ? AND version = ?", id, orgID, version)
 	if err != nil {
-			log.Printf("DeleteProject: error executing query: %v", err)
-			return err
+		logging.FromContext(ctx).Error("DeleteProject: error executing query", "error", err)
+		return err
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-			log.Printf("DeleteProject: error getting affected rows: %v", err)
-			return err
+		logging.FromContext(ctx).Error("DeleteProject: error getting affected rows", "error", err)
+		return err
 	}
 
 	if rowsAffected == 0 {
-			log.Printf("DeleteProject: no rows affected, project id %s not found", id)
-			return sql.ErrNoRows
+		logging.FromContext(ctx).Debug("DeleteProject: project not found or changed", "project_id", id)
+		_, err := s.GetProject(ctx, orgID, id)
+		return versionConflict(err)
 	}
 
-	log.Printf("DeleteProject: project id %s deleted successfully", id)
+	logging.FromContext(ctx).Info("DeleteProject: project deleted", "project_id", id)
 	return nil
 }
 
-func (s *Storage) DeleteTask(id string) error {
-	_, err := s.db.Exec("DELETE FROM tasks WHERE id = ?", id)
+func (s *Storage) DeleteTask(ctx context.Context, orgID int64, id string, version int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE t FROM tasks t JOIN projects p ON p.id = t.projectId WHERE t.id = ? AND p.orgId = ? AND t.version = ?", id, orgID, version)
 	if err != nil {
-			log.Printf("DeleteTask: error executing query: %v", err)
-			return err
+		logging.FromContext(ctx).Error("DeleteTask: error executing query", "error", err)
+		return err
+	}
+	if requireRowsAffected(result) != nil {
+		_, err := s.GetTask(ctx, orgID, id)
+		return versionConflict(err)
 	}
-	log.Printf("DeleteTask: task with id %s deleted successfully", id)
+	logging.FromContext(ctx).Info("DeleteTask: task deleted", "task_id", id)
 	return nil
 }
 
-func (s *Storage) UpdateTask(t *model.Task) (*model.Task, error) {
-	_, err := s.db.Exec("UPDATE tasks SET name = ?, status = ?, projectId = ?, assignedToID = ? WHERE id = ?", t.Name, t.Status, t.ProjectID, t.AssignedToID, t.ID)
+// UpdateTask updates a task of the organization, if it is still at
+// t.Version, and sets t.Version to the new version. The task can only be
+// moved to another project of the same organization.
+func (s *Storage) UpdateTask(ctx context.Context, orgID int64, t *model.Task) (*model.Task, error) {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE tasks t JOIN projects p ON p.id = t.projectId JOIN projects np ON np.id = ? SET t.name = ?, t.status = ?, t.projectId = np.id, t.assignedToID = ?, t.version = t.version + 1 WHERE t.id = ? AND p.orgId = ? AND np.orgId = ? AND t.version = ?",
+		t.ProjectID, t.Name, t.Status, t.AssignedToID, t.ID, orgID, orgID, t.Version,
+	)
 	if err != nil {
-		log.Println("UpdateTask: error executing query:", err)
+		logging.FromContext(ctx).Error("UpdateTask: error executing query", "error", err)
 		return nil, err
 	}
+	if requireRowsAffected(result) != nil {
+		_, err := s.GetTask(ctx, orgID, strconv.FormatInt(t.ID, 10))
+		return nil, versionConflict(err)
+	}
+
+	t.Version++
 	return t, nil
 }
 
-func (s *Storage) UpdateProject(p *model.Project) (*model.Project, error) {
-	_, err := s.db.Exec("UPDATE projects SET name = ? WHERE id = ?", p.Name, p.ID)
+// PatchTask updates the columns of the fields set in the patch, if the task
+// is still at version. Like UpdateTask, it only moves the task to a project
+// of the same organization.
+func (s *Storage) PatchTask(ctx context.Context, orgID int64, id string, version int64, patch *model.TaskPatch) (*model.Task, error) {
+	var sets []string
+	var args []any
+	query := "UPDATE tasks t JOIN projects p ON p.id = t.projectId"
+	if patch.ProjectID != nil {
+		query += " JOIN projects np ON np.id = ? AND np.orgId = ?"
+		args = append(args, *patch.ProjectID, orgID)
+		sets = append(sets, "t.projectId = np.id")
+	}
+	if patch.Name != nil {
+		sets = append(sets, "t.name = ?")
+		args = append(args, *patch.Name)
+	}
+	if patch.Status != nil {
+		sets = append(sets, "t.status = ?")
+		args = append(args, *patch.Status)
+	}
+	if patch.AssignedToID != nil {
+		sets = append(sets, "t.assignedToID = ?")
+		args = append(args, *patch.AssignedToID)
+	}
+
+	if len(sets) > 0 {
+		sets = append(sets, "t.version = t.version + 1")
+		query += " SET " + strings.Join(sets, ", ") + " WHERE t.id = ? AND p.orgId = ? AND t.version = ?"
+		result, err := s.db.ExecContext(ctx, query, append(args, id, orgID, version)...)
+		if err != nil {
+			logging.FromContext(ctx).Error("PatchTask: error executing query", "error", err)
+			return nil, err
+		}
+		if requireRowsAffected(result) != nil {
+			_, err := s.GetTask(ctx, orgID, id)
+			return nil, versionConflict(err)
+		}
+	}
+
+	task, err := s.GetTask(ctx, orgID, id)
 	if err != nil {
-		log.Println("UpdateProject: error executing query:", err)
 		return nil, err
 	}
+	return task, nil
+}
+
+// UpdateProject updates a project of the organization, if it is still at
+// p.Version, and sets p.Version to the new version.
+func (s *Storage) UpdateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE projects SET name = ?, version = version + 1 WHERE id = ? AND orgId = ? AND version = ?", p.Name, p.ID, orgID, p.Version)
+	if err != nil {
+		logging.FromContext(ctx).Error("UpdateProject: error executing query", "error", err)
+		return nil, err
+	}
+	if requireRowsAffected(result) != nil {
+		_, err := s.GetProject(ctx, orgID, strconv.FormatInt(p.ID, 10))
+		return nil, versionConflict(err)
+	}
+
+	p.OrgID = orgID
+	p.Version++
 	return p, nil
-}
\ No newline at end of file
+}
+
+// PatchProject updates the columns of the fields set in the patch, if the
+// project is still at version.
+func (s *Storage) PatchProject(ctx context.Context, orgID int64, id string, version int64, patch *model.ProjectPatch) (*model.Project, error) {
+	if patch.Name != nil {
+		result, err := s.db.ExecContext(ctx, "UPDATE projects SET name = ?, version = version + 1 WHERE id = ? AND orgId = ? AND version = ?", *patch.Name, id, orgID, version)
+		if err != nil {
+			logging.FromContext(ctx).Error("PatchProject: error executing query", "error", err)
+			return nil, err
+		}
+		if requireRowsAffected(result) != nil {
+			_, err := s.GetProject(ctx, orgID, id)
+			return nil, versionConflict(err)
+		}
+	}
+
+	project, err := s.GetProject(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
@@ -1,52 +1,389 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"time"
+
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 )
 
 // MockStore implements the Store interface for testing purposes
 type MockStore struct{}
 
-func (s *MockStore) CreateProject(p *model.Project) (*model.Project, error) {
+func (s *MockStore) CreateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error) {
 	return p, nil
 }
 
-func (s *MockStore) GetProject(id string) (*model.Project, error) {
-	return &model.Project{Name: "Super cool project"}, nil
+func (s *MockStore) GetProject(ctx context.Context, orgID int64, id string) (*model.Project, error) {
+	return &model.Project{Name: "Super cool project", Version: 1}, nil
 }
 
-func (s *MockStore) DeleteProject(id string) error {
+func (s *MockStore) DeleteProject(ctx context.Context, orgID int64, id string, version int64) error {
 	return nil
 }
 
-func (s *MockStore) UpdateProject(project *model.Project) (*model.Project, error) {
+func (s *MockStore) UpdateProject(ctx context.Context, orgID int64, project *model.Project) (*model.Project, error) {
 	return project, nil
 }
 
-func (s *MockStore) CreateUser(u *model.User) (*model.User, error) {
+func (s *MockStore) PatchProject(ctx context.Context, orgID int64, id string, version int64, patch *model.ProjectPatch) (*model.Project, error) {
+	return &model.Project{Name: "Super cool project"}, nil
+}
+
+func (s *MockStore) CreateUser(ctx context.Context, u *model.User) (*model.User, error) {
 	return u, nil
 }
 
-func (s *MockStore) GetUserByID(id string) (*model.User, error) {
+func (s *MockStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
 	return &model.User{}, nil
 }
 
-func (s *MockStore) GetUserByEmail(email string) (*model.User, error) {
+func (s *MockStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	return &model.User{}, nil
 }
 
-func (s *MockStore) CreateTask(t *model.Task) (*model.Task, error) {
+func (s *MockStore) CreateTask(ctx context.Context, orgID int64, t *model.Task) (*model.Task, error) {
 	return t, nil
 }
 
-func (s *MockStore) GetTask(id string) (*model.Task, error) {
-	return &model.Task{}, nil
+func (s *MockStore) GetTask(ctx context.Context, orgID int64, id string) (*model.Task, error) {
+	return &model.Task{Version: 1}, nil
 }
 
-func (s *MockStore) DeleteTask(id string) error {
+func (s *MockStore) DeleteTask(ctx context.Context, orgID int64, id string, version int64) error {
 	return nil
 }
 
-func (s *MockStore) UpdateTask(task *model.Task) (*model.Task, error) {
+func (s *MockStore) UpdateTask(ctx context.Context, orgID int64, task *model.Task) (*model.Task, error) {
 	return task, nil
 }
+
+func (s *MockStore) PatchTask(ctx context.Context, orgID int64, id string, version int64, patch *model.TaskPatch) (*model.Task, error) {
+	return &model.Task{}, nil
+}
+
+func (s *MockStore) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error {
+	return nil
+}
+
+func (s *MockStore) SetUserVerified(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) UpdateUserProfile(ctx context.Context, u *model.User) error {
+	return nil
+}
+
+func (s *MockStore) SetPendingEmail(ctx context.Context, userID int64, email string) error {
+	return nil
+}
+
+func (s *MockStore) ConfirmEmailChange(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) DeleteUser(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) SaveUserAvatar(ctx context.Context, a *model.UserAvatar) error {
+	return nil
+}
+
+func (s *MockStore) GetUserAvatar(ctx context.Context, userID int64) (*model.UserAvatar, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) DeleteUserAvatar(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) ListUsers(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	return []model.User{}, nil
+}
+
+func (s *MockStore) SetUserRole(ctx context.Context, userID int64, role string) error {
+	return nil
+}
+
+func (s *MockStore) SetUserDeactivated(ctx context.Context, userID int64, deactivatedAt *time.Time) error {
+	return nil
+}
+
+func (s *MockStore) SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error {
+	return nil
+}
+
+func (s *MockStore) CreateAuditEvent(ctx context.Context, e *model.AuditEvent) (*model.AuditEvent, error) {
+	return e, nil
+}
+
+func (s *MockStore) ListAuditEvents(ctx context.Context, targetUserID int64, limit int) ([]model.AuditEvent, error) {
+	return []model.AuditEvent{}, nil
+}
+
+func (s *MockStore) CreateUserToken(ctx context.Context, t *model.UserToken) (*model.UserToken, error) {
+	return t, nil
+}
+
+func (s *MockStore) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	return &model.UserToken{Purpose: purpose, TokenHash: tokenHash}, nil
+}
+
+func (s *MockStore) GetUserTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) SaveUserTOTP(ctx context.Context, t *model.UserTOTP) error {
+	return nil
+}
+
+func (s *MockStore) EnableUserTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	return nil
+}
+
+func (s *MockStore) DeleteUserTOTP(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return nil
+}
+
+func (s *MockStore) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	return nil
+}
+
+func (s *MockStore) GetLoginThrottle(ctx context.Context, scope, key string) (*model.LoginThrottle, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) RecordLoginFailure(ctx context.Context, scope, key string, since time.Time) (*model.LoginThrottle, error) {
+	return &model.LoginThrottle{Scope: scope, Key: key, Failures: 1}, nil
+}
+
+func (s *MockStore) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	return nil
+}
+
+func (s *MockStore) ClearLoginThrottle(ctx context.Context, scope, key string) error {
+	return nil
+}
+
+func (s *MockStore) ListLoginLockouts(ctx context.Context, now time.Time) ([]model.LoginThrottle, error) {
+	return []model.LoginThrottle{}, nil
+}
+
+func (s *MockStore) CreateAccessToken(ctx context.Context, t *model.AccessToken) (*model.AccessToken, error) {
+	return t, nil
+}
+
+func (s *MockStore) GetAccessTokenByHash(ctx context.Context, tokenHash string) (*model.AccessToken, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListAccessTokens(ctx context.Context, userID int64) ([]model.AccessToken, error) {
+	return []model.AccessToken{}, nil
+}
+
+func (s *MockStore) RevokeAccessToken(ctx context.Context, userID, id int64) error {
+	return nil
+}
+
+func (s *MockStore) RevokeUserAccessTokens(ctx context.Context, userID int64) (int64, error) {
+	return 0, nil
+}
+
+func (s *MockStore) TouchAccessToken(ctx context.Context, id int64, usedAt time.Time) error {
+	return nil
+}
+
+func (s *MockStore) CreateSession(ctx context.Context, sess *model.Session) (*model.Session, error) {
+	return sess, nil
+}
+
+func (s *MockStore) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListSessions(ctx context.Context, userID int64, now time.Time) ([]model.Session, error) {
+	return []model.Session{}, nil
+}
+
+func (s *MockStore) RevokeSession(ctx context.Context, userID int64, id string) error {
+	return nil
+}
+
+func (s *MockStore) RevokeOtherSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	return 0, nil
+}
+
+func (s *MockStore) TouchSession(ctx context.Context, id string, seenAt time.Time, ip string) error {
+	return nil
+}
+
+func (s *MockStore) GetUserIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) CreateUserIdentity(ctx context.Context, i *model.UserIdentity) (*model.UserIdentity, error) {
+	return i, nil
+}
+
+func (s *MockStore) CreateOrganization(ctx context.Context, o *model.Organization, ownerID int64) (*model.Organization, error) {
+	return o, nil
+}
+
+func (s *MockStore) GetOrganization(ctx context.Context, id int64) (*model.Organization, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) GetOrganizationBySlug(ctx context.Context, slug string) (*model.Organization, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListUserOrganizations(ctx context.Context, userID int64) ([]model.Organization, error) {
+	return []model.Organization{}, nil
+}
+
+func (s *MockStore) DeleteOrganization(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (s *MockStore) GetOrgMember(ctx context.Context, orgID, userID int64) (*model.OrgMember, error) {
+	return &model.OrgMember{OrgID: orgID, UserID: userID, Role: model.OrgRoleMember}, nil
+}
+
+func (s *MockStore) ListOrgMembers(ctx context.Context, orgID int64) ([]model.OrgMember, error) {
+	return []model.OrgMember{}, nil
+}
+
+func (s *MockStore) UpdateOrgMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	return nil
+}
+
+func (s *MockStore) RemoveOrgMember(ctx context.Context, orgID, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) CreateOrgInvitation(ctx context.Context, inv *model.OrgInvitation) (*model.OrgInvitation, error) {
+	return inv, nil
+}
+
+func (s *MockStore) GetOrgInvitationByHash(ctx context.Context, tokenHash string) (*model.OrgInvitation, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListOrgInvitations(ctx context.Context, orgID int64, now time.Time) ([]model.OrgInvitation, error) {
+	return []model.OrgInvitation{}, nil
+}
+
+func (s *MockStore) RevokeOrgInvitation(ctx context.Context, orgID, id int64) error {
+	return nil
+}
+
+func (s *MockStore) AcceptOrgInvitation(ctx context.Context, id, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) CreateTeam(ctx context.Context, orgID int64, t *model.Team) (*model.Team, error) {
+	t.OrgID = orgID
+	return t, nil
+}
+
+func (s *MockStore) GetTeam(ctx context.Context, orgID, id int64) (*model.Team, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListTeams(ctx context.Context, orgID int64) ([]model.Team, error) {
+	return []model.Team{}, nil
+}
+
+func (s *MockStore) DeleteTeam(ctx context.Context, orgID, id int64) error {
+	return nil
+}
+
+func (s *MockStore) AddTeamMember(ctx context.Context, orgID, teamID, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) RemoveTeamMember(ctx context.Context, orgID, teamID, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) ListTeamMembers(ctx context.Context, orgID, teamID int64) ([]model.OrgMember, error) {
+	return []model.OrgMember{}, nil
+}
+
+func (s *MockStore) ListProjectGrants(ctx context.Context, orgID, projectID int64) ([]model.ProjectGrant, error) {
+	return []model.ProjectGrant{}, nil
+}
+
+func (s *MockStore) ListUserProjectGrants(ctx context.Context, orgID, projectID, userID int64) ([]model.ProjectGrant, error) {
+	return []model.ProjectGrant{}, nil
+}
+
+func (s *MockStore) SetProjectUserGrant(ctx context.Context, orgID, projectID, userID int64, role string) error {
+	return nil
+}
+
+func (s *MockStore) DeleteProjectUserGrant(ctx context.Context, orgID, projectID, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) SetProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64, role string) error {
+	return nil
+}
+
+func (s *MockStore) DeleteProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64) error {
+	return nil
+}
+
+func (s *MockStore) CreateProjectInvitation(ctx context.Context, inv *model.ProjectInvitation) (*model.ProjectInvitation, error) {
+	return inv, nil
+}
+
+func (s *MockStore) GetProjectInvitationByHash(ctx context.Context, tokenHash string) (*model.ProjectInvitation, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListProjectInvitations(ctx context.Context, orgID, projectID int64, now time.Time) ([]model.ProjectInvitation, error) {
+	return []model.ProjectInvitation{}, nil
+}
+
+func (s *MockStore) RevokeProjectInvitation(ctx context.Context, orgID, projectID, id int64) error {
+	return nil
+}
+
+func (s *MockStore) AcceptProjectInvitation(ctx context.Context, id, userID int64) error {
+	return nil
+}
+
+func (s *MockStore) DeclineProjectInvitation(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (s *MockStore) CreateShareLink(ctx context.Context, link *model.ShareLink) (*model.ShareLink, error) {
+	return link, nil
+}
+
+func (s *MockStore) GetShareLink(ctx context.Context, id int64) (*model.ShareLink, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListShareLinks(ctx context.Context, orgID, projectID int64) ([]model.ShareLink, error) {
+	return []model.ShareLink{}, nil
+}
+
+func (s *MockStore) RevokeShareLink(ctx context.Context, orgID, projectID, id int64) error {
+	return nil
+}
+
+func (s *MockStore) GetSharedProject(ctx context.Context, projectID int64) (*model.SharedProject, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) GetStats(ctx context.Context) (*model.Stats, error) {
+	return &model.Stats{TasksByStatus: map[string]int64{}}, nil
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *Storage) CreateTeam(ctx context.Context, orgID int64, t *model.Team) (*model.Team, error) {
+	result, err := s.db.ExecContext(ctx, "INSERT INTO teams (orgId, name) VALUES (?, ?)", orgID, t.Name)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, ErrTeamNameTaken
+		}
+		logging.FromContext(ctx).Error("CreateTeam: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	t.ID = id
+	t.OrgID = orgID
+	t.CreatedAt = time.Now()
+	return t, nil
+}
+
+func (s *Storage) GetTeam(ctx context.Context, orgID, id int64) (*model.Team, error) {
+	var t model.Team
+	err := s.db.QueryRowContext(ctx, "SELECT id, orgId, name, createdAt FROM teams WHERE id = ? AND orgId = ?", id, orgID).Scan(&t.ID, &t.OrgID, &t.Name, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (s *Storage) ListTeams(ctx context.Context, orgID int64) ([]model.Team, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, orgId, name, createdAt FROM teams WHERE orgId = ? ORDER BY name", orgID)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListTeams: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []model.Team{}
+	for rows.Next() {
+		var t model.Team
+		if err := rows.Scan(&t.ID, &t.OrgID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+
+	return teams, rows.Err()
+}
+
+// DeleteTeam deletes a team. Its memberships and project grants go with it.
+func (s *Storage) DeleteTeam(ctx context.Context, orgID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM teams WHERE id = ? AND orgId = ?", id, orgID)
+	if err != nil {
+		logging.FromContext(ctx).Error("DeleteTeam: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// AddTeamMember adds a member of the organization to one of its teams. Adding
+// an existing member does nothing.
+func (s *Storage) AddTeamMember(ctx context.Context, orgID, teamID, userID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT IGNORE INTO team_members (teamId, userId) SELECT t.id, m.userId FROM teams t JOIN org_members m ON m.orgId = t.orgId WHERE t.id = ? AND t.orgId = ? AND m.userId = ?",
+		teamID, orgID, userID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("AddTeamMember: error executing query", "error", err)
+	}
+	return err
+}
+
+func (s *Storage) RemoveTeamMember(ctx context.Context, orgID, teamID, userID int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE tm FROM team_members tm JOIN teams t ON t.id = tm.teamId WHERE tm.teamId = ? AND t.orgId = ? AND tm.userId = ?", teamID, orgID, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("RemoveTeamMember: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+func (s *Storage) ListTeamMembers(ctx context.Context, orgID, teamID int64) ([]model.OrgMember, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+orgMemberColumns+" FROM team_members tm JOIN teams t ON t.id = tm.teamId JOIN org_members m ON m.orgId = t.orgId AND m.userId = tm.userId JOIN users u ON u.id = m.userId WHERE tm.teamId = ? AND t.orgId = ? AND u.deletedAt IS NULL ORDER BY u.email",
+		teamID, orgID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListTeamMembers: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.OrgMember{}
+	for rows.Next() {
+		m, err := scanOrgMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+
+	return members, rows.Err()
+}
+
+const (
+	userGrantQuery = "SELECT g.projectId, g.userId, NULL, '', g.role, g.createdAt FROM project_user_grants g JOIN projects p ON p.id = g.projectId WHERE p.orgId = ? AND g.projectId = ?"
+	teamGrantQuery = "SELECT g.projectId, NULL, g.teamId, t.name, g.role, g.createdAt FROM project_team_grants g JOIN teams t ON t.id = g.teamId JOIN projects p ON p.id = g.projectId WHERE p.orgId = ? AND g.projectId = ?"
+)
+
+// ListProjectGrants returns every user and team grant on the project.
+func (s *Storage) ListProjectGrants(ctx context.Context, orgID, projectID int64) ([]model.ProjectGrant, error) {
+	return s.queryProjectGrants(ctx, userGrantQuery+" UNION ALL "+teamGrantQuery, orgID, projectID, orgID, projectID)
+}
+
+// ListUserProjectGrants returns the grants on the project that apply to the
+// user: their own and those of the teams they are in.
+func (s *Storage) ListUserProjectGrants(ctx context.Context, orgID, projectID, userID int64) ([]model.ProjectGrant, error) {
+	return s.queryProjectGrants(
+		ctx,
+		userGrantQuery+" AND g.userId = ? UNION ALL "+teamGrantQuery+" AND g.teamId IN (SELECT teamId FROM team_members WHERE userId = ?)",
+		orgID, projectID, userID, orgID, projectID, userID,
+	)
+}
+
+func (s *Storage) queryProjectGrants(ctx context.Context, query string, args ...any) ([]model.ProjectGrant, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("queryProjectGrants: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []model.ProjectGrant{}
+	for rows.Next() {
+		var g model.ProjectGrant
+		if err := rows.Scan(&g.ProjectID, &g.UserID, &g.TeamID, &g.TeamName, &g.Role, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+
+	return grants, rows.Err()
+}
+
+// SetProjectUserGrant grants a member of the organization a role on one of
+// its projects, replacing any role granted before.
+func (s *Storage) SetProjectUserGrant(ctx context.Context, orgID, projectID, userID int64, role string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO project_user_grants (projectId, userId, role) SELECT p.id, m.userId, ? FROM projects p JOIN org_members m ON m.orgId = p.orgId WHERE p.id = ? AND p.orgId = ? AND m.userId = ? ON DUPLICATE KEY UPDATE role = VALUES(role)",
+		role, projectID, orgID, userID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("SetProjectUserGrant: error executing query", "error", err)
+	}
+	return err
+}
+
+func (s *Storage) DeleteProjectUserGrant(ctx context.Context, orgID, projectID, userID int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE g FROM project_user_grants g JOIN projects p ON p.id = g.projectId WHERE g.projectId = ? AND p.orgId = ? AND g.userId = ?", projectID, orgID, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("DeleteProjectUserGrant: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// SetProjectTeamGrant grants one of the organization's teams a role on one of
+// its projects, replacing any role granted before.
+func (s *Storage) SetProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64, role string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO project_team_grants (projectId, teamId, role) SELECT p.id, t.id, ? FROM projects p JOIN teams t ON t.orgId = p.orgId WHERE p.id = ? AND p.orgId = ? AND t.id = ? ON DUPLICATE KEY UPDATE role = VALUES(role)",
+		role, projectID, orgID, teamID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("SetProjectTeamGrant: error executing query", "error", err)
+	}
+	return err
+}
+
+func (s *Storage) DeleteProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE g FROM project_team_grants g JOIN projects p ON p.id = g.projectId WHERE g.projectId = ? AND p.orgId = ? AND g.teamId = ?", projectID, orgID, teamID)
+	if err != nil {
+		logging.FromContext(ctx).Error("DeleteProjectTeamGrant: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *Storage) GetUserIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error) {
+	var i model.UserIdentity
+	err := s.db.QueryRowContext(ctx, "SELECT id, userId, issuer, subject, email, createdAt FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (s *Storage) CreateUserIdentity(ctx context.Context, i *model.UserIdentity) (*model.UserIdentity, error) {
+	result, err := s.db.ExecContext(ctx, "INSERT INTO user_identities (userId, issuer, subject, email) VALUES (?, ?, ?, ?)", i.UserID, i.Issuer, i.Subject, i.Email)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateUserIdentity: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	i.ID = id
+	i.CreatedAt = time.Now()
+	return i, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *Storage) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET password = ?, passwordResetRequired = FALSE WHERE id = ?", passwordHash, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("UpdateUserPassword: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+func (s *Storage) SetUserVerified(ctx context.Context, userID int64) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET verified = TRUE WHERE id = ?", userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("SetUserVerified: error executing query", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateUserToken stores a new token and invalidates any unused token the
+// user already holds for the same purpose, so only the latest link works.
+func (s *Storage) CreateUserToken(ctx context.Context, t *model.UserToken) (*model.UserToken, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, "UPDATE user_tokens SET usedAt = ? WHERE userId = ? AND purpose = ? AND usedAt IS NULL", now, t.UserID, t.Purpose)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateUserToken: error invalidating previous tokens", "error", err)
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO user_tokens (userId, purpose, tokenHash, expiresAt) VALUES (?, ?, ?, ?)", t.UserID, t.Purpose, t.TokenHash, t.ExpiresAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("CreateUserToken: error executing query", "error", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	t.ID = id
+	t.CreatedAt = now
+	return t, nil
+}
+
+// ConsumeUserToken atomically marks an unused, unexpired token as used and
+// returns it. sql.ErrNoRows is returned when no such token exists.
+func (s *Storage) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	now := time.Now()
+	result, err := s.db.ExecContext(ctx, "UPDATE user_tokens SET usedAt = ? WHERE tokenHash = ? AND purpose = ? AND usedAt IS NULL AND expiresAt > ?", now, tokenHash, purpose, now)
+	if err != nil {
+		logging.FromContext(ctx).Error("ConsumeUserToken: error executing query", "error", err)
+		return nil, err
+	}
+
+	if err := requireRowsAffected(result); err != nil {
+		return nil, err
+	}
+
+	var t model.UserToken
+	err = s.db.QueryRowContext(ctx, "SELECT id, userId, purpose, tokenHash, expiresAt, usedAt, createdAt FROM user_tokens WHERE tokenHash = ?", tokenHash).Scan(&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("ConsumeUserToken: error reading token", "error", err)
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// requireRowsAffected turns an update that matched nothing into sql.ErrNoRows.
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *Storage) GetUserTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error) {
+	var t model.UserTOTP
+	err := s.db.QueryRowContext(ctx, "SELECT userId, secret, enabled, lastUsedStep, createdAt FROM user_totp WHERE userId = ?", userID).Scan(&t.UserID, &t.Secret, &t.Enabled, &t.LastUsedStep, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// SaveUserTOTP stores a new pending secret for the user, replacing any
+// enrollment that was started but never confirmed.
+func (s *Storage) SaveUserTOTP(ctx context.Context, t *model.UserTOTP) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO user_totp (userId, secret, enabled, lastUsedStep) VALUES (?, ?, FALSE, 0) ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = FALSE, lastUsedStep = 0, createdAt = CURRENT_TIMESTAMP",
+		t.UserID, t.Secret,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("SaveUserTOTP: error executing query", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// EnableUserTOTP confirms enrollment and replaces the user's recovery codes.
+func (s *Storage) EnableUserTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE user_totp SET enabled = TRUE WHERE userId = ? AND enabled = FALSE", userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("EnableUserTOTP: error executing query", "error", err)
+		return err
+	}
+
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE userId = ?", userID); err != nil {
+		logging.FromContext(ctx).Error("EnableUserTOTP: error deleting recovery codes", "error", err)
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (userId, codeHash) VALUES (?, ?)", userID, hash); err != nil {
+			logging.FromContext(ctx).Error("EnableUserTOTP: error inserting recovery code", "error", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) DeleteUserTOTP(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE userId = ?", userID); err != nil {
+		logging.FromContext(ctx).Error("DeleteUserTOTP: error deleting recovery codes", "error", err)
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE userId = ?", userID); err != nil {
+		logging.FromContext(ctx).Error("DeleteUserTOTP: error executing query", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of an accepted code. It fails with
+// sql.ErrNoRows if that step, or a later one, was already used, which stops
+// a code from being replayed within its validity window.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE user_totp SET lastUsedStep = ? WHERE userId = ? AND lastUsedStep < ?", step, userID, step)
+	if err != nil {
+		logging.FromContext(ctx).Error("UseTOTPStep: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used, returning
+// sql.ErrNoRows if the user has no such code.
+func (s *Storage) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE user_recovery_codes SET usedAt = ? WHERE userId = ? AND codeHash = ? AND usedAt IS NULL", time.Now(), userID, codeHash)
+	if err != nil {
+		logging.FromContext(ctx).Error("ConsumeRecoveryCode: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
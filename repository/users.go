@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+const userColumns = "id, email, firstName, lastName, verified, COALESCE(pendingEmail, ''), timezone, locale, avatarUpdatedAt, role, deactivatedAt, passwordResetRequired, createdAt"
+
+// scanUser scans userColumns, followed by any extra columns into extra.
+func scanUser(row scanner, extra ...any) (*model.User, error) {
+	var u model.User
+	dest := append([]any{&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Verified, &u.PendingEmail, &u.Timezone, &u.Locale, &u.AvatarUpdatedAt, &u.Role, &u.DeactivatedAt, &u.PasswordResetRequired, &u.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (s *Storage) UpdateUserProfile(ctx context.Context, u *model.User) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET firstName = ?, lastName = ?, timezone = ?, locale = ? WHERE id = ? AND deletedAt IS NULL", u.FirstName, u.LastName, u.Timezone, u.Locale, u.ID)
+	if err != nil {
+		logging.FromContext(ctx).Error("UpdateUserProfile: error executing query", "error", err)
+	}
+	return err
+}
+
+func (s *Storage) SetPendingEmail(ctx context.Context, userID int64, email string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET pendingEmail = ? WHERE id = ? AND deletedAt IS NULL", email, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("SetPendingEmail: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// ConfirmEmailChange makes the pending email the user's address. It yields
+// sql.ErrNoRows when no change is pending, and ErrEmailTaken when another
+// account has claimed the address in the meantime.
+func (s *Storage) ConfirmEmailChange(ctx context.Context, userID int64) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET email = pendingEmail, pendingEmail = NULL, verified = TRUE WHERE id = ? AND pendingEmail IS NOT NULL AND deletedAt IS NULL", userID)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrEmailTaken
+		}
+		logging.FromContext(ctx).Error("ConfirmEmailChange: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// DeleteUser deletes an account. Tasks may still be assigned to the user, so
+// the row is kept but anonymised, which also frees the email address, and
+// every credential and personal record linked to it is removed.
+func (s *Storage) DeleteUser(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE users SET email = ?, firstName = '', lastName = '', password = '', pendingEmail = NULL, avatarUpdatedAt = NULL, deletedAt = ? WHERE id = ? AND deletedAt IS NULL",
+		fmt.Sprintf("deleted-%d@invalid", userID), time.Now(), userID,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("DeleteUser: error executing query", "error", err)
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"sessions", "access_tokens", "user_identities", "user_tokens", "user_totp", "user_recovery_codes", "user_avatars", "org_members", "team_members", "project_user_grants"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE userId = ?", userID); err != nil {
+			logging.FromContext(ctx).Error("DeleteUser: error deleting rows", "table", table, "error", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) SaveUserAvatar(ctx context.Context, a *model.UserAvatar) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, "INSERT INTO user_avatars (userId, contentType, data, updatedAt) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE contentType = VALUES(contentType), data = VALUES(data), updatedAt = VALUES(updatedAt)", a.UserID, a.ContentType, a.Data, now)
+	if err != nil {
+		logging.FromContext(ctx).Error("SaveUserAvatar: error executing query", "error", err)
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET avatarUpdatedAt = ? WHERE id = ?", now, a.UserID); err != nil {
+		return err
+	}
+
+	a.UpdatedAt = now
+	return tx.Commit()
+}
+
+func (s *Storage) GetUserAvatar(ctx context.Context, userID int64) (*model.UserAvatar, error) {
+	var a model.UserAvatar
+	err := s.db.QueryRowContext(ctx, "SELECT userId, contentType, data, updatedAt FROM user_avatars WHERE userId = ?", userID).Scan(&a.UserID, &a.ContentType, &a.Data, &a.UpdatedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("GetUserAvatar: error executing query", "error", err)
+		}
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *Storage) DeleteUserAvatar(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM user_avatars WHERE userId = ?", userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("DeleteUserAvatar: error executing query", "error", err)
+		return err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET avatarUpdatedAt = NULL WHERE id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListUsers returns the users matching filter, oldest first. Deleted
+// accounts are never listed.
+func (s *Storage) ListUsers(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE deletedAt IS NULL"
+	var args []any
+
+	if filter.Query != "" {
+		prefix := escapeLike(filter.Query) + "%"
+		query += " AND (email LIKE ? OR firstName LIKE ? OR lastName LIKE ?)"
+		args = append(args, prefix, prefix, prefix)
+	}
+	if filter.Role != "" {
+		query += " AND role = ?"
+		args = append(args, filter.Role)
+	}
+	if filter.Deactivated != nil {
+		if *filter.Deactivated {
+			query += " AND deactivatedAt IS NOT NULL"
+		} else {
+			query += " AND deactivatedAt IS NULL"
+		}
+	}
+
+	query += " ORDER BY id LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("ListUsers: error executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, userID int64, role string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ? AND deletedAt IS NULL", role, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("SetUserRole: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// SetUserDeactivated deactivates the account at deactivatedAt, or
+// reactivates it when deactivatedAt is nil.
+func (s *Storage) SetUserDeactivated(ctx context.Context, userID int64, deactivatedAt *time.Time) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET deactivatedAt = ? WHERE id = ? AND deletedAt IS NULL", deactivatedAt, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("SetUserDeactivated: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+func (s *Storage) SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET passwordResetRequired = ? WHERE id = ? AND deletedAt IS NULL", required, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("SetPasswordResetRequired: error executing query", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
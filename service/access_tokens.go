@@ -0,0 +1,101 @@
+package service
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+const defaultAccessTokenDays = 90
+
+type AccessTokenService struct {
+	store repository.Store
+}
+
+func NewAccessTokenService(s repository.Store) *AccessTokenService {
+	return &AccessTokenService{store: s}
+}
+
+// RegisterRoutes registers the token management endpoints. They declare no
+// scopes, so a personal access token can never be used to mint or revoke
+// other tokens, and tokens cannot be minted or revoked in a support session.
+func (s *AccessTokenService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/users/me/tokens", middleware.OwnerHandler(s.handleCreateAccessToken, s.store)).Methods("POST")
+	r.HandleFunc("/users/me/tokens", middleware.AuthHandler(s.handleListAccessTokens, s.store)).Methods("GET")
+	r.HandleFunc("/users/me/tokens/{id}", middleware.OwnerHandler(s.handleRevokeAccessToken, s.store)).Methods("DELETE")
+}
+
+func (s *AccessTokenService) handleCreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var payload model.CreateAccessTokenPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	if payload.ExpiresInDays == 0 {
+		payload.ExpiresInDays = defaultAccessTokenDays
+	}
+
+	raw, hash, err := middleware.GenerateAccessToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token")
+		return
+	}
+
+	token, err := s.store.CreateAccessToken(r.Context(), &model.AccessToken{
+		UserID:    userID,
+		Name:      payload.Name,
+		Scopes:    payload.Scopes,
+		TokenHash: hash,
+		ExpiresAt: time.Now().AddDate(0, 0, payload.ExpiresInDays),
+	})
+	if err != nil {
+		writeStoreError(w, r, err, "handleCreateAccessToken: error creating token")
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("handleCreateAccessToken: access token created", "token_id", token.ID)
+	utils.WriteJSON(w, http.StatusCreated, model.CreatedAccessToken{AccessToken: *token, Token: raw})
+}
+
+func (s *AccessTokenService) handleListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	tokens, err := s.store.ListAccessTokens(r.Context(), userID)
+	if err != nil {
+		writeStoreError(w, r, err, "handleListAccessTokens: error listing tokens")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (s *AccessTokenService) handleRevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid token id")
+		return
+	}
+
+	if err := s.store.RevokeAccessToken(r.Context(), userID, id); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Token not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error revoking token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
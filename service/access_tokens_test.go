@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// accessTokenStore keeps personal access tokens in memory, keyed by hash.
+type accessTokenStore struct {
+	repository.MockStore
+	tokens map[string]*model.AccessToken
+}
+
+func (s *accessTokenStore) CreateAccessToken(ctx context.Context, t *model.AccessToken) (*model.AccessToken, error) {
+	t.ID = int64(len(s.tokens) + 1)
+	s.tokens[t.TokenHash] = t
+	return t, nil
+}
+
+func (s *accessTokenStore) GetAccessTokenByHash(ctx context.Context, tokenHash string) (*model.AccessToken, error) {
+	t, ok := s.tokens[tokenHash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (s *accessTokenStore) TouchAccessToken(ctx context.Context, id int64, usedAt time.Time) error {
+	for _, t := range s.tokens {
+		if t.ID == id {
+			t.LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+func TestCreateAccessToken(t *testing.T) {
+	store := &accessTokenStore{tokens: map[string]*model.AccessToken{}}
+	service := NewAccessTokenService(store)
+
+	t.Run("should reject unknown scopes", func(t *testing.T) {
+		payload := &model.CreateAccessTokenPayload{Name: "ci", Scopes: []string{"admin"}}
+		rr := serve(service.handleCreateAccessToken, "/users/me/tokens", authedRequest(t, http.MethodPost, "/users/me/tokens", 7, payload))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return the token once and store only its hash", func(t *testing.T) {
+		payload := &model.CreateAccessTokenPayload{Name: "ci", Scopes: []string{model.ScopeTasksRead}}
+		rr := serve(service.handleCreateAccessToken, "/users/me/tokens", authedRequest(t, http.MethodPost, "/users/me/tokens", 7, payload))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var created model.CreatedAccessToken
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(created.Token, middleware.AccessTokenPrefix) {
+			t.Errorf("expected token to start with %q, got %q", middleware.AccessTokenPrefix, created.Token)
+		}
+
+		stored, ok := store.tokens[middleware.HashToken(created.Token)]
+		if !ok || stored.UserID != 7 {
+			t.Fatal("expected the token hash to be stored for user 7")
+		}
+
+		if days := time.Until(stored.ExpiresAt).Hours() / 24; days < defaultAccessTokenDays-1 {
+			t.Errorf("expected default expiry of %d days, got %.1f", defaultAccessTokenDays, days)
+		}
+	})
+}
+
+func TestAccessTokenAuthentication(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+
+	store := &accessTokenStore{tokens: map[string]*model.AccessToken{}}
+	add := func(raw string, token *model.AccessToken) string {
+		token.TokenHash = middleware.HashToken(raw)
+		store.tokens[token.TokenHash] = token
+		return raw
+	}
+
+	active := add("pmp_active", &model.AccessToken{ID: 1, UserID: 7, Scopes: []string{model.ScopeTasksRead}, ExpiresAt: now.Add(time.Hour)})
+	revoked := add("pmp_revoked", &model.AccessToken{ID: 2, UserID: 7, Scopes: []string{model.ScopeTasksRead}, ExpiresAt: now.Add(time.Hour), RevokedAt: &now})
+	stale := add("pmp_expired", &model.AccessToken{ID: 3, UserID: 7, Scopes: []string{model.ScopeTasksRead}, ExpiresAt: expired})
+
+	tests := []struct {
+		name   string
+		token  string
+		scopes []string
+		want   int
+	}{
+		{"should accept a token with the required scope", active, []string{model.ScopeTasksRead}, http.StatusOK},
+		{"should reject a token missing the required scope", active, []string{model.ScopeTasksWrite}, http.StatusUnauthorized},
+		{"should reject tokens on routes without scopes", active, nil, http.StatusUnauthorized},
+		{"should reject a revoked token", revoked, []string{model.ScopeTasksRead}, http.StatusUnauthorized},
+		{"should reject an expired token", stale, []string{model.ScopeTasksRead}, http.StatusUnauthorized},
+		{"should reject an unknown token", "pmp_unknown", []string{model.ScopeTasksRead}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/tasks/1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			var gotUser int64
+			handler := middleware.AuthHandler(func(w http.ResponseWriter, r *http.Request) {
+				gotUser = middleware.GetUserIDFromContext(r.Context())
+			}, store, tt.scopes...)
+
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rr.Code)
+			}
+
+			if tt.want == http.StatusOK && gotUser != 7 {
+				t.Errorf("expected user 7 in context, got %d", gotUser)
+			}
+		})
+	}
+
+	if store.tokens[middleware.HashToken(active)].LastUsedAt == nil {
+		t.Error("expected last used time to be recorded")
+	}
+}
@@ -0,0 +1,460 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultUserPageSize  = 50
+	maxUserPageSize      = 200
+	defaultAuditPageSize = 100
+)
+
+var errInvalidRole = fmt.Errorf("role must be one of %s", strings.Join(model.Roles, ", "))
+var errSelfAdministration = errors.New("administrators cannot do this to their own account")
+
+type AdminService struct {
+	store repository.Store
+	users *UserService
+}
+
+func NewAdminService(s repository.Store, m mailer.Mailer) *AdminService {
+	return &AdminService{store: s, users: NewUserService(s, m)}
+}
+
+func (s *AdminService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/lockouts", middleware.AdminHandler(s.handleListLockouts, s.store)).Methods("GET")
+	r.HandleFunc("/admin/lockouts/{scope}/{key}", middleware.AdminHandler(s.handleClearLockout, s.store)).Methods("DELETE")
+	r.HandleFunc("/admin/users", middleware.AdminHandler(s.handleListUsers, s.store)).Methods("GET")
+	r.HandleFunc("/admin/users/{id}", middleware.AdminHandler(s.handleGetUser, s.store)).Methods("GET")
+	r.HandleFunc("/admin/users/{id}/role", middleware.AdminHandler(s.handleSetRole, s.store)).Methods("PUT")
+	r.HandleFunc("/admin/users/{id}/deactivate", middleware.AdminHandler(s.handleDeactivateUser, s.store)).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/reactivate", middleware.AdminHandler(s.handleReactivateUser, s.store)).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/password-reset", middleware.AdminHandler(s.handleForcePasswordReset, s.store)).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/impersonate", middleware.AdminHandler(s.handleImpersonate, s.store)).Methods("POST")
+	r.HandleFunc("/admin/audit", middleware.AdminHandler(s.handleListAuditEvents, s.store)).Methods("GET")
+}
+
+func (s *AdminService) handleListLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := s.store.ListLoginLockouts(r.Context(), time.Now())
+	if err != nil {
+		writeStoreError(w, r, err, "handleListLockouts: error listing lockouts")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, lockouts)
+}
+
+func (s *AdminService) handleClearLockout(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scope := vars["scope"]
+	key := vars["key"]
+
+	switch scope {
+	case model.LoginScopeAccount:
+		key = normalizeEmail(key)
+	case model.LoginScopeIP, model.LoginScopeShareLink:
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "scope must be account, ip or share_link")
+		return
+	}
+
+	if err := s.store.ClearLoginThrottle(r.Context(), scope, key); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Lockout not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error clearing lockout")
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("handleClearLockout: lockout cleared", "scope", scope, "key", logging.PII(key))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListUsers lists users, optionally filtered by a search query (q),
+// role and status (active or deactivated), a page at a time.
+func (s *AdminService) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := model.UserFilter{Query: q.Get("q"), Role: q.Get("role")}
+
+	if filter.Role != "" && !slices.Contains(model.Roles, filter.Role) {
+		utils.WriteError(w, http.StatusBadRequest, errInvalidRole.Error())
+		return
+	}
+
+	switch q.Get("status") {
+	case "":
+	case "active":
+		filter.Deactivated = new(bool)
+	case "deactivated":
+		deactivated := true
+		filter.Deactivated = &deactivated
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "status must be active or deactivated")
+		return
+	}
+
+	var err error
+	if filter.Limit, err = intParam(q.Get("limit"), defaultUserPageSize, 1, maxUserPageSize); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "limit "+err.Error())
+		return
+	}
+	if filter.Offset, err = intParam(q.Get("offset"), 0, 0, -1); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "offset "+err.Error())
+		return
+	}
+
+	users, err := s.store.ListUsers(r.Context(), filter)
+	if err != nil {
+		writeStoreError(w, r, err, "handleListUsers: error listing users")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, users)
+}
+
+func (s *AdminService) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (s *AdminService) handleSetRole(w http.ResponseWriter, r *http.Request) {
+	var payload model.SetRolePayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	user, ok := s.otherUser(w, r)
+	if !ok {
+		return
+	}
+
+	// MySQL does not count rows an update leaves as they were, so the
+	// store would not find the user
+	if payload.Role == user.Role {
+		utils.WriteJSON(w, http.StatusOK, user)
+		return
+	}
+
+	if err := s.store.SetUserRole(r.Context(), user.ID, payload.Role); err != nil {
+		writeStoreError(w, r, err, "handleSetRole: error changing role")
+		return
+	}
+
+	s.audit(r, model.AuditRoleChanged, user.ID, user.Role+" -> "+payload.Role)
+	user.Role = payload.Role
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+// handleDeactivateUser disables an account and signs it out everywhere.
+// Personal access tokens stop working too, as AuthHandler rejects
+// deactivated users.
+func (s *AdminService) handleDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.otherUser(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if err := s.store.SetUserDeactivated(r.Context(), user.ID, &now); err != nil {
+		writeStoreError(w, r, err, "handleDeactivateUser: error deactivating user")
+		return
+	}
+
+	if _, err := s.store.RevokeOtherSessions(r.Context(), user.ID, ""); err != nil {
+		logging.FromContext(r.Context()).Error("handleDeactivateUser: error revoking sessions", "target_user_id", user.ID, "error", err)
+	}
+
+	s.audit(r, model.AuditUserDeactivated, user.ID, "")
+	user.DeactivatedAt = &now
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (s *AdminService) handleReactivateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.otherUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt == nil {
+		utils.WriteJSON(w, http.StatusOK, user)
+		return
+	}
+
+	if err := s.store.SetUserDeactivated(r.Context(), user.ID, nil); err != nil {
+		writeStoreError(w, r, err, "handleReactivateUser: error reactivating user")
+		return
+	}
+
+	s.audit(r, model.AuditUserReactivated, user.ID, "")
+	user.DeactivatedAt = nil
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+// handleForcePasswordReset signs the user out everywhere, revokes their
+// access tokens, blocks password logins and emails them a reset link. Logging in works again once the
+// password has been reset.
+func (s *AdminService) handleForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	// a reset forced again still signs the user out and resends the link
+	if !user.PasswordResetRequired {
+		if err := s.store.SetPasswordResetRequired(r.Context(), user.ID, true); err != nil {
+			writeStoreError(w, r, err, "handleForcePasswordReset: error forcing password reset")
+			return
+		}
+	}
+
+	if _, err := s.store.RevokeOtherSessions(r.Context(), user.ID, ""); err != nil {
+		logging.FromContext(r.Context()).Error("handleForcePasswordReset: error revoking sessions", "target_user_id", user.ID, "error", err)
+	}
+	if _, err := s.store.RevokeUserAccessTokens(r.Context(), user.ID); err != nil {
+		logging.FromContext(r.Context()).Error("handleForcePasswordReset: error revoking access tokens", "target_user_id", user.ID, "error", err)
+	}
+
+	s.audit(r, model.AuditPasswordResetForced, user.ID, "")
+
+	if err := s.users.sendPasswordResetEmail(r.Context(), user); err != nil {
+		logging.FromContext(r.Context()).Error("handleForcePasswordReset: error sending reset email", "target_user_id", user.ID, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "error sending password reset email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleImpersonate starts a short support session as another user. The
+// token is returned rather than set as a cookie so the administrator's own
+// session stays intact. Requests made with it are logged, and the session
+// shows up in the user's session list.
+func (s *AdminService) handleImpersonate(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.otherUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.Role == model.RoleAdmin {
+		utils.WriteError(w, http.StatusForbidden, "administrators cannot be impersonated")
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		utils.WriteError(w, http.StatusConflict, "user is deactivated")
+		return
+	}
+
+	session, err := newSession(r, user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+
+	adminID := middleware.GetUserIDFromContext(r.Context())
+	session.ImpersonatorID = &adminID
+	session.Device = fmt.Sprintf("Support session (admin %d)", adminID)
+	session.ExpiresAt = time.Now().Add(config.Envs.ImpersonationTTL)
+
+	if session, err = s.store.CreateSession(r.Context(), session); err != nil {
+		writeStoreError(w, r, err, "handleImpersonate: error creating token session")
+		return
+	}
+
+	// no audit record, no support session
+	if err := s.audit(r, model.AuditImpersonationStarted, user.ID, "session expires "+session.ExpiresAt.UTC().Format(time.RFC3339)); err != nil {
+		s.store.RevokeSession(r.Context(), user.ID, session.ID)
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+
+	csrfToken, _, err := middleware.GenerateToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+
+	token, err := middleware.CreateJWT(user.ID, session.ID, csrfToken)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, model.ImpersonationToken{Token: token, ExpiresAt: session.ExpiresAt})
+}
+
+// handleListAuditEvents lists the most recent administrative actions,
+// optionally only those about one user.
+func (s *AdminService) handleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	targetUserID, err := intParam(q.Get("user"), 0, 1, -1)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "user "+err.Error())
+		return
+	}
+
+	limit, err := intParam(q.Get("limit"), defaultAuditPageSize, 1, maxUserPageSize)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "limit "+err.Error())
+		return
+	}
+
+	events, err := s.store.ListAuditEvents(r.Context(), int64(targetUserID), limit)
+	if err != nil {
+		writeStoreError(w, r, err, "handleListAuditEvents: error listing audit events")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, events)
+}
+
+// targetUser loads the user named in the path, writing the error response
+// if there is none.
+func (s *AdminService) targetUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	id := mux.Vars(r)["id"]
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid user id")
+		return nil, false
+	}
+
+	user, err := s.store.GetUserByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "User not found")
+			return nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error loading user")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// otherUser is targetUser for actions an administrator must not take on
+// their own account, which would risk locking every admin out.
+func (s *AdminService) otherUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user, ok := s.targetUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if user.ID == middleware.GetUserIDFromContext(r.Context()) {
+		utils.WriteError(w, http.StatusForbidden, errSelfAdministration.Error())
+		return nil, false
+	}
+
+	return user, true
+}
+
+// audit records an administrative action. Most actions have already been
+// taken when they are audited, so callers may ignore a failure, which is
+// logged here.
+func (s *AdminService) audit(r *http.Request, action string, targetUserID int64, detail string) error {
+	actorID := middleware.GetUserIDFromContext(r.Context())
+	_, err := s.store.CreateAuditEvent(r.Context(), &model.AuditEvent{
+		ActorID:      &actorID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Detail:       detail,
+		IP:           middleware.ClientIP(r),
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("audit: error recording event", "action", action, "target_user_id", targetUserID, "error", err)
+	}
+	return err
+}
+
+// BootstrapAdmins promotes the accounts listed in ADMIN_EMAILS to admins, so
+// a fresh installation has someone to manage it. Accounts that do not exist
+// yet, or that still need to verify their email, are skipped.
+func BootstrapAdmins(ctx context.Context, store repository.Store, emails []string) {
+	for _, email := range emails {
+		user, err := store.GetUserByEmail(ctx, email)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				logging.FromContext(ctx).Error("BootstrapAdmins: error looking up user", "email", logging.PII(email), "error", err)
+			}
+			continue
+		}
+
+		if user.Role == model.RoleAdmin {
+			continue
+		}
+
+		if config.Envs.RequireEmailVerification && !user.Verified {
+			logging.FromContext(ctx).Warn("BootstrapAdmins: not promoting user until their email is verified", "user_id", user.ID)
+			continue
+		}
+
+		if err := PromoteAdmin(ctx, store, user, "bootstrapped from ADMIN_EMAILS"); err != nil {
+			logging.FromContext(ctx).Error("BootstrapAdmins: error promoting user", "user_id", user.ID, "error", err)
+		}
+	}
+}
+
+// PromoteAdmin makes user an admin on behalf of the server rather than of
+// another administrator, as when bootstrapping the first admin.
+func PromoteAdmin(ctx context.Context, store repository.Store, user *model.User, reason string) error {
+	if user.Role == model.RoleAdmin {
+		logging.FromContext(ctx).Info("PromoteAdmin: user is already an admin", "user_id", user.ID)
+		return nil
+	}
+
+	if err := store.SetUserRole(ctx, user.ID, model.RoleAdmin); err != nil {
+		return err
+	}
+
+	_, err := store.CreateAuditEvent(ctx, &model.AuditEvent{
+		Action:       model.AuditRoleChanged,
+		TargetUserID: user.ID,
+		Detail:       user.Role + " -> " + model.RoleAdmin + " (" + reason + ")",
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("PromoteAdmin: user is now an admin", "user_id", user.ID, "reason", reason)
+	return nil
+}
+
+// intParam parses an optional integer query parameter between min and max,
+// where a negative max means no upper bound.
+func intParam(value string, fallback, min, max int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || (max >= 0 && n > max) {
+		if max < 0 {
+			return 0, fmt.Errorf("must be an integer of at least %d", min)
+		}
+		return 0, fmt.Errorf("must be an integer between %d and %d", min, max)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/gorilla/mux"
+)
+
+// adminStore adds users with roles and an audit log to sessionStore.
+type adminStore struct {
+	*sessionStore
+	users  map[int64]*model.User
+	events []model.AuditEvent
+	// revokedTokens lists the users whose access tokens were revoked.
+	revokedTokens []int64
+}
+
+func newAdminStore() *adminStore {
+	return &adminStore{
+		sessionStore: newSessionStore(),
+		users: map[int64]*model.User{
+			1: {ID: 1, Email: "admin@mail.com", Role: model.RoleAdmin, Verified: true},
+			7: {ID: 7, Email: "joe@mail.com", Role: model.RoleUser, Verified: true},
+			8: {ID: 8, Email: "guest@mail.com", Role: model.RoleGuest, Verified: true},
+		},
+	}
+}
+
+func (s *adminStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	userID, _ := strconv.ParseInt(id, 10, 64)
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	clone := *u
+	return &clone, nil
+}
+
+func (s *adminStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, u := range s.users {
+		if u.Email == email {
+			clone := *u
+			return &clone, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// The setters fail like the MySQL store when they change nothing, as MySQL
+// does not count rows an update leaves as they were.
+
+func (s *adminStore) SetUserRole(ctx context.Context, userID int64, role string) error {
+	if s.users[userID].Role == role {
+		return sql.ErrNoRows
+	}
+	s.users[userID].Role = role
+	return nil
+}
+
+func (s *adminStore) SetUserDeactivated(ctx context.Context, userID int64, deactivatedAt *time.Time) error {
+	if deactivatedAt == nil && s.users[userID].DeactivatedAt == nil {
+		return sql.ErrNoRows
+	}
+	s.users[userID].DeactivatedAt = deactivatedAt
+	return nil
+}
+
+func (s *adminStore) SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error {
+	if s.users[userID].PasswordResetRequired == required {
+		return sql.ErrNoRows
+	}
+	s.users[userID].PasswordResetRequired = required
+	return nil
+}
+
+func (s *adminStore) RevokeUserAccessTokens(ctx context.Context, userID int64) (int64, error) {
+	s.revokedTokens = append(s.revokedTokens, userID)
+	return 1, nil
+}
+
+func (s *adminStore) CreateAuditEvent(ctx context.Context, e *model.AuditEvent) (*model.AuditEvent, error) {
+	e.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, *e)
+	return e, nil
+}
+
+// adminRequest sends payload to handler behind AdminHandler with the given
+// session token.
+func adminRequest(t *testing.T, store *adminStore, handler http.HandlerFunc, method, path, pathTemplate, token string, payload any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return serve(middleware.AdminHandler(handler, store), pathTemplate, req)
+}
+
+func TestRequireRole(t *testing.T) {
+	store := newAdminStore()
+	handler := middleware.RequireRole(model.RoleUser, func(w http.ResponseWriter, r *http.Request) {}, store)
+
+	tests := []struct {
+		name   string
+		userID int64
+		want   int
+	}{
+		{"should let users write", 7, http.StatusOK},
+		{"should let admins write", 1, http.StatusOK},
+		{"should keep guests read-only", 8, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := login(t, store, tt.userID, "")
+
+			rr := withSession(store, handler, http.MethodPost, "/projects", "/projects", token)
+			if rr.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should keep non-admins out of admin routes", func(t *testing.T) {
+		service := NewAdminService(store, &mailer.MockMailer{})
+		token := login(t, store, 7, "")
+
+		rr := adminRequest(t, store, service.handleListUsers, http.MethodGet, "/admin/users", "/admin/users", token, nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	t.Run("should change roles and audit the change", func(t *testing.T) {
+		store := newAdminStore()
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+
+		rr := adminRequest(t, store, service.handleSetRole, http.MethodPut, "/admin/users/8/role", "/admin/users/{id}/role", admin, &model.SetRolePayload{Role: model.RoleUser})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if store.users[8].Role != model.RoleUser {
+			t.Errorf("expected role %q, got %q", model.RoleUser, store.users[8].Role)
+		}
+
+		if len(store.events) != 1 || store.events[0].Action != model.AuditRoleChanged || *store.events[0].ActorID != 1 || store.events[0].TargetUserID != 8 {
+			t.Errorf("unexpected audit log %+v", store.events)
+		}
+	})
+
+	t.Run("should reject unknown roles", func(t *testing.T) {
+		store := newAdminStore()
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+
+		rr := adminRequest(t, store, service.handleSetRole, http.MethodPut, "/admin/users/7/role", "/admin/users/{id}/role", admin, &model.SetRolePayload{Role: "root"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not let admins demote themselves", func(t *testing.T) {
+		store := newAdminStore()
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+
+		rr := adminRequest(t, store, service.handleSetRole, http.MethodPut, "/admin/users/1/role", "/admin/users/{id}/role", admin, &model.SetRolePayload{Role: model.RoleUser})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should sign deactivated users out", func(t *testing.T) {
+		store := newAdminStore()
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+		joe := login(t, store, 7, "")
+
+		rr := adminRequest(t, store, service.handleDeactivateUser, http.MethodPost, "/admin/users/7/deactivate", "/admin/users/{id}/deactivate", admin, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = withSession(store, func(w http.ResponseWriter, r *http.Request) {}, http.MethodGet, "/projects/1", "/projects/{id}", joe)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		rr = adminRequest(t, store, service.handleReactivateUser, http.MethodPost, "/admin/users/7/reactivate", "/admin/users/{id}/reactivate", admin, nil)
+		if rr.Code != http.StatusOK || store.users[7].DeactivatedAt != nil {
+			t.Errorf("expected user to be reactivated, got %d", rr.Code)
+		}
+
+		if len(store.events) != 2 {
+			t.Errorf("expected 2 audit events, got %+v", store.events)
+		}
+	})
+
+	t.Run("should force a password reset", func(t *testing.T) {
+		store := newAdminStore()
+		m := &mailer.MockMailer{}
+		service := NewAdminService(store, m)
+		admin := login(t, store, 1, "")
+		joe := login(t, store, 7, "")
+
+		rr := adminRequest(t, store, service.handleForcePasswordReset, http.MethodPost, "/admin/users/7/password-reset", "/admin/users/{id}/password-reset", admin, nil)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if !store.users[7].PasswordResetRequired {
+			t.Error("expected a password reset to be required")
+		}
+
+		if len(m.Sent) != 1 || m.Sent[0].To != "joe@mail.com" {
+			t.Errorf("expected a reset email to joe@mail.com, got %+v", m.Sent)
+		}
+
+		rr = withSession(store, func(w http.ResponseWriter, r *http.Request) {}, http.MethodGet, "/projects/1", "/projects/{id}", joe)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected existing sessions to be revoked, got %d", rr.Code)
+		}
+
+		if len(store.revokedTokens) != 1 || store.revokedTokens[0] != 7 {
+			t.Errorf("expected the access tokens of user 7 to be revoked, got %v", store.revokedTokens)
+		}
+	})
+
+	t.Run("should accept changes that change nothing", func(t *testing.T) {
+		store := newAdminStore()
+		m := &mailer.MockMailer{}
+		service := NewAdminService(store, m)
+		admin := login(t, store, 1, "")
+
+		rr := adminRequest(t, store, service.handleSetRole, http.MethodPut, "/admin/users/7/role", "/admin/users/{id}/role", admin, &model.SetRolePayload{Role: model.RoleUser})
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d for the current role, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = adminRequest(t, store, service.handleReactivateUser, http.MethodPost, "/admin/users/7/reactivate", "/admin/users/{id}/reactivate", admin, nil)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d for an active user, got %d", http.StatusOK, rr.Code)
+		}
+
+		for i := 0; i < 2; i++ {
+			rr = adminRequest(t, store, service.handleForcePasswordReset, http.MethodPost, "/admin/users/7/password-reset", "/admin/users/{id}/password-reset", admin, nil)
+			if rr.Code != http.StatusNoContent {
+				t.Errorf("expected status code %d for reset %d, got %d", http.StatusNoContent, i+1, rr.Code)
+			}
+		}
+		if len(m.Sent) != 2 {
+			t.Errorf("expected a reset email each time, got %d", len(m.Sent))
+		}
+
+		if err := PromoteAdmin(context.Background(), store, store.users[1], "test"); err != nil {
+			t.Errorf("expected promoting an admin to succeed, got %v", err)
+		}
+	})
+}
+
+func TestImpersonation(t *testing.T) {
+	t.Run("should act as the user and record who is acting", func(t *testing.T) {
+		store := newAdminStore()
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+
+		rr := adminRequest(t, store, service.handleImpersonate, http.MethodPost, "/admin/users/7/impersonate", "/admin/users/{id}/impersonate", admin, nil)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var impersonation model.ImpersonationToken
+		if err := json.NewDecoder(rr.Body).Decode(&impersonation); err != nil {
+			t.Fatal(err)
+		}
+
+		var userID, impersonatorID int64
+		rr = withSession(store, func(w http.ResponseWriter, r *http.Request) {
+			userID = middleware.GetUserIDFromContext(r.Context())
+			impersonatorID = middleware.GetImpersonatorIDFromContext(r.Context())
+		}, http.MethodGet, "/projects/1", "/projects/{id}", impersonation.Token)
+
+		if rr.Code != http.StatusOK || userID != 7 || impersonatorID != 1 {
+			t.Errorf("expected admin 1 acting as user 7, got %d acting as %d (%d)", impersonatorID, userID, rr.Code)
+		}
+
+		if len(store.events) != 1 || store.events[0].Action != model.AuditImpersonationStarted {
+			t.Errorf("unexpected audit log %+v", store.events)
+		}
+	})
+
+	t.Run("should not mint credentials for the user", func(t *testing.T) {
+		store := newAdminStore()
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+
+		rr := adminRequest(t, store, service.handleImpersonate, http.MethodPost, "/admin/users/7/impersonate", "/admin/users/{id}/impersonate", admin, nil)
+		var impersonation model.ImpersonationToken
+		if err := json.NewDecoder(rr.Body).Decode(&impersonation); err != nil {
+			t.Fatal(err)
+		}
+
+		router := mux.NewRouter()
+		NewAccessTokenService(store).RegisterRoutes(router)
+		rr = orgRequest(t, router, http.MethodPost, "/users/me/tokens", impersonation.Token, "", &model.CreateAccessTokenPayload{Name: "support", Scopes: []string{model.ScopeTasksRead}})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should not sign the user out", func(t *testing.T) {
+		store := newAdminStore()
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+		joe := login(t, store, 7, "")
+
+		rr := adminRequest(t, store, service.handleImpersonate, http.MethodPost, "/admin/users/7/impersonate", "/admin/users/{id}/impersonate", admin, nil)
+		var impersonation model.ImpersonationToken
+		if err := json.NewDecoder(rr.Body).Decode(&impersonation); err != nil {
+			t.Fatal(err)
+		}
+
+		var joeSession string
+		for id, sess := range store.sessions {
+			if sess.UserID == 7 && sess.ImpersonatorID == nil {
+				joeSession = id
+			}
+		}
+
+		router := mux.NewRouter()
+		NewSessionService(store).RegisterRoutes(router)
+		NewAccessTokenService(store).RegisterRoutes(router)
+		for _, path := range []string{"/users/me/sessions", "/users/me/sessions/" + joeSession, "/users/me/tokens/1"} {
+			rr = orgRequest(t, router, http.MethodDelete, path, impersonation.Token, "", nil)
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("DELETE %s: expected status code %d, got %d", path, http.StatusForbidden, rr.Code)
+			}
+		}
+
+		rr = withSession(store, func(w http.ResponseWriter, r *http.Request) {}, http.MethodGet, "/projects/1", "/projects/{id}", joe)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected the user's own session to survive, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should not impersonate administrators", func(t *testing.T) {
+		store := newAdminStore()
+		store.users[2] = &model.User{ID: 2, Email: "other-admin@mail.com", Role: model.RoleAdmin}
+		service := NewAdminService(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+
+		rr := adminRequest(t, store, service.handleImpersonate, http.MethodPost, "/admin/users/2/impersonate", "/admin/users/{id}/impersonate", admin, nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		if len(store.sessions) != 1 {
+			t.Errorf("expected no support session, got %d sessions", len(store.sessions))
+		}
+	})
+}
+
+func TestBootstrapAdmins(t *testing.T) {
+	store := newAdminStore()
+
+	BootstrapAdmins(context.Background(), store, []string{"joe@mail.com", "nobody@mail.com"})
+
+	if store.users[7].Role != model.RoleAdmin {
+		t.Errorf("expected joe to be promoted, got role %q", store.users[7].Role)
+	}
+
+	if len(store.events) != 1 || store.events[0].ActorID != nil {
+		t.Errorf("expected one audit event without an actor, got %+v", store.events)
+	}
+}
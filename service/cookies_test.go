@@ -0,0 +1,117 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+)
+
+// browserLogin logs userID in and returns the cookies a browser would keep.
+func browserLogin(t *testing.T, store *sessionStore, userID int64) (session, csrf *http.Cookie) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	if _, err := createAndSetAuthCookie(store, rr, httptest.NewRequest(http.MethodPost, "/users/login", nil), userID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range rr.Result().Cookies() {
+		switch c.Name {
+		case middleware.SessionCookie:
+			session = c
+		case middleware.CSRFCookie:
+			csrf = c
+		}
+	}
+
+	if session == nil || csrf == nil {
+		t.Fatal("expected session and CSRF cookies to be set")
+	}
+
+	return session, csrf
+}
+
+func TestCookieAuth(t *testing.T) {
+	store := newSessionStore()
+	session, csrf := browserLogin(t, store, 7)
+
+	handler := middleware.AuthHandler(func(w http.ResponseWriter, r *http.Request) {}, store)
+	request := func(method, csrfHeader string) int {
+		req := httptest.NewRequest(method, "/projects", nil)
+		req.AddCookie(session)
+		req.AddCookie(csrf)
+		if csrfHeader != "" {
+			req.Header.Set(middleware.CSRFHeader, csrfHeader)
+		}
+		return serve(handler, "/projects", req).Code
+	}
+
+	t.Run("should harden the session cookie", func(t *testing.T) {
+		if !session.HttpOnly || session.SameSite != http.SameSiteLaxMode || session.Path != "/api/v1" || session.Expires.IsZero() {
+			t.Errorf("unexpected session cookie attributes %+v", session)
+		}
+
+		if csrf.HttpOnly {
+			t.Error("expected the CSRF cookie to be readable by scripts")
+		}
+	})
+
+	t.Run("should accept safe requests authenticated by cookie", func(t *testing.T) {
+		if code := request(http.MethodGet, ""); code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, code)
+		}
+	})
+
+	t.Run("should reject state-changing requests without the CSRF header", func(t *testing.T) {
+		if code := request(http.MethodPost, ""); code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, code)
+		}
+	})
+
+	t.Run("should reject a CSRF token from another session", func(t *testing.T) {
+		_, other := browserLogin(t, store, 7)
+		if code := request(http.MethodDelete, other.Value); code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, code)
+		}
+	})
+
+	t.Run("should accept state-changing requests with the CSRF header", func(t *testing.T) {
+		if code := request(http.MethodPost, csrf.Value); code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, code)
+		}
+	})
+
+	t.Run("should not require CSRF tokens with the Authorization header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/projects", nil)
+		req.Header.Set("Authorization", "Bearer "+session.Value)
+
+		if rr := serve(handler, "/projects", req); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should end the session on logout", func(t *testing.T) {
+		service := NewSessionService(store)
+
+		req := httptest.NewRequest(http.MethodPost, "/users/logout", nil)
+		req.AddCookie(session)
+		req.Header.Set(middleware.CSRFHeader, csrf.Value)
+
+		rr := serve(middleware.AuthHandler(service.handleLogout, store), "/users/logout", req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == middleware.SessionCookie && c.MaxAge >= 0 {
+				t.Error("expected the session cookie to be cleared")
+			}
+		}
+
+		if code := request(http.MethodGet, ""); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d after logout, got %d", http.StatusUnauthorized, code)
+		}
+	})
+}
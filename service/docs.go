@@ -0,0 +1,41 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/openapi"
+	"github.com/gorilla/mux"
+)
+
+// DocsService serves the OpenAPI document of the API and a page rendering
+// it. The document is built once, as it only changes with the code.
+type DocsService struct {
+	spec []byte
+}
+
+func NewDocsService() *DocsService {
+	spec, err := json.Marshal(openapi.Build())
+	if err != nil {
+		panic("NewDocsService: " + err.Error())
+	}
+	return &DocsService{spec: spec}
+}
+
+func (s *DocsService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/openapi.json", s.handleSpec).Methods("GET")
+	r.HandleFunc("/docs", s.handleDocs).Methods("GET")
+}
+
+func (s *DocsService) handleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(s.spec)
+}
+
+func (s *DocsService) handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(openapi.DocsPage)
+}
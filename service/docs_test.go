@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/openapi"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPI(t *testing.T) {
+	store := &repository.MockStore{}
+	router := mux.NewRouter()
+	subRouter := router.PathPrefix(openapi.BasePath).Subrouter()
+	orgRouter := subRouter.PathPrefix(openapi.OrgPrefix).Subrouter()
+	NewUserService(store, &mailer.MockMailer{}).RegisterRoutes(subRouter)
+	for _, r := range []*mux.Router{subRouter, orgRouter} {
+		NewProjectService(store).RegisterRoutes(r)
+		NewTaskService(store).RegisterRoutes(r)
+	}
+
+	doc := openapi.Build()
+
+	t.Run("should describe every registered route", func(t *testing.T) {
+		registered := map[string]bool{}
+		err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			methods, err := route.GetMethods()
+			if err != nil {
+				// subrouter prefixes match no method of their own
+				return nil
+			}
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return err
+			}
+
+			path = strings.TrimPrefix(path, openapi.BasePath)
+			for _, method := range methods {
+				registered[method+" "+path] = true
+				if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+					t.Errorf("%s %s is missing from the OpenAPI document", method, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for path, item := range doc.Paths {
+			for method := range item {
+				if !registered[strings.ToUpper(method)+" "+path] {
+					t.Errorf("%s %s is documented but not registered", strings.ToUpper(method), path)
+				}
+			}
+		}
+	})
+
+	t.Run("should resolve every schema reference", func(t *testing.T) {
+		spec, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ref := range strings.Split(string(spec), `"$ref":"#/components/schemas/`)[1:] {
+			name, _, _ := strings.Cut(ref, `"`)
+			if doc.Components.Schemas[name] == nil {
+				t.Errorf("schema %s is referenced but not defined", name)
+			}
+		}
+	})
+
+	docs := NewDocsService()
+	docsRouter := mux.NewRouter()
+	docs.RegisterRoutes(docsRouter)
+
+	t.Run("should serve the document", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		docsRouter.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var served openapi.Document
+		if err := json.Unmarshal(rr.Body.Bytes(), &served); err != nil {
+			t.Fatal(err)
+		}
+		if served.OpenAPI != openapi.Version || len(served.Paths) != len(doc.Paths) {
+			t.Errorf("expected the document, got version %q with %d paths", served.OpenAPI, len(served.Paths))
+		}
+	})
+
+	t.Run("should serve the docs page", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		docsRouter.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("expected an HTML page, got %s", ct)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+)
+
+// writeStoreError answers a request whose Store call failed with err. Rows
+// that were not found are a 404, writes that violate a unique key a 409 and
+// writes based on an outdated version a 412.
+// Any other error is logged with msg and args, like slog, and answered with
+// a 500 that does not reveal it.
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, msg string, args ...any) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteError(w, http.StatusNotFound, "not found")
+	case repository.IsDuplicate(err):
+		detail := "already exists"
+		if errors.Is(err, repository.ErrDuplicate) {
+			detail = err.Error()
+		}
+		utils.WriteProblem(w, model.Problem{Status: http.StatusConflict, Code: model.ProblemAlreadyExists, Detail: detail})
+	case errors.Is(err, repository.ErrVersionConflict):
+		utils.WriteError(w, http.StatusPreconditionFailed, err.Error())
+	default:
+		logging.FromContext(r.Context()).Error(msg, append(args, "error", err)...)
+		utils.WriteError(w, http.StatusInternalServerError, "")
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+)
+
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) model.Problem {
+	t.Helper()
+
+	if ct := rr.Header().Get("Content-Type"); ct != utils.ProblemContentType {
+		t.Errorf("expected content type %s, got %s", utils.ProblemContentType, ct)
+	}
+	var problem model.Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Status != rr.Code || problem.Type != utils.ProblemTypePrefix+problem.Code {
+		t.Errorf("expected the status and type to match the response, got %+v", problem)
+	}
+	return problem
+}
+
+func TestProblems(t *testing.T) {
+	service := NewUserService(&repository.MockStore{}, &mailer.MockMailer{})
+
+	t.Run("should reject malformed JSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/users/register", strings.NewReader(`{"email":`))
+		rr := httptest.NewRecorder()
+		service.handleUserRegister(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if problem := decodeProblem(t, rr); problem.Code != model.ProblemInvalidJSON {
+			t.Errorf("expected code %s, got %s", model.ProblemInvalidJSON, problem.Code)
+		}
+	})
+
+	decodeTests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{
+			name:   "should reject unknown fields",
+			body:   `{"email":"joe@mail.com","firstName":"John","lastName":"Doe","password":"password","role":"admin"}`,
+			status: http.StatusBadRequest,
+			code:   model.ProblemValidationFailed,
+			field:  "role",
+		},
+		{
+			name:   "should reject values of the wrong type",
+			body:   `{"email":"joe@mail.com","firstName":42}`,
+			status: http.StatusBadRequest,
+			code:   model.ProblemValidationFailed,
+			field:  "firstName",
+		},
+		{
+			name:   "should reject trailing data",
+			body:   `{"email":"joe@mail.com"} {}`,
+			status: http.StatusBadRequest,
+			code:   model.ProblemInvalidJSON,
+		},
+		{
+			name:   "should limit the size of the body",
+			body:   `{"email":"` + strings.Repeat("a", int(config.Envs.MaxBodyBytes)) + `"}`,
+			status: http.StatusRequestEntityTooLarge,
+			code:   model.ProblemPayloadTooLarge,
+		},
+	}
+	for _, tt := range decodeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/register", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			service.handleUserRegister(rr, req)
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+
+			problem := decodeProblem(t, rr)
+			if problem.Code != tt.code {
+				t.Errorf("expected code %s, got %s", tt.code, problem.Code)
+			}
+			if tt.field != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != tt.field) {
+				t.Errorf("expected an error for %s, got %+v", tt.field, problem.Errors)
+			}
+		})
+	}
+
+	t.Run("should name the invalid field", func(t *testing.T) {
+		rr := postJSON(t, service.handleUserRegister, "/users/register", &model.RegisterPayload{Email: "joe@mail.com", LastName: "Doe", Password: "password"})
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		problem := decodeProblem(t, rr)
+		if problem.Code != model.ProblemValidationFailed {
+			t.Errorf("expected code %s, got %s", model.ProblemValidationFailed, problem.Code)
+		}
+		want := model.FieldError{Field: "firstName", Code: model.FieldRequired, Message: "firstName is required"}
+		if len(problem.Errors) != 1 || problem.Errors[0] != want {
+			t.Errorf("expected %+v, got %+v", want, problem.Errors)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{
+			name:   "should map missing rows to 404",
+			err:    fmt.Errorf("loading task: %w", sql.ErrNoRows),
+			status: http.StatusNotFound,
+			code:   model.ProblemNotFound,
+			detail: "not found",
+		},
+		{
+			name:   "should map duplicate keys to 409",
+			err:    repository.ErrEmailTaken,
+			status: http.StatusConflict,
+			code:   model.ProblemAlreadyExists,
+			detail: repository.ErrEmailTaken.Error(),
+		},
+		{
+			name:   "should not reveal internal errors",
+			err:    errors.New("dial tcp 10.0.0.5:3306: connection refused"),
+			status: http.StatusInternalServerError,
+			code:   model.ProblemInternalError,
+			detail: "an internal error occurred",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			writeStoreError(rr, httptest.NewRequest(http.MethodGet, "/", nil), tt.err, "TestProblems: store error")
+			if rr.Code != tt.status {
+				t.Fatalf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+
+			problem := decodeProblem(t, rr)
+			if problem.Code != tt.code || problem.Detail != tt.detail {
+				t.Errorf("expected %s %q, got %s %q", tt.code, tt.detail, problem.Code, problem.Detail)
+			}
+		})
+	}
+}
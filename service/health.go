@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/buildinfo"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+// healthCheckTimeout bounds each readiness check, so that a hanging
+// database fails the probe instead of outliving it.
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck is one condition the API needs to serve requests, such as a
+// reachable database.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthService serves the probes of load balancers and orchestrators and,
+// when enabled, the Go profiler.
+type HealthService struct {
+	store  repository.Store
+	checks []HealthCheck
+}
+
+func NewHealthService(store repository.Store, checks ...HealthCheck) *HealthService {
+	return &HealthService{store: store, checks: checks}
+}
+
+// RegisterRoutes expects the root router, as probes live outside the API
+// prefix.
+func (s *HealthService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", s.handleHealthz).Methods("GET")
+	r.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
+}
+
+// RegisterProfilingRoutes serves the Go profiler under /debug/pprof to
+// administrators. Profiles reveal the internals of the process and cost CPU
+// while they are taken, so they are only registered when enabled.
+func (s *HealthService) RegisterProfilingRoutes(r *mux.Router) {
+	debug := r.PathPrefix("/debug/pprof").Subrouter()
+	debug.HandleFunc("/cmdline", middleware.AdminHandler(pprof.Cmdline, s.store)).Methods("GET")
+	debug.HandleFunc("/profile", middleware.AdminHandler(pprof.Profile, s.store)).Methods("GET")
+	debug.HandleFunc("/symbol", middleware.AdminHandler(pprof.Symbol, s.store)).Methods("GET", "POST")
+	debug.HandleFunc("/trace", middleware.AdminHandler(pprof.Trace, s.store)).Methods("GET")
+	debug.PathPrefix("/").HandlerFunc(middleware.AdminHandler(pprof.Index, s.store)).Methods("GET")
+}
+
+// handleHealthz tells that the process is up. It checks nothing else, so
+// that an unreachable database does not get the API restarted.
+func (s *HealthService) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	info := buildinfo.Get()
+	utils.WriteJSON(w, http.StatusOK, model.HealthStatus{Status: "ok", Version: info.Version, Commit: info.Commit})
+}
+
+// handleReadyz tells whether the API can serve requests. Failures are
+// logged rather than returned, as the probe is public.
+func (s *HealthService) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status := model.HealthStatus{Status: "ok", Checks: make(map[string]string, len(s.checks))}
+	code := http.StatusOK
+
+	for _, check := range s.checks {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		err := check.Check(ctx)
+		cancel()
+
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("handleReadyz: check failed", "check", check.Name, "error", err)
+			status.Checks[check.Name] = "failing"
+			status.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		status.Checks[check.Name] = "ok"
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, code, status)
+}
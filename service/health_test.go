@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/gorilla/mux"
+)
+
+func TestHealth(t *testing.T) {
+	var dbErr error
+	store := newAdminStore()
+	service := NewHealthService(store,
+		HealthCheck{Name: "database", Check: func(ctx context.Context) error { return dbErr }},
+		HealthCheck{Name: "migrations", Check: func(ctx context.Context) error { return nil }},
+	)
+	router := mux.NewRouter()
+	service.RegisterRoutes(router)
+	service.RegisterProfilingRoutes(router)
+
+	get := func(path, token string) (*httptest.ResponseRecorder, model.HealthStatus) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var status model.HealthStatus
+		json.Unmarshal(rr.Body.Bytes(), &status)
+		return rr, status
+	}
+
+	t.Run("should report liveness with the build", func(t *testing.T) {
+		dbErr = errors.New("connection refused")
+		rr, status := get("/healthz", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if status.Status != "ok" || status.Version == "" || status.Commit == "" {
+			t.Errorf("expected the build info, got %+v", status)
+		}
+	})
+
+	t.Run("should be ready when every check passes", func(t *testing.T) {
+		dbErr = nil
+		rr, status := get("/readyz", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if status.Checks["database"] != "ok" || status.Checks["migrations"] != "ok" {
+			t.Errorf("expected every check to pass, got %+v", status)
+		}
+	})
+
+	t.Run("should not be ready when the database is down", func(t *testing.T) {
+		dbErr = errors.New("dial tcp 10.0.0.5:3306: connection refused")
+		rr, status := get("/readyz", "")
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected status code %d, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+		if status.Checks["database"] != "failing" || status.Checks["migrations"] != "ok" {
+			t.Errorf("expected the database check to fail, got %+v", status)
+		}
+		if body := rr.Body.String(); strings.Contains(body, "10.0.0.5") {
+			t.Errorf("expected the error to stay internal, got %s", body)
+		}
+	})
+
+	t.Run("should only let administrators profile", func(t *testing.T) {
+		if rr, _ := get("/debug/pprof/cmdline", ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+		if rr, _ := get("/debug/pprof/cmdline", login(t, store, 7, "")); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if rr, _ := get("/debug/pprof/goroutine?debug=1", login(t, store, 1, "")); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
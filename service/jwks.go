@@ -0,0 +1,40 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+// JWKSService publishes the public keys our JWTs are signed with, so other
+// services can verify them without sharing a secret.
+type JWKSService struct {
+	keys *keyring.Keyring
+}
+
+func NewJWKSService(k *keyring.Keyring) *JWKSService {
+	return &JWKSService{keys: k}
+}
+
+// RegisterRoutes expects the root router, as the JWKS lives at a well-known
+// path outside the API prefix.
+func (s *JWKSService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/.well-known/jwks.json", s.handleJWKS).Methods("GET")
+}
+
+func (s *JWKSService) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := s.keys.JWKS()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("handleJWKS: error loading keys", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "error loading keys")
+		return
+	}
+
+	// verifiers refetch on unknown kids, and scheduled keys are published
+	// well before use, so a short cache is enough
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSON(w, http.StatusOK, set)
+}
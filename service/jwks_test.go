@@ -0,0 +1,97 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/jwk"
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+)
+
+func TestJWKS(t *testing.T) {
+	pub, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := keyring.New(0, keyring.Key{ID: "k1", Method: jwt.SigningMethodEdDSA, Private: private, Public: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	middleware.SetKeyring(keys)
+	defer middleware.SetKeyring(nil)
+
+	t.Run("should publish the signing key", func(t *testing.T) {
+		rr := serve(NewJWKSService(keys).handleJWKS, "/.well-known/jwks.json", httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var set jwk.Set
+		if err := json.NewDecoder(rr.Body).Decode(&set); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(set.Keys) != 1 || set.Keys[0].Kid != "k1" || set.Keys[0].Alg != "EdDSA" {
+			t.Errorf("unexpected key set %+v", set)
+		}
+	})
+
+	t.Run("should authenticate session tokens signed with the key", func(t *testing.T) {
+		store := newSessionStore()
+		token := login(t, store, 42, "")
+
+		req := httptest.NewRequest(http.MethodGet, "/projects", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		called := false
+		handler := middleware.AuthHandler(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}, store)
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/projects", handler)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !called {
+			t.Error("expected the handler to run")
+		}
+	})
+
+	t.Run("should reject tokens signed with the legacy secret", func(t *testing.T) {
+		token, err := keyring.NewHMAC([]byte("legacy")).Sign(jwt.MapClaims{"userID": "42", "exp": 4102444800})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/projects", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		middleware.AuthHandler(func(w http.ResponseWriter, r *http.Request) {}, &repository.MockStore{})(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		var response model.Problem
+		json.NewDecoder(rr.Body).Decode(&response)
+		if response.Detail == "" || response.Code != model.ProblemUnauthorized {
+			t.Errorf("expected a problem, got %+v", response)
+		}
+	})
+}
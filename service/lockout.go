@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+)
+
+var errInvalidCredentials = errors.New("invalid email or password")
+var errTooManyAttempts = errors.New("too many failed login attempts, try again later")
+
+// dummyPasswordHash is compared against when the email is unknown, so a
+// failed login takes the same time whether or not the account exists.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := middleware.HashPassword("dummy password used for timing")
+	if err != nil {
+		slog.Error("dummyPasswordHash: error hashing password", "error", err)
+	}
+	return hash
+})
+
+type loginThrottleKey struct {
+	scope       string
+	key         string
+	maxAttempts int
+}
+
+func loginThrottleKeys(email, ip string) []loginThrottleKey {
+	return []loginThrottleKey{
+		{scope: model.LoginScopeAccount, key: normalizeEmail(email), maxAttempts: config.Envs.LoginMaxAttempts},
+		{scope: model.LoginScopeIP, key: ip, maxAttempts: config.Envs.LoginIPMaxAttempts},
+	}
+}
+
+// shareLinkThrottleKeys throttles password guesses against one share link,
+// wherever they come from.
+func shareLinkThrottleKeys(linkID int64) []loginThrottleKey {
+	return []loginThrottleKey{
+		{scope: model.LoginScopeShareLink, key: strconv.FormatInt(linkID, 10), maxAttempts: config.Envs.LoginMaxAttempts},
+	}
+}
+
+// loginRetryAfter returns how long the caller has to wait before another
+// login attempt for this email or from this IP is allowed.
+func (s *UserService) loginRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	return throttleRetryAfter(ctx, s.store, loginThrottleKeys(email, ip))
+}
+
+// recordLoginFailure counts a failed attempt against both the account and
+// the client IP and locks them once the delay policy says so.
+func (s *UserService) recordLoginFailure(ctx context.Context, email, ip string) {
+	recordThrottleFailure(ctx, s.store, loginThrottleKeys(email, ip))
+}
+
+// throttleRetryAfter returns how long the caller has to wait before every
+// one of keys allows another attempt.
+func throttleRetryAfter(ctx context.Context, store repository.Store, keys []loginThrottleKey) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now()
+
+	for _, k := range keys {
+		t, err := store.GetLoginThrottle(ctx, k.scope, k.key)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return 0, err
+		}
+
+		if t.LockedUntil != nil && t.LockedUntil.After(now) {
+			wait = max(wait, t.LockedUntil.Sub(now))
+		}
+	}
+
+	return wait, nil
+}
+
+// recordThrottleFailure counts a failed attempt against each of keys and
+// locks them once the delay policy says so.
+func recordThrottleFailure(ctx context.Context, store repository.Store, keys []loginThrottleKey) {
+	now := time.Now()
+
+	for _, k := range keys {
+		t, err := store.RecordLoginFailure(ctx, k.scope, k.key, now.Add(-config.Envs.LoginLockoutDuration))
+		if err != nil {
+			logging.FromContext(ctx).Error("recordThrottleFailure: error recording failure", "scope", k.scope, "error", err)
+			continue
+		}
+
+		delay := lockoutDelay(t.Failures, k.maxAttempts)
+		if delay == 0 {
+			continue
+		}
+
+		if t.Failures >= k.maxAttempts {
+			logging.FromContext(ctx).Warn("recordThrottleFailure: locked after too many failures", "scope", k.scope, "key", logging.PII(k.key), "delay", delay.String(), "failures", t.Failures)
+		}
+
+		if err := store.LockLogin(ctx, k.scope, k.key, now.Add(delay)); err != nil {
+			logging.FromContext(ctx).Error("recordThrottleFailure: error locking", "scope", k.scope, "error", err)
+		}
+	}
+}
+
+// clearAccountThrottle forgets failures after a successful login. The IP
+// counter is left alone, otherwise an attacker holding one valid account
+// could reset it between guesses against other accounts.
+func (s *UserService) clearAccountThrottle(ctx context.Context, email string) {
+	err := s.store.ClearLoginThrottle(ctx, model.LoginScopeAccount, normalizeEmail(email))
+	if err != nil && err != sql.ErrNoRows {
+		logging.FromContext(ctx).Error("clearAccountThrottle: error clearing failures", "error", err)
+	}
+}
+
+// lockoutDelay implements the progressive delay policy: the first half of
+// the allowed attempts are free, after that each failure doubles the wait
+// starting from one second, and reaching maxAttempts locks for the full
+// lockout duration.
+func lockoutDelay(failures, maxAttempts int) time.Duration {
+	lockout := config.Envs.LoginLockoutDuration
+
+	if failures >= maxAttempts {
+		return lockout
+	}
+
+	free := maxAttempts / 2
+	if failures <= free {
+		return 0
+	}
+
+	delay := time.Duration(math.Pow(2, float64(failures-free-1))) * time.Second
+	return min(delay, lockout)
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	utils.WriteError(w, http.StatusTooManyRequests, errTooManyAttempts.Error())
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// throttleStore keeps login throttles in memory.
+type throttleStore struct {
+	repository.MockStore
+	user      *model.User
+	throttles map[string]*model.LoginThrottle
+}
+
+func (s *throttleStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	if s.user == nil || s.user.Email != email {
+		return nil, sql.ErrNoRows
+	}
+	return s.user, nil
+}
+
+func (s *throttleStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	if s.user == nil || strconv.FormatInt(s.user.ID, 10) != id {
+		return nil, sql.ErrNoRows
+	}
+	user := *s.user
+	user.Password = ""
+	return &user, nil
+}
+
+func (s *throttleStore) GetLoginThrottle(ctx context.Context, scope, key string) (*model.LoginThrottle, error) {
+	t, ok := s.throttles[scope+"/"+key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (s *throttleStore) RecordLoginFailure(ctx context.Context, scope, key string, since time.Time) (*model.LoginThrottle, error) {
+	t, ok := s.throttles[scope+"/"+key]
+	if !ok {
+		t = &model.LoginThrottle{Scope: scope, Key: key}
+		s.throttles[scope+"/"+key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = time.Now()
+	return t, nil
+}
+
+func (s *throttleStore) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	s.throttles[scope+"/"+key].LockedUntil = &until
+	return nil
+}
+
+func (s *throttleStore) ClearLoginThrottle(ctx context.Context, scope, key string) error {
+	if _, ok := s.throttles[scope+"/"+key]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.throttles, scope+"/"+key)
+	return nil
+}
+
+func TestLockoutDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{5, 0},
+		{6, time.Second},
+		{7, 2 * time.Second},
+		{9, 8 * time.Second},
+		{10, config.Envs.LoginLockoutDuration},
+		{50, config.Envs.LoginLockoutDuration},
+	}
+
+	for _, tt := range tests {
+		if got := lockoutDelay(tt.failures, 10); got != tt.want {
+			t.Errorf("lockoutDelay(%d, 10) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	hash, err := middleware.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should answer unknown emails like wrong passwords", func(t *testing.T) {
+		store := &throttleStore{user: &model.User{ID: 7, Email: "joe@mail.com", Password: hash}, throttles: map[string]*model.LoginThrottle{}}
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		unknown := postJSON(t, service.handleUserLogin, "/users/login", &model.LoginRequest{Email: "nobody@mail.com", Password: "password"})
+		wrong := postJSON(t, service.handleUserLogin, "/users/login", &model.LoginRequest{Email: "joe@mail.com", Password: "guess"})
+
+		if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+			t.Fatalf("expected both to fail with %d, got %d and %d", http.StatusUnauthorized, unknown.Code, wrong.Code)
+		}
+
+		if unknown.Body.String() != wrong.Body.String() {
+			t.Errorf("expected identical responses, got %q and %q", unknown.Body.String(), wrong.Body.String())
+		}
+	})
+
+	t.Run("should lock the account after repeated failures", func(t *testing.T) {
+		store := &throttleStore{user: &model.User{ID: 7, Email: "joe@mail.com", Password: hash}, throttles: map[string]*model.LoginThrottle{}}
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		free := config.Envs.LoginMaxAttempts/2 + 1
+		for i := 0; i < free; i++ {
+			rr := postJSON(t, service.handleUserLogin, "/users/login", &model.LoginRequest{Email: "joe@mail.com", Password: "guess"})
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("attempt %d: expected status code %d, got %d", i+1, http.StatusUnauthorized, rr.Code)
+			}
+		}
+
+		rr := postJSON(t, service.handleUserLogin, "/users/login", &model.LoginRequest{Email: "joe@mail.com", Password: "password"})
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+
+	t.Run("should clear account failures after a successful login", func(t *testing.T) {
+		store := &throttleStore{user: &model.User{ID: 7, Email: "joe@mail.com", Password: hash}, throttles: map[string]*model.LoginThrottle{}}
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		postJSON(t, service.handleUserLogin, "/users/login", &model.LoginRequest{Email: "joe@mail.com", Password: "guess"})
+		rr := postJSON(t, service.handleUserLogin, "/users/login", &model.LoginRequest{Email: "joe@mail.com", Password: "password"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if _, err := store.GetLoginThrottle(context.Background(), model.LoginScopeAccount, "joe@mail.com"); err != sql.ErrNoRows {
+			t.Error("expected the account throttle to be cleared")
+		}
+	})
+
+	t.Run("should count wrong current passwords towards the lockout", func(t *testing.T) {
+		store := &throttleStore{user: &model.User{ID: 7, Email: "joe@mail.com", Password: hash}, throttles: map[string]*model.LoginThrottle{}}
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		free := config.Envs.LoginMaxAttempts/2 + 1
+		for i := 0; i < free; i++ {
+			req := authedRequest(t, http.MethodDelete, "/users/me", 7, &model.DeleteAccountPayload{Password: "guess"})
+			rr := serve(service.handleDeleteAccount, "/users/me", req)
+			if rr.Code != http.StatusForbidden {
+				t.Fatalf("attempt %d: expected status code %d, got %d", i+1, http.StatusForbidden, rr.Code)
+			}
+		}
+
+		req := authedRequest(t, http.MethodDelete, "/users/me", 7, &model.DeleteAccountPayload{Password: "password"})
+		rr := serve(service.handleDeleteAccount, "/users/me", req)
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+}
+
+func TestClearLockout(t *testing.T) {
+	store := &throttleStore{throttles: map[string]*model.LoginThrottle{
+		"account/joe@mail.com": {Scope: model.LoginScopeAccount, Key: "joe@mail.com", Failures: 5},
+	}}
+	service := NewAdminService(store, &mailer.MockMailer{})
+
+	t.Run("should reject unknown scopes", func(t *testing.T) {
+		rr := serve(service.handleClearLockout, "/admin/lockouts/{scope}/{key}", authedRequest(t, http.MethodDelete, "/admin/lockouts/device/abc", 1, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should clear an account lockout", func(t *testing.T) {
+		rr := serve(service.handleClearLockout, "/admin/lockouts/{scope}/{key}", authedRequest(t, http.MethodDelete, "/admin/lockouts/account/Joe@mail.com", 1, nil))
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		rr = serve(service.handleClearLockout, "/admin/lockouts/{scope}/{key}", authedRequest(t, http.MethodDelete, "/admin/lockouts/account/joe@mail.com", 1, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestListLockouts(t *testing.T) {
+	service := NewAdminService(&repository.MockStore{}, &mailer.MockMailer{})
+
+	rr := serve(service.handleListLockouts, "/admin/lockouts", authedRequest(t, http.MethodGet, "/admin/lockouts", 1, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var lockouts []model.LoginThrottle
+	if err := json.NewDecoder(rr.Body).Decode(&lockouts); err != nil {
+		t.Fatal(err)
+	}
+}
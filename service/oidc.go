@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/oidc"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStatePath   = "/api/v1/auth/oidc"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var errInvalidOIDCState = errors.New("invalid or expired login state")
+var errOIDCEmailRequired = errors.New("identity provider did not return an email address")
+var errOIDCEmailUnverified = errors.New("an account with this email already exists, but the provider has not verified the email address")
+var errOIDCAccountUnverified = errors.New("an account with this email already exists, but its email address has not been verified; verify it to sign in with SSO")
+
+// OIDCService signs users in through an external OpenID Connect provider.
+// Users are provisioned on first login, or linked to an existing account
+// when the provider vouches for the same email address.
+type OIDCService struct {
+	store    repository.Store
+	provider *oidc.Provider
+}
+
+func NewOIDCService(s repository.Store, p *oidc.Provider) *OIDCService {
+	return &OIDCService{store: s, provider: p}
+}
+
+func (s *OIDCService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/auth/oidc/login", s.handleOIDCLogin).Methods("GET")
+	r.HandleFunc("/auth/oidc/callback", s.handleOIDCCallback).Methods("GET")
+}
+
+// handleOIDCLogin starts the authorization code flow. The state, nonce and
+// PKCE verifier are kept in a short-lived signed cookie that the callback
+// checks, which binds the callback to the browser that started the login.
+func (s *OIDCService) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := oidc.RandomString(16)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error starting login")
+		return
+	}
+
+	nonce, err := oidc.RandomString(16)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error starting login")
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error starting login")
+		return
+	}
+
+	authURL, err := s.provider.AuthCodeURL(state, nonce, challenge)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("handleOIDCLogin: error contacting identity provider", "error", err)
+		utils.WriteError(w, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+
+	cookie, err := middleware.SignJWT(jwt.MapClaims{
+		"oidcState":    state,
+		"oidcNonce":    nonce,
+		"oidcVerifier": verifier,
+		"exp":          time.Now().Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error starting login")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookie,
+		Path:     oidcStatePath,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   config.Envs.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (s *OIDCService) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	// the state cookie is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcStatePath, MaxAge: -1, HttpOnly: true})
+
+	if providerErr := q.Get("error"); providerErr != "" {
+		logging.FromContext(r.Context()).Warn("handleOIDCCallback: identity provider returned an error", "error", providerErr)
+		utils.WriteError(w, http.StatusBadRequest, "login was not completed at the identity provider")
+		return
+	}
+
+	nonce, verifier, err := readOIDCState(r, q.Get("state"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errInvalidOIDCState.Error())
+		return
+	}
+
+	tokens, err := s.provider.Exchange(q.Get("code"), verifier)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("handleOIDCCallback: error exchanging code", "error", err)
+		utils.WriteError(w, http.StatusBadGateway, "error completing login with the identity provider")
+		return
+	}
+
+	claims, err := s.provider.VerifyIDToken(tokens.IDToken, nonce)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("handleOIDCCallback: invalid identity token", "error", err)
+		utils.WriteError(w, http.StatusUnauthorized, "invalid identity token")
+		return
+	}
+
+	user, status, err := s.resolveUser(r.Context(), claims)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// the identity provider stands in for the password only, so users with
+	// two-factor authentication still have to answer the challenge
+	completeLogin(s.store, w, r, user.ID)
+}
+
+// resolveUser finds the local user for a verified identity, linking or
+// provisioning one as needed. On failure it returns the HTTP status to use.
+func (s *OIDCService) resolveUser(ctx context.Context, claims *oidc.Claims) (*model.User, int, error) {
+	identity, err := s.store.GetUserIdentity(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		user, err := s.store.GetUserByID(ctx, strconv.FormatInt(identity.UserID, 10))
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("error loading user")
+		}
+		return user, 0, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, http.StatusInternalServerError, errors.New("error loading user")
+	}
+
+	if claims.Email == "" {
+		return nil, http.StatusBadRequest, errOIDCEmailRequired
+	}
+
+	user, err := s.store.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// only link when the provider vouches for the address, otherwise
+		// anyone could take over an account by claiming its email
+		if !claims.EmailVerified {
+			return nil, http.StatusConflict, errOIDCEmailUnverified
+		}
+		// nor when the local account never proved it owns the address:
+		// whoever registered it may not be the person signing in, and
+		// would keep its password
+		if !user.Verified {
+			logging.FromContext(ctx).Warn("resolveUser: refusing to link an unverified account", "issuer", claims.Issuer, "user_id", user.ID)
+			return nil, http.StatusConflict, errOIDCAccountUnverified
+		}
+		logging.FromContext(ctx).Info("resolveUser: linking identity to existing user", "issuer", claims.Issuer, "user_id", user.ID)
+	case err == sql.ErrNoRows:
+		user, err = s.provisionUser(ctx, claims)
+		if err != nil {
+			logging.FromContext(ctx).Error("resolveUser: error provisioning user", "error", err)
+			return nil, http.StatusInternalServerError, errors.New("error creating user")
+		}
+	default:
+		return nil, http.StatusInternalServerError, errors.New("error loading user")
+	}
+
+	_, err = s.store.CreateUserIdentity(ctx, &model.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("error linking identity")
+	}
+
+	return user, 0, nil
+}
+
+// provisionUser creates a local account for a first-time SSO user. The
+// password is random, so the account can only be used through SSO until the
+// user sets a password with the reset flow.
+func (s *OIDCService) provisionUser(ctx context.Context, claims *oidc.Claims) (*model.User, error) {
+	random, _, err := middleware.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPW, err := middleware.HashPassword(random)
+	if err != nil {
+		return nil, err
+	}
+
+	firstName, lastName := oidcNames(claims)
+	user, err := s.store.CreateUser(ctx, &model.User{
+		Email:     claims.Email,
+		FirstName: firstName,
+		LastName:  lastName,
+		Password:  hashedPW,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.EmailVerified {
+		if err := s.store.SetUserVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.Verified = true
+	}
+
+	if _, err := createPersonalOrganization(ctx, s.store, user); err != nil {
+		logging.FromContext(ctx).Error("provisionUser: error creating organization", "user_id", user.ID, "error", err)
+	}
+
+	logging.FromContext(ctx).Info("provisionUser: created user", "user_id", user.ID, "issuer", claims.Issuer)
+	return user, nil
+}
+
+func oidcNames(claims *oidc.Claims) (string, string) {
+	if claims.GivenName != "" || claims.FamilyName != "" {
+		return claims.GivenName, claims.FamilyName
+	}
+
+	if claims.Name != "" {
+		first, last, _ := strings.Cut(claims.Name, " ")
+		return first, last
+	}
+
+	local, _, _ := strings.Cut(claims.Email, "@")
+	return local, ""
+}
+
+// readOIDCState checks the signed state cookie against the state returned by
+// the provider and returns the nonce and PKCE verifier stored in it.
+func readOIDCState(r *http.Request, state string) (nonce string, verifier string, err error) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return "", "", err
+	}
+
+	token, err := middleware.ValidateJWT(cookie.Value)
+	if err != nil || !token.Valid {
+		return "", "", errInvalidOIDCState
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	expected, _ := claims["oidcState"].(string)
+	nonce, _ = claims["oidcNonce"].(string)
+	verifier, _ = claims["oidcVerifier"].(string)
+
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(state)) != 1 {
+		return "", "", errInvalidOIDCState
+	}
+
+	return nonce, verifier, nil
+}
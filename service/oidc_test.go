@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/oidc"
+	"github.com/DaffaJatmiko/go-rest-project-manager/oidc/oidctest"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// identityStore keeps users and linked identities in memory.
+type identityStore struct {
+	repository.MockStore
+	users      map[string]*model.User
+	identities map[string]*model.UserIdentity
+	totp       map[int64]*model.UserTOTP
+}
+
+func (s *identityStore) CreateUser(ctx context.Context, u *model.User) (*model.User, error) {
+	u.ID = int64(len(s.users) + 1)
+	s.users[u.Email] = u
+	return u, nil
+}
+
+func (s *identityStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	if u, ok := s.users[email]; ok {
+		return u, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *identityStore) GetUserTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error) {
+	if t, ok := s.totp[userID]; ok {
+		return t, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *identityStore) GetUserIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error) {
+	if i, ok := s.identities[issuer+"|"+subject]; ok {
+		return i, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *identityStore) CreateUserIdentity(ctx context.Context, i *model.UserIdentity) (*model.UserIdentity, error) {
+	s.identities[i.Issuer+"|"+i.Subject] = i
+	return i, nil
+}
+
+// oidcLogin runs the browser side of the flow: start the login, follow the
+// provider redirect and deliver the callback with the state cookie.
+func oidcLogin(t *testing.T, service *OIDCService, idp *oidctest.Server, tamperState bool) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rr := serve(service.handleOIDCLogin, "/auth/oidc/login", httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect to the provider, got %d", rr.Code)
+	}
+	cookies := rr.Result().Cookies()
+
+	client := *idp.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tamperState {
+		q := callback.Query()
+		q.Set("state", "attacker-state")
+		callback.RawQuery = q.Encode()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+callback.RawQuery, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	return serve(service.handleOIDCCallback, "/auth/oidc/callback", req)
+}
+
+func newOIDCTest(t *testing.T) (*oidctest.Server, *identityStore, *OIDCService) {
+	t.Helper()
+
+	idp, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://localhost:3000/api/v1/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	}, idp.Client())
+
+	store := &identityStore{users: map[string]*model.User{}, identities: map[string]*model.UserIdentity{}}
+	return idp, store, NewOIDCService(store, provider)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Run("should provision a new user on first login", func(t *testing.T) {
+		idp, store, service := newOIDCTest(t)
+
+		rr := oidcLogin(t, service, idp, false)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		user, ok := store.users[idp.Email]
+		if !ok || user.FirstName != idp.GivenName || user.LastName != idp.FamilyName {
+			t.Fatalf("expected user to be provisioned, got %+v", user)
+		}
+
+		if _, ok := store.identities[idp.Issuer()+"|"+idp.Subject]; !ok {
+			t.Error("expected identity to be linked")
+		}
+	})
+
+	t.Run("should link an existing account by verified email", func(t *testing.T) {
+		idp, store, service := newOIDCTest(t)
+		store.users[idp.Email] = &model.User{ID: 42, Email: idp.Email, Verified: true}
+
+		rr := oidcLogin(t, service, idp, false)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		if identity := store.identities[idp.Issuer()+"|"+idp.Subject]; identity == nil || identity.UserID != 42 {
+			t.Errorf("expected identity to be linked to user 42, got %+v", identity)
+		}
+	})
+
+	t.Run("should still ask for the second factor", func(t *testing.T) {
+		idp, store, service := newOIDCTest(t)
+		store.users[idp.Email] = &model.User{ID: 42, Email: idp.Email, Verified: true}
+		store.totp = map[int64]*model.UserTOTP{42: {UserID: 42, Enabled: true}}
+
+		rr := oidcLogin(t, service, idp, false)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		var challenge model.TwoFactorChallenge
+		if err := json.NewDecoder(rr.Body).Decode(&challenge); err != nil {
+			t.Fatal(err)
+		}
+		if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+			t.Errorf("expected a two-factor challenge, got %+v", challenge)
+		}
+
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == middleware.SessionCookie && c.MaxAge >= 0 {
+				t.Error("expected no session cookie before the second factor")
+			}
+		}
+	})
+
+	t.Run("should not link an existing account by unverified email", func(t *testing.T) {
+		idp, store, service := newOIDCTest(t)
+		idp.EmailVerified = false
+		store.users[idp.Email] = &model.User{ID: 42, Email: idp.Email, Verified: true}
+
+		rr := oidcLogin(t, service, idp, false)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+
+		if len(store.identities) != 0 {
+			t.Error("expected no identity to be linked")
+		}
+	})
+
+	t.Run("should not link an account that never verified its email", func(t *testing.T) {
+		idp, store, service := newOIDCTest(t)
+		store.users[idp.Email] = &model.User{ID: 42, Email: idp.Email}
+
+		rr := oidcLogin(t, service, idp, false)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+
+		if len(store.identities) != 0 {
+			t.Error("expected no identity to be linked")
+		}
+
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == middleware.SessionCookie && c.MaxAge >= 0 {
+				t.Error("expected no session cookie")
+			}
+		}
+	})
+
+	t.Run("should reject a callback with a foreign state", func(t *testing.T) {
+		idp, _, service := newOIDCTest(t)
+
+		rr := oidcLogin(t, service, idp, true)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
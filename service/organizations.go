@@ -0,0 +1,443 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxSlugLen       = 50
+	slugSuffixLen    = 6
+	slugRetries      = 3
+	defaultOrgSuffix = "'s workspace"
+)
+
+var errLastOwner = errors.New("an organization must keep at least one owner")
+var errMemberNotFound = errors.New("member not found")
+var errInvitationEmail = errors.New("this invitation was sent to a different email address")
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+type OrganizationService struct {
+	store  repository.Store
+	mailer mailer.Mailer
+}
+
+func NewOrganizationService(s repository.Store, m mailer.Mailer) *OrganizationService {
+	return &OrganizationService{store: s, mailer: m}
+}
+
+// RegisterRoutes registers the organization management routes. The routes
+// that act on projects and tasks inside an organization are mounted under
+// /orgs/{org} by the API server, so these have to be registered first.
+func (s *OrganizationService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/orgs/invitations/accept", middleware.AuthHandler(s.handleAcceptInvitation, s.store)).Methods("POST")
+	r.HandleFunc("/orgs", middleware.RequireRole(model.RoleUser, s.handleCreateOrganization, s.store)).Methods("POST")
+	r.HandleFunc("/orgs", middleware.AuthHandler(s.handleListOrganizations, s.store)).Methods("GET")
+	r.HandleFunc("/orgs/{org}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleViewer, s.handleGetOrganization, s.store), s.store)).Methods("GET")
+	r.HandleFunc("/orgs/{org}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleOwner, s.handleDeleteOrganization, s.store), s.store)).Methods("DELETE")
+	r.HandleFunc("/orgs/{org}/members", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleViewer, s.handleListMembers, s.store), s.store)).Methods("GET")
+	r.HandleFunc("/orgs/{org}/members/{userID}/role", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleSetMemberRole, s.store), s.store)).Methods("PUT")
+	r.HandleFunc("/orgs/{org}/members/{userID}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleGuest, s.handleRemoveMember, s.store), s.store)).Methods("DELETE")
+	r.HandleFunc("/orgs/{org}/invitations", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleCreateInvitation, s.store), s.store)).Methods("POST")
+	r.HandleFunc("/orgs/{org}/invitations", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleListInvitations, s.store), s.store)).Methods("GET")
+	r.HandleFunc("/orgs/{org}/invitations/{id}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleRevokeInvitation, s.store), s.store)).Methods("DELETE")
+}
+
+func (s *OrganizationService) handleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var payload model.CreateOrganizationPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var org *model.Organization
+	var err error
+	if payload.Slug != "" {
+		org, err = s.store.CreateOrganization(r.Context(), &model.Organization{Name: payload.Name, Slug: payload.Slug}, userID)
+	} else {
+		org, err = createOrganization(r.Context(), s.store, payload.Name, payload.Name, userID)
+	}
+	if err != nil {
+		if err == repository.ErrSlugTaken {
+			utils.WriteError(w, http.StatusConflict, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Error("handleCreateOrganization: error creating organization", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "error creating organization")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, org)
+}
+
+func (s *OrganizationService) handleListOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := s.store.ListUserOrganizations(r.Context(), middleware.GetUserIDFromContext(r.Context()))
+	if err != nil {
+		writeStoreError(w, r, err, "handleListOrganizations: error listing organizations")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, orgs)
+}
+
+func (s *OrganizationService) handleGetOrganization(w http.ResponseWriter, r *http.Request) {
+	org, err := s.store.GetOrganization(r.Context(), middleware.GetOrgIDFromContext(r.Context()))
+	if err != nil {
+		writeStoreError(w, r, err, "handleGetOrganization: error loading organization")
+		return
+	}
+	org.Role = middleware.GetOrgRoleFromContext(r.Context())
+
+	utils.WriteJSON(w, http.StatusOK, org)
+}
+
+// handleDeleteOrganization deletes the organization together with all of its
+// projects and tasks.
+func (s *OrganizationService) handleDeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+
+	if err := s.store.DeleteOrganization(r.Context(), orgID); err != nil {
+		writeStoreError(w, r, err, "handleDeleteOrganization: error deleting organization", "org_id", orgID)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("handleDeleteOrganization: organization deleted", "org_id", orgID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *OrganizationService) handleListMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := s.store.ListOrgMembers(r.Context(), middleware.GetOrgIDFromContext(r.Context()))
+	if err != nil {
+		writeStoreError(w, r, err, "handleListMembers: error listing members")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, members)
+}
+
+// handleSetMemberRole changes a member's role. Members can only be managed
+// by someone at least as privileged as both their current and their new
+// role, so only owners make or unmake owners.
+func (s *OrganizationService) handleSetMemberRole(w http.ResponseWriter, r *http.Request) {
+	var payload model.SetMemberRolePayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	member, status, err := s.targetMember(r)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	actorRole := middleware.GetOrgRoleFromContext(r.Context())
+	if !middleware.HasOrgRole(actorRole, member.Role) || !middleware.HasOrgRole(actorRole, payload.Role) {
+		utils.WriteError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if member.Role == model.OrgRoleOwner && payload.Role != model.OrgRoleOwner {
+		if status, err := s.checkNotLastOwner(r.Context(), member.OrgID); err != nil {
+			utils.WriteError(w, status, err.Error())
+			return
+		}
+	}
+
+	if payload.Role == member.Role {
+		utils.WriteJSON(w, http.StatusOK, member)
+		return
+	}
+
+	if err := s.store.UpdateOrgMemberRole(r.Context(), member.OrgID, member.UserID, payload.Role); err != nil {
+		writeStoreError(w, r, err, "handleSetMemberRole: error updating member")
+		return
+	}
+
+	member.Role = payload.Role
+	utils.WriteJSON(w, http.StatusOK, member)
+}
+
+// handleRemoveMember removes a member from the organization. Anyone may leave
+// an organization; removing someone else takes an admin who is at least as
+// privileged as they are.
+func (s *OrganizationService) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	member, status, err := s.targetMember(r)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	if member.UserID != middleware.GetUserIDFromContext(r.Context()) {
+		actorRole := middleware.GetOrgRoleFromContext(r.Context())
+		if !middleware.HasOrgRole(actorRole, model.OrgRoleAdmin) || !middleware.HasOrgRole(actorRole, member.Role) {
+			utils.WriteError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+	}
+
+	if member.Role == model.OrgRoleOwner {
+		if status, err := s.checkNotLastOwner(r.Context(), member.OrgID); err != nil {
+			utils.WriteError(w, status, err.Error())
+			return
+		}
+	}
+
+	if err := s.store.RemoveOrgMember(r.Context(), member.OrgID, member.UserID); err != nil {
+		writeStoreError(w, r, err, "handleRemoveMember: error removing member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateInvitation invites an email address to the organization. The
+// invitation can grant at most the inviter's own role.
+func (s *OrganizationService) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload model.CreateOrgInvitationPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	if payload.Role == "" {
+		payload.Role = model.OrgRoleMember
+	}
+	if !middleware.HasOrgRole(middleware.GetOrgRoleFromContext(r.Context()), payload.Role) {
+		utils.WriteError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+	org, err := s.store.GetOrganization(r.Context(), orgID)
+	if err != nil {
+		writeStoreError(w, r, err, "handleCreateInvitation: error creating invitation")
+		return
+	}
+
+	token, hash, err := middleware.GenerateToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating invitation")
+		return
+	}
+
+	invitation, err := s.store.CreateOrgInvitation(r.Context(), &model.OrgInvitation{
+		OrgID:       orgID,
+		Email:       payload.Email,
+		Role:        payload.Role,
+		TokenHash:   hash,
+		InvitedByID: middleware.GetUserIDFromContext(r.Context()),
+		ExpiresAt:   time.Now().Add(config.Envs.OrgInvitationTTL),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating invitation")
+		return
+	}
+
+	if err := s.sendInvitationEmail(org, invitation, token); err != nil {
+		logging.FromContext(r.Context()).Error("handleCreateInvitation: error sending invitation", "invitation_id", invitation.ID, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "error sending invitation email")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, invitation)
+}
+
+func (s *OrganizationService) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := s.store.ListOrgInvitations(r.Context(), middleware.GetOrgIDFromContext(r.Context()), time.Now())
+	if err != nil {
+		writeStoreError(w, r, err, "handleListInvitations: error listing invitations")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+func (s *OrganizationService) handleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid invitation id")
+		return
+	}
+
+	if err := s.store.RevokeOrgInvitation(r.Context(), middleware.GetOrgIDFromContext(r.Context()), id); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "invitation not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error revoking invitation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAcceptInvitation adds the current user to the organization they were
+// invited to. The invitation only works for the account with the email
+// address it was sent to.
+func (s *OrganizationService) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload model.AcceptOrgInvitationPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	invitation, err := s.store.GetOrgInvitationByHash(r.Context(), middleware.HashToken(payload.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error accepting invitation")
+		return
+	}
+
+	if invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(r.Context())
+	user, err := s.store.GetUserByID(r.Context(), strconv.FormatInt(userID, 10))
+	if err != nil {
+		writeStoreError(w, r, err, "handleAcceptInvitation: error accepting invitation")
+		return
+	}
+
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		utils.WriteError(w, http.StatusForbidden, errInvitationEmail.Error())
+		return
+	}
+
+	if err := s.store.AcceptOrgInvitation(r.Context(), invitation.ID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error accepting invitation")
+		return
+	}
+
+	org, err := s.store.GetOrganization(r.Context(), invitation.OrgID)
+	if err != nil {
+		writeStoreError(w, r, err, "handleAcceptInvitation: error loading organization")
+		return
+	}
+	if member, err := s.store.GetOrgMember(r.Context(), org.ID, userID); err == nil {
+		org.Role = member.Role
+	}
+
+	utils.WriteJSON(w, http.StatusOK, org)
+}
+
+// targetMember loads the member named by the {userID} route variable from the
+// current organization.
+func (s *OrganizationService) targetMember(r *http.Request) (*model.OrgMember, int, error) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("invalid user id")
+	}
+
+	member, err := s.store.GetOrgMember(r.Context(), middleware.GetOrgIDFromContext(r.Context()), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, http.StatusNotFound, errMemberNotFound
+		}
+		return nil, http.StatusInternalServerError, errors.New("error loading member")
+	}
+
+	return member, 0, nil
+}
+
+func (s *OrganizationService) checkNotLastOwner(ctx context.Context, orgID int64) (int, error) {
+	members, err := s.store.ListOrgMembers(ctx, orgID)
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("error loading members")
+	}
+
+	owners := 0
+	for _, m := range members {
+		if m.Role == model.OrgRoleOwner {
+			owners++
+		}
+	}
+
+	if owners <= 1 {
+		return http.StatusConflict, errLastOwner
+	}
+	return 0, nil
+}
+
+func (s *OrganizationService) sendInvitationEmail(org *model.Organization, invitation *model.OrgInvitation, token string) error {
+	return s.mailer.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to %s", org.Name),
+		Body: fmt.Sprintf("You have been invited to join %s as %s. Accept the invitation here:\n\n%s/accept-invitation?token=%s\n\nThe link expires in %s.",
+			org.Name, invitation.Role, config.Envs.AppURL, url.QueryEscape(token), config.Envs.OrgInvitationTTL),
+	})
+}
+
+// createPersonalOrganization gives a new user an organization of their own so
+// that they can create projects straight away.
+func createPersonalOrganization(ctx context.Context, store repository.Store, user *model.User) (*model.Organization, error) {
+	base, _, _ := strings.Cut(user.Email, "@")
+	return createOrganization(ctx, store, user.FirstName+defaultOrgSuffix, base, user.ID)
+}
+
+// createOrganization creates an organization with a slug derived from base,
+// adding a random suffix if the slug is already taken.
+func createOrganization(ctx context.Context, store repository.Store, name, base string, ownerID int64) (*model.Organization, error) {
+	slug := slugify(base)
+
+	for i := 0; ; i++ {
+		org, err := store.CreateOrganization(ctx, &model.Organization{Name: name, Slug: slug}, ownerID)
+		if err != repository.ErrSlugTaken || i == slugRetries {
+			return org, err
+		}
+
+		suffix, _, err := middleware.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		suffix = slugSeparators.ReplaceAllString(strings.ToLower(suffix), "")
+		if len(suffix) > slugSuffixLen {
+			suffix = suffix[:slugSuffixLen]
+		}
+		slug = truncateSlug(slugify(base), maxSlugLen-slugSuffixLen-1) + "-" + suffix
+	}
+}
+
+// slugify turns s into a valid slug. Slugs always contain a letter so that
+// they can't be mistaken for organization IDs.
+func slugify(s string) string {
+	slug := strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if !strings.ContainsAny(slug, "abcdefghijklmnopqrstuvwxyz") {
+		slug = strings.Trim("org-"+slug, "-")
+	}
+	return truncateSlug(slug, maxSlugLen)
+}
+
+func truncateSlug(slug string, n int) string {
+	if len(slug) > n {
+		slug = slug[:n]
+	}
+	return strings.TrimRight(slug, "-")
+}
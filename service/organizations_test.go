@@ -0,0 +1,411 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/validate"
+	"github.com/gorilla/mux"
+)
+
+type orgMemberKey struct {
+	orgID, userID int64
+}
+
+// orgStore keeps organizations, their members, invitations and projects in
+// memory on top of adminStore.
+type orgStore struct {
+	*adminStore
+	orgs        map[int64]*model.Organization
+	members     map[orgMemberKey]string
+	invitations []*model.OrgInvitation
+	projects    map[int64]*model.Project
+	teams       map[int64]*model.Team
+	teamMembers map[teamMemberKey]bool
+	userGrants  map[projectGrantKey]string
+	teamGrants  map[projectGrantKey]string
+
+	projectInvitations []*model.ProjectInvitation
+	shareLinks         []*model.ShareLink
+}
+
+// newOrgStore creates two organizations: acme, owned by joe (7), and globex,
+// owned by the admin (1) with the guest (8) as a viewer. Project 10 belongs to
+// globex.
+func newOrgStore() *orgStore {
+	return &orgStore{
+		adminStore: newAdminStore(),
+		orgs: map[int64]*model.Organization{
+			1: {ID: 1, Name: "Acme", Slug: "acme"},
+			2: {ID: 2, Name: "Globex", Slug: "globex"},
+		},
+		members: map[orgMemberKey]string{
+			{1, 7}: model.OrgRoleOwner,
+			{2, 1}: model.OrgRoleOwner,
+			{2, 8}: model.OrgRoleViewer,
+		},
+		projects: map[int64]*model.Project{
+			10: {ID: 10, OrgID: 2, Name: "Secret"},
+		},
+		teams:       map[int64]*model.Team{},
+		teamMembers: map[teamMemberKey]bool{},
+		userGrants:  map[projectGrantKey]string{},
+		teamGrants:  map[projectGrantKey]string{},
+	}
+}
+
+func (s *orgStore) GetOrganization(ctx context.Context, id int64) (*model.Organization, error) {
+	org, ok := s.orgs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	clone := *org
+	return &clone, nil
+}
+
+func (s *orgStore) GetOrganizationBySlug(ctx context.Context, slug string) (*model.Organization, error) {
+	for _, org := range s.orgs {
+		if org.Slug == slug {
+			clone := *org
+			return &clone, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *orgStore) ListUserOrganizations(ctx context.Context, userID int64) ([]model.Organization, error) {
+	orgs := []model.Organization{}
+	for key, role := range s.members {
+		if key.userID == userID {
+			org := *s.orgs[key.orgID]
+			org.Role = role
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs, nil
+}
+
+func (s *orgStore) GetOrgMember(ctx context.Context, orgID, userID int64) (*model.OrgMember, error) {
+	role, ok := s.members[orgMemberKey{orgID, userID}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &model.OrgMember{OrgID: orgID, UserID: userID, Role: role}, nil
+}
+
+func (s *orgStore) ListOrgMembers(ctx context.Context, orgID int64) ([]model.OrgMember, error) {
+	members := []model.OrgMember{}
+	for key, role := range s.members {
+		if key.orgID == orgID {
+			members = append(members, model.OrgMember{OrgID: orgID, UserID: key.userID, Role: role})
+		}
+	}
+	return members, nil
+}
+
+func (s *orgStore) UpdateOrgMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	s.members[orgMemberKey{orgID, userID}] = role
+	return nil
+}
+
+func (s *orgStore) RemoveOrgMember(ctx context.Context, orgID, userID int64) error {
+	delete(s.members, orgMemberKey{orgID, userID})
+	return nil
+}
+
+func (s *orgStore) CreateOrgInvitation(ctx context.Context, inv *model.OrgInvitation) (*model.OrgInvitation, error) {
+	inv.ID = int64(len(s.invitations) + 1)
+	s.invitations = append(s.invitations, inv)
+	return inv, nil
+}
+
+func (s *orgStore) GetOrgInvitationByHash(ctx context.Context, tokenHash string) (*model.OrgInvitation, error) {
+	for _, inv := range s.invitations {
+		if inv.TokenHash == tokenHash {
+			clone := *inv
+			return &clone, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *orgStore) AcceptOrgInvitation(ctx context.Context, id, userID int64) error {
+	inv := s.invitations[id-1]
+	if inv.AcceptedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	inv.AcceptedAt = &now
+	if _, ok := s.members[orgMemberKey{inv.OrgID, userID}]; !ok {
+		s.members[orgMemberKey{inv.OrgID, userID}] = inv.Role
+	}
+	return nil
+}
+
+func (s *orgStore) CreateProject(ctx context.Context, orgID int64, p *model.Project) (*model.Project, error) {
+	p.ID = int64(len(s.projects) + 100)
+	p.OrgID = orgID
+	s.projects[p.ID] = p
+	return p, nil
+}
+
+func (s *orgStore) GetProject(ctx context.Context, orgID int64, id string) (*model.Project, error) {
+	projectID, _ := strconv.ParseInt(id, 10, 64)
+	p, ok := s.projects[projectID]
+	if !ok || p.OrgID != orgID {
+		return nil, sql.ErrNoRows
+	}
+	return p, nil
+}
+
+// newOrgRouter routes requests the way the API server does.
+func newOrgRouter(store *orgStore, m mailer.Mailer) *mux.Router {
+	router := mux.NewRouter()
+	NewOrganizationService(store, m).RegisterRoutes(router)
+	NewTeamService(store).RegisterRoutes(router)
+	orgRouter := router.PathPrefix("/orgs/{org}").Subrouter()
+	NewProjectService(store).RegisterRoutes(router)
+	NewProjectService(store).RegisterRoutes(orgRouter)
+	NewProjectInvitationService(store, m).RegisterRoutes(router)
+	NewProjectInvitationService(store, m).RegisterProjectRoutes(router)
+	NewProjectInvitationService(store, m).RegisterProjectRoutes(orgRouter)
+	NewShareLinkService(store).RegisterRoutes(router)
+	NewShareLinkService(store).RegisterProjectRoutes(router)
+	NewShareLinkService(store).RegisterProjectRoutes(orgRouter)
+	return router
+}
+
+func orgRequest(t *testing.T, router http.Handler, method, path, token, org string, payload any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if org != "" {
+		req.Header.Set(middleware.OrgHeader, org)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// ifMatchAny lets requests change resources whatever their version, for
+// tests of who may change them.
+func ifMatchAny(router http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("If-Match", "*")
+		router.ServeHTTP(w, r)
+	})
+}
+
+func TestOrganizationIsolation(t *testing.T) {
+	store := newOrgStore()
+	router := newOrgRouter(store, &mailer.MockMailer{})
+	joe := login(t, store, 7, "")
+	admin := login(t, store, 1, "")
+	guest := login(t, store, 8, "")
+
+	tests := []struct {
+		name  string
+		token string
+		path  string
+		org   string
+		want  int
+	}{
+		{"should show members the project", admin, "/orgs/globex/projects/10", "", http.StatusOK},
+		{"should select the organization by ID", admin, "/projects/10", "2", http.StatusOK},
+		{"should select the organization by header", admin, "/projects/10", "globex", http.StatusOK},
+		{"should hide other organizations", joe, "/orgs/globex/projects/10", "", http.StatusNotFound},
+		{"should hide other organizations by header", joe, "/projects/10", "globex", http.StatusNotFound},
+		{"should not find the project in another organization", joe, "/orgs/acme/projects/10", "", http.StatusNotFound},
+		{"should default to the user's only organization", joe, "/projects/10", "", http.StatusNotFound},
+		{"should let viewers read", guest, "/orgs/globex/projects/10", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := orgRequest(t, router, http.MethodGet, tt.path, tt.token, tt.org, nil)
+			if rr.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should require an organization when the user has several", func(t *testing.T) {
+		store.members[orgMemberKey{1, 1}] = model.OrgRoleMember
+
+		rr := orgRequest(t, router, http.MethodGet, "/projects/10", admin, "", nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should create projects in the selected organization", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/acme/projects", joe, "", &model.Project{Name: "Roadmap"})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var project model.Project
+		if err := json.NewDecoder(rr.Body).Decode(&project); err != nil {
+			t.Fatal(err)
+		}
+
+		if project.OrgID != 1 {
+			t.Errorf("expected project in organization 1, got %d", project.OrgID)
+		}
+	})
+
+	t.Run("should keep viewers from writing", func(t *testing.T) {
+		store.users[8].Role = model.RoleUser
+
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/projects", guest, "", &model.Project{Name: "Roadmap"})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+func TestOrganizationInvitations(t *testing.T) {
+	store := newOrgStore()
+	m := &mailer.MockMailer{}
+	router := newOrgRouter(store, m)
+	admin := login(t, store, 1, "")
+	joe := login(t, store, 7, "")
+	guest := login(t, store, 8, "")
+
+	t.Run("should not let viewers invite", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/invitations", guest, "", &model.CreateOrgInvitationPayload{Email: "joe@mail.com"})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	var token string
+
+	t.Run("should email an invitation", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/invitations", admin, "", &model.CreateOrgInvitationPayload{Email: "Joe@mail.com", Role: model.OrgRoleAdmin})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		if strings.Contains(rr.Body.String(), store.invitations[0].TokenHash) {
+			t.Error("expected the token hash to stay private")
+		}
+
+		if len(m.Sent) != 1 || m.Sent[0].To != "Joe@mail.com" {
+			t.Fatalf("expected an invitation to Joe@mail.com, got %+v", m.Sent)
+		}
+
+		_, query, _ := strings.Cut(strings.Fields(m.Sent[0].Body[strings.Index(m.Sent[0].Body, "http"):])[0], "?")
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token = values.Get("token")
+	})
+
+	t.Run("should only accept for the invited address", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/invitations/accept", guest, "", &model.AcceptOrgInvitationPayload{Token: token})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should add the invitee with the invited role", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/invitations/accept", joe, "", &model.AcceptOrgInvitationPayload{Token: token})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if role := store.members[orgMemberKey{2, 7}]; role != model.OrgRoleAdmin {
+			t.Errorf("expected joe to be an admin of globex, got %q", role)
+		}
+
+		rr = orgRequest(t, router, http.MethodPost, "/orgs/invitations/accept", joe, "", &model.AcceptOrgInvitationPayload{Token: token})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected a used invitation to be rejected, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should not let admins invite owners", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/invitations", joe, "", &model.CreateOrgInvitationPayload{Email: "new@mail.com", Role: model.OrgRoleOwner})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+func TestOrganizationMembers(t *testing.T) {
+	t.Run("should keep the last owner", func(t *testing.T) {
+		store := newOrgStore()
+		router := newOrgRouter(store, &mailer.MockMailer{})
+		admin := login(t, store, 1, "")
+
+		rr := orgRequest(t, router, http.MethodPut, "/orgs/globex/members/1/role", admin, "", &model.SetMemberRolePayload{Role: model.OrgRoleMember})
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodDelete, "/orgs/globex/members/1", admin, "", nil)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should let members leave but not remove others", func(t *testing.T) {
+		store := newOrgStore()
+		store.members[orgMemberKey{2, 7}] = model.OrgRoleMember
+		router := newOrgRouter(store, &mailer.MockMailer{})
+		joe := login(t, store, 7, "")
+
+		rr := orgRequest(t, router, http.MethodDelete, "/orgs/globex/members/8", joe, "", nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodDelete, "/orgs/globex/members/7", joe, "", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if _, ok := store.members[orgMemberKey{2, 7}]; ok {
+			t.Error("expected joe to have left globex")
+		}
+	})
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Acme Corp":             "acme-corp",
+		"  --Hello, World!--":   "hello-world",
+		"2024":                  "org-2024",
+		"":                      "org",
+		strings.Repeat("a", 60): strings.Repeat("a", maxSlugLen),
+	}
+
+	for in, want := range tests {
+		if got := slugify(in); got != want || !validate.ValidSlug(got) {
+			t.Errorf("slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxAvatarSize     = 1 << 20
+	avatarFormField   = "avatar"
+	avatarCacheMaxAge = "86400"
+)
+
+var errInvalidPassword = errors.New("current password is incorrect")
+var errAvatarTooLarge = fmt.Errorf("avatar must be at most %d bytes", maxAvatarSize)
+var errAvatarType = errors.New("avatar must be a PNG, JPEG, GIF or WebP image")
+
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func (s *UserService) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error loading profile")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, withAvatarURL(user))
+}
+
+func (s *UserService) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var payload model.UpdateProfilePayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error loading profile")
+		return
+	}
+
+	applyProfileUpdate(user, &payload)
+
+	if err := s.store.UpdateUserProfile(r.Context(), user); err != nil {
+		writeStoreError(w, r, err, "handleUpdateProfile: error updating profile")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, withAvatarURL(user))
+}
+
+// handleChangePassword sets a new password after checking the current one,
+// and signs the user out of every other session.
+func (s *UserService) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload model.ChangePasswordPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	user, ok := s.checkCurrentPassword(w, r, payload.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	hashedPW, err := middleware.HashPassword(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error changing password")
+		return
+	}
+
+	if err := s.store.UpdateUserPassword(r.Context(), user.ID, hashedPW); err != nil {
+		writeStoreError(w, r, err, "handleChangePassword: error changing password")
+		return
+	}
+
+	if _, err := s.store.RevokeOtherSessions(r.Context(), user.ID, middleware.GetSessionIDFromContext(r.Context())); err != nil {
+		logging.FromContext(r.Context()).Error("handleChangePassword: error revoking sessions", "error", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleChangeEmail starts an email change. The address only changes once
+// the link sent to the new address is opened.
+func (s *UserService) handleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var payload model.ChangeEmailPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	user, ok := s.checkCurrentPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+
+	if strings.EqualFold(payload.Email, user.Email) {
+		utils.WriteError(w, http.StatusBadRequest, "new email must differ from the current one")
+		return
+	}
+
+	if _, err := s.store.GetUserByEmail(r.Context(), payload.Email); err == nil {
+		utils.WriteError(w, http.StatusConflict, repository.ErrEmailTaken.Error())
+		return
+	} else if err != sql.ErrNoRows {
+		utils.WriteError(w, http.StatusInternalServerError, "error changing email")
+		return
+	}
+
+	// asking again for the pending address only resends the link, as the
+	// store would not find the user when the update changes nothing
+	if payload.Email != user.PendingEmail {
+		if err := s.store.SetPendingEmail(r.Context(), user.ID, payload.Email); err != nil {
+			writeStoreError(w, r, err, "handleChangeEmail: error changing email")
+			return
+		}
+	}
+
+	if err := s.sendEmailChangeEmails(r.Context(), user, payload.Email); err != nil {
+		logging.FromContext(r.Context()).Error("handleChangeEmail: error sending confirmation", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "error sending confirmation email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *UserService) handleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var payload model.VerifyEmailPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	token, err := s.store.ConsumeUserToken(r.Context(), model.TokenPurposeEmailChange, middleware.HashToken(payload.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error changing email")
+		return
+	}
+
+	switch err := s.store.ConfirmEmailChange(r.Context(), token.UserID); err {
+	case nil:
+	case sql.ErrNoRows:
+		utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+		return
+	case repository.ErrEmailTaken:
+		utils.WriteError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "error changing email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteAccount deletes the account of the current user after checking
+// their password.
+func (s *UserService) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var payload model.DeleteAccountPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	user, ok := s.checkCurrentPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteUser(r.Context(), user.ID); err != nil {
+		writeStoreError(w, r, err, "handleDeleteAccount: error deleting account")
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("handleDeleteAccount: account deleted")
+	middleware.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUploadAvatar replaces the avatar with the image sent in the
+// "avatar" field of a multipart form.
+func (s *UserService) handleUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	// leave room for the multipart framing around the image
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+64<<10)
+	file, _, err := r.FormFile(avatarFormField)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, errAvatarTooLarge.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, "expected a multipart form with an avatar file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "error reading avatar")
+		return
+	}
+	if len(data) > maxAvatarSize {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, errAvatarTooLarge.Error())
+		return
+	}
+
+	// trust the content, not the type claimed by the client
+	contentType := http.DetectContentType(data)
+	if !avatarTypes[contentType] {
+		utils.WriteError(w, http.StatusUnsupportedMediaType, errAvatarType.Error())
+		return
+	}
+
+	if err := s.store.SaveUserAvatar(r.Context(), &model.UserAvatar{UserID: userID, ContentType: contentType, Data: data}); err != nil {
+		writeStoreError(w, r, err, "handleUploadAvatar: error saving avatar")
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error loading profile")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, withAvatarURL(user))
+}
+
+func (s *UserService) handleDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	if err := s.store.DeleteUserAvatar(r.Context(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Avatar not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error deleting avatar")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *UserService) handleGetAvatar(w http.ResponseWriter, r *http.Request) {
+	var userID int64
+	if id := mux.Vars(r)["id"]; id == "me" {
+		userID = middleware.GetUserIDFromContext(r.Context())
+	} else {
+		var err error
+		if userID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+	}
+
+	avatar, err := s.store.GetUserAvatar(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Avatar not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error loading avatar")
+		return
+	}
+
+	w.Header().Set("Content-Type", avatar.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(avatar.Data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age="+avatarCacheMaxAge)
+	w.WriteHeader(http.StatusOK)
+	w.Write(avatar.Data)
+}
+
+func (s *UserService) currentUser(r *http.Request) (*model.User, error) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	return s.store.GetUserByID(r.Context(), strconv.FormatInt(userID, 10))
+}
+
+// checkCurrentPassword loads the current user and checks their password.
+// Failures count towards the login lockout, so a stolen session cannot be
+// used to guess the password. On failure it writes the response and
+// returns false.
+func (s *UserService) checkCurrentPassword(w http.ResponseWriter, r *http.Request, password string) (*model.User, bool) {
+	if password == "" {
+		utils.WriteError(w, http.StatusBadRequest, errPasswordRequired.Error())
+		return nil, false
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error loading profile")
+		return nil, false
+	}
+
+	ip := middleware.ClientIP(r)
+	retryAfter, err := s.loginRetryAfter(r.Context(), user.Email, ip)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error loading profile")
+		return nil, false
+	}
+	if retryAfter > 0 {
+		writeTooManyAttempts(w, retryAfter)
+		return nil, false
+	}
+
+	// GetUserByID does not load the password hash
+	withHash, err := s.store.GetUserByEmail(r.Context(), user.Email)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error loading profile")
+		return nil, false
+	}
+
+	if !middleware.CheckPasswordHash(password, withHash.Password) {
+		logging.FromContext(r.Context()).Info("checkCurrentPassword: password mismatch")
+		s.recordLoginFailure(r.Context(), user.Email, ip)
+		utils.WriteError(w, http.StatusForbidden, errInvalidPassword.Error())
+		return nil, false
+	}
+
+	s.clearAccountThrottle(r.Context(), user.Email)
+	return user, true
+}
+
+func (s *UserService) sendEmailChangeEmails(ctx context.Context, user *model.User, newEmail string) error {
+	token, err := s.issueUserToken(ctx, user.ID, model.TokenPurposeEmailChange, config.Envs.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Confirm that this is the new email address of your account by opening the link below:\n\n%s/confirm-email-change?token=%s\n\nThe link expires in %s.",
+			config.Envs.AppURL, url.QueryEscape(token), config.Envs.EmailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// let the owner of the old address know, in case the account was taken over
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body:    "A change of the email address of your account was requested. If this was not you, reset your password and contact support.",
+	})
+}
+
+// applyProfileUpdate sets the fields of user that the payload changes.
+func applyProfileUpdate(user *model.User, payload *model.UpdateProfilePayload) {
+	if payload.FirstName != nil {
+		user.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		user.LastName = *payload.LastName
+	}
+	if payload.Timezone != nil {
+		user.Timezone = *payload.Timezone
+	}
+	if payload.Locale != nil {
+		user.Locale = *payload.Locale
+	}
+}
+
+func withAvatarURL(user *model.User) *model.User {
+	if user.AvatarUpdatedAt != nil {
+		user.AvatarURL = fmt.Sprintf("/api/v1/users/%d/avatar?v=%d", user.ID, user.AvatarUpdatedAt.Unix())
+	}
+
+	return user
+}
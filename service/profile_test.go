@@ -0,0 +1,372 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// profileStore keeps a single user's profile in memory.
+type profileStore struct {
+	repository.MockStore
+	user         *model.User
+	passwordHash string
+	pendingEmail string
+	taken        map[string]bool
+	avatar       *model.UserAvatar
+	deleted      bool
+	revokedOther bool
+}
+
+func newProfileStore(t *testing.T, password string) *profileStore {
+	t.Helper()
+
+	hash, err := middleware.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &profileStore{
+		user:         &model.User{ID: 7, Email: "joe@mail.com", FirstName: "Joe", LastName: "Doe", Timezone: "UTC", Locale: "en"},
+		passwordHash: hash,
+		taken:        map[string]bool{},
+	}
+}
+
+func (s *profileStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	u := *s.user
+	u.PendingEmail = s.pendingEmail
+	return &u, nil
+}
+
+func (s *profileStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	if email == s.user.Email {
+		u := *s.user
+		u.Password = s.passwordHash
+		return &u, nil
+	}
+	if s.taken[email] {
+		return &model.User{ID: 8, Email: email}, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *profileStore) UpdateUserProfile(ctx context.Context, u *model.User) error {
+	s.user = u
+	return nil
+}
+
+func (s *profileStore) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error {
+	s.passwordHash = passwordHash
+	return nil
+}
+
+func (s *profileStore) RevokeOtherSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	s.revokedOther = true
+	return 1, nil
+}
+
+// SetPendingEmail fails like the MySQL store when it changes nothing.
+func (s *profileStore) SetPendingEmail(ctx context.Context, userID int64, email string) error {
+	if s.pendingEmail == email {
+		return sql.ErrNoRows
+	}
+	s.pendingEmail = email
+	return nil
+}
+
+func (s *profileStore) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	return &model.UserToken{UserID: 7, Purpose: purpose, TokenHash: tokenHash}, nil
+}
+
+func (s *profileStore) ConfirmEmailChange(ctx context.Context, userID int64) error {
+	if s.pendingEmail == "" {
+		return sql.ErrNoRows
+	}
+	if s.taken[s.pendingEmail] {
+		return repository.ErrEmailTaken
+	}
+	s.user.Email, s.pendingEmail = s.pendingEmail, ""
+	return nil
+}
+
+func (s *profileStore) DeleteUser(ctx context.Context, userID int64) error {
+	s.deleted = true
+	return nil
+}
+
+func (s *profileStore) SaveUserAvatar(ctx context.Context, a *model.UserAvatar) error {
+	now := time.Now()
+	s.avatar = a
+	s.user.AvatarUpdatedAt = &now
+	return nil
+}
+
+func (s *profileStore) GetUserAvatar(ctx context.Context, userID int64) (*model.UserAvatar, error) {
+	if s.avatar == nil || s.avatar.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return s.avatar, nil
+}
+
+func avatarRequest(t *testing.T, data []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPut, "/users/me/avatar", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	return req.WithContext(middleware.WithUserID(req.Context(), 7))
+}
+
+func TestUpdateProfile(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	t.Run("should update only the provided fields", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		payload := &model.UpdateProfilePayload{FirstName: str("Joseph"), Timezone: str("Europe/Berlin")}
+		rr := serve(service.handleUpdateProfile, "/users/me", authedRequest(t, http.MethodPatch, "/users/me", 7, payload))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if store.user.FirstName != "Joseph" || store.user.LastName != "Doe" || store.user.Timezone != "Europe/Berlin" || store.user.Locale != "en" {
+			t.Errorf("unexpected profile %+v", store.user)
+		}
+	})
+
+	for name, payload := range map[string]*model.UpdateProfilePayload{
+		"empty first name": {FirstName: str("")},
+		"unknown timezone": {Timezone: str("Mars/Olympus_Mons")},
+		"local timezone":   {Timezone: str("Local")},
+		"invalid locale":   {Locale: str("english please")},
+	} {
+		t.Run("should reject "+name, func(t *testing.T) {
+			service := NewUserService(newProfileStore(t, "secret"), &mailer.MockMailer{})
+
+			rr := serve(service.handleUpdateProfile, "/users/me", authedRequest(t, http.MethodPatch, "/users/me", 7, payload))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Run("should reject a wrong current password", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		payload := &model.ChangePasswordPayload{CurrentPassword: "guess", NewPassword: "new-secret"}
+		rr := serve(service.handleChangePassword, "/users/me/password", authedRequest(t, http.MethodPost, "/users/me/password", 7, payload))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		if store.revokedOther {
+			t.Error("expected sessions to be left alone")
+		}
+	})
+
+	t.Run("should change the password and revoke other sessions", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		payload := &model.ChangePasswordPayload{CurrentPassword: "secret", NewPassword: "new-secret"}
+		rr := serve(service.handleChangePassword, "/users/me/password", authedRequest(t, http.MethodPost, "/users/me/password", 7, payload))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if !middleware.CheckPasswordHash("new-secret", store.passwordHash) {
+			t.Error("expected the new password to be stored")
+		}
+
+		if !store.revokedOther {
+			t.Error("expected other sessions to be revoked")
+		}
+	})
+}
+
+func TestChangeEmail(t *testing.T) {
+	t.Run("should mail a confirmation link to the new address", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		m := &mailer.MockMailer{}
+		service := NewUserService(store, m)
+
+		payload := &model.ChangeEmailPayload{Email: "joseph@mail.com", Password: "secret"}
+		rr := serve(service.handleChangeEmail, "/users/me/email", authedRequest(t, http.MethodPost, "/users/me/email", 7, payload))
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+
+		if store.user.Email != "joe@mail.com" || store.pendingEmail != "joseph@mail.com" {
+			t.Errorf("expected the change to be pending, got %q -> %q", store.user.Email, store.pendingEmail)
+		}
+
+		if len(m.Sent) != 2 || m.Sent[0].To != "joseph@mail.com" || !strings.Contains(m.Sent[0].Body, "token=") || m.Sent[1].To != "joe@mail.com" {
+			t.Errorf("unexpected emails %+v", m.Sent)
+		}
+
+		rr = postJSON(t, service.handleConfirmEmailChange, "/users/email/confirm", &model.VerifyEmailPayload{Token: "abc"})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if store.user.Email != "joseph@mail.com" {
+			t.Errorf("expected the email to change, got %q", store.user.Email)
+		}
+	})
+
+	t.Run("should resend the link for the pending address", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		m := &mailer.MockMailer{}
+		service := NewUserService(store, m)
+
+		payload := &model.ChangeEmailPayload{Email: "joseph@mail.com", Password: "secret"}
+		for i := 0; i < 2; i++ {
+			rr := serve(service.handleChangeEmail, "/users/me/email", authedRequest(t, http.MethodPost, "/users/me/email", 7, payload))
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("expected status code %d for request %d, got %d", http.StatusAccepted, i+1, rr.Code)
+			}
+		}
+
+		if len(m.Sent) != 4 || m.Sent[2].To != "joseph@mail.com" {
+			t.Errorf("expected the link to be sent again, got %+v", m.Sent)
+		}
+	})
+
+	t.Run("should reject an address in use", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		store.taken["jane@mail.com"] = true
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		payload := &model.ChangeEmailPayload{Email: "jane@mail.com", Password: "secret"}
+		rr := serve(service.handleChangeEmail, "/users/me/email", authedRequest(t, http.MethodPost, "/users/me/email", 7, payload))
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should reject a malformed address", func(t *testing.T) {
+		service := NewUserService(newProfileStore(t, "secret"), &mailer.MockMailer{})
+
+		payload := &model.ChangeEmailPayload{Email: "Joe <joe@mail.com>", Password: "secret"}
+		rr := serve(service.handleChangeEmail, "/users/me/email", authedRequest(t, http.MethodPost, "/users/me/email", 7, payload))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestAvatar(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+	t.Run("should store and serve an uploaded image", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		rr := serve(service.handleUploadAvatar, "/users/me/avatar", avatarRequest(t, png))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		var user model.User
+		if err := json.NewDecoder(rr.Body).Decode(&user); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(user.AvatarURL, "/api/v1/users/7/avatar?v=") {
+			t.Errorf("unexpected avatar URL %q", user.AvatarURL)
+		}
+
+		rr = serve(service.handleGetAvatar, "/users/{id}/avatar", authedRequest(t, http.MethodGet, "/users/7/avatar", 8, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if rr.Header().Get("Content-Type") != "image/png" || rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("unexpected headers %v", rr.Header())
+		}
+	})
+
+	t.Run("should reject files that are not images", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		rr := serve(service.handleUploadAvatar, "/users/me/avatar", avatarRequest(t, []byte("<svg onload=alert(1)></svg>")))
+		if rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status code %d, got %d", http.StatusUnsupportedMediaType, rr.Code)
+		}
+
+		if store.avatar != nil {
+			t.Error("expected nothing to be stored")
+		}
+	})
+
+	t.Run("should reject oversized files", func(t *testing.T) {
+		service := NewUserService(newProfileStore(t, "secret"), &mailer.MockMailer{})
+
+		rr := serve(service.handleUploadAvatar, "/users/me/avatar", avatarRequest(t, append(png, make([]byte, maxAvatarSize)...)))
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+		}
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	t.Run("should require the password", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		rr := serve(service.handleDeleteAccount, "/users/me", authedRequest(t, http.MethodDelete, "/users/me", 7, &model.DeleteAccountPayload{Password: "guess"}))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		if store.deleted {
+			t.Error("expected the account to be kept")
+		}
+	})
+
+	t.Run("should delete the account and clear cookies", func(t *testing.T) {
+		store := newProfileStore(t, "secret")
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		rr := serve(service.handleDeleteAccount, "/users/me", authedRequest(t, http.MethodDelete, "/users/me", 7, &model.DeleteAccountPayload{Password: "secret"}))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if !store.deleted {
+			t.Error("expected the account to be deleted")
+		}
+
+		if cookies := rr.Result().Cookies(); len(cookies) == 0 || cookies[0].MaxAge >= 0 {
+			t.Errorf("expected session cookies to be cleared, got %v", cookies)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+var errGrantNotFound = errors.New("grant not found")
+
+// handleListGrants lists the users and teams that have been granted a role on
+// the project, on top of what their organization role gives them.
+func (s *ProjectService) handleListGrants(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	grants, err := s.store.ListProjectGrants(r.Context(), middleware.GetOrgIDFromContext(r.Context()), projectID)
+	if err != nil {
+		writeStoreError(w, r, err, "handleListGrants: error listing grants")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, grants)
+}
+
+func (s *ProjectService) handleSetUserGrant(w http.ResponseWriter, r *http.Request) {
+	role, ok := decodeProjectRole(w, r)
+	if !ok {
+		return
+	}
+
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if _, err := s.store.GetOrgMember(r.Context(), orgID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, errMemberNotFound.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error granting access")
+		return
+	}
+
+	if err := s.store.SetProjectUserGrant(r.Context(), orgID, projectID, userID, role); err != nil {
+		writeStoreError(w, r, err, "handleSetUserGrant: error granting access")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, model.ProjectGrant{ProjectID: projectID, UserID: &userID, Role: role})
+}
+
+func (s *ProjectService) handleDeleteUserGrant(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	err = s.store.DeleteProjectUserGrant(r.Context(), middleware.GetOrgIDFromContext(r.Context()), projectID, userID)
+	writeGrantDeleted(w, err)
+}
+
+func (s *ProjectService) handleSetTeamGrant(w http.ResponseWriter, r *http.Request) {
+	role, ok := decodeProjectRole(w, r)
+	if !ok {
+		return
+	}
+
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	teamID, err := strconv.ParseInt(mux.Vars(r)["teamID"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid team id")
+		return
+	}
+
+	team, err := s.store.GetTeam(r.Context(), orgID, teamID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, errTeamNotFound.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error granting access")
+		return
+	}
+
+	if err := s.store.SetProjectTeamGrant(r.Context(), orgID, projectID, teamID, role); err != nil {
+		writeStoreError(w, r, err, "handleSetTeamGrant: error granting access")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, model.ProjectGrant{ProjectID: projectID, TeamID: &teamID, TeamName: team.Name, Role: role})
+}
+
+func (s *ProjectService) handleDeleteTeamGrant(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	teamID, err := strconv.ParseInt(mux.Vars(r)["teamID"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid team id")
+		return
+	}
+
+	err = s.store.DeleteProjectTeamGrant(r.Context(), middleware.GetOrgIDFromContext(r.Context()), projectID, teamID)
+	writeGrantDeleted(w, err)
+}
+
+// handleGetAccess shows a member's effective role on the project and every
+// grant it is made of. "me" stands for the current user.
+func (s *ProjectService) handleGetAccess(w http.ResponseWriter, r *http.Request) {
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if id := mux.Vars(r)["userID"]; id != "me" {
+		var err error
+		if userID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+	}
+
+	member, err := s.store.GetOrgMember(r.Context(), orgID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, errMemberNotFound.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error loading access")
+		return
+	}
+
+	access, err := middleware.ProjectAccess(r.Context(), s.store, orgID, member.Role, projectID, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("handleGetAccess: error loading access", "target_user_id", userID, "project_id", projectID, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "error loading access")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, access)
+}
+
+// decodeProjectRole reads the role of a grant from the request body. When it
+// is missing or invalid, the error has been written and ok is false.
+func decodeProjectRole(w http.ResponseWriter, r *http.Request) (role string, ok bool) {
+	var payload model.SetProjectGrantPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return "", false
+	}
+	return payload.Role, true
+}
+
+func writeGrantDeleted(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case sql.ErrNoRows:
+		utils.WriteError(w, http.StatusNotFound, errGrantNotFound.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "error revoking access")
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+var errAccountExists = errors.New("an account with this email address already exists, log in to accept the invitation")
+
+type ProjectInvitationService struct {
+	store  repository.Store
+	mailer mailer.Mailer
+}
+
+func NewProjectInvitationService(s repository.Store, m mailer.Mailer) *ProjectInvitationService {
+	return &ProjectInvitationService{store: s, mailer: m}
+}
+
+// RegisterRoutes registers the routes invitees use to answer an invitation.
+// They are not scoped to an organization.
+func (s *ProjectInvitationService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/projects/invitations/accept", middleware.AuthHandler(s.handleAcceptInvitation, s.store)).Methods("POST")
+	r.HandleFunc("/projects/invitations/signup", s.handleAcceptInvitationSignup).Methods("POST")
+	r.HandleFunc("/projects/invitations/decline", s.handleDeclineInvitation).Methods("POST")
+}
+
+// RegisterProjectRoutes registers the routes project admins manage
+// invitations with. Like the other project routes, they are mounted both at
+// the top level and under /orgs/{org}.
+func (s *ProjectInvitationService) RegisterProjectRoutes(r *mux.Router) {
+	r.HandleFunc("/projects/{id}/invitations", projectWriter(s.store, model.ProjectRoleAdmin, s.handleCreateInvitation)).Methods("POST")
+	r.HandleFunc("/projects/{id}/invitations", projectWriter(s.store, model.ProjectRoleAdmin, s.handleListInvitations)).Methods("GET")
+	r.HandleFunc("/projects/{id}/invitations/{invitationID}", projectWriter(s.store, model.ProjectRoleAdmin, s.handleRevokeInvitation)).Methods("DELETE")
+}
+
+// handleCreateInvitation invites an email address to the project. The
+// address does not need an account yet.
+func (s *ProjectInvitationService) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload model.CreateProjectInvitationPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	if payload.Role == "" {
+		payload.Role = model.ProjectRoleViewer
+	}
+	project, err := s.store.GetProject(r.Context(), middleware.GetOrgIDFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, r, err, "handleCreateInvitation: error creating invitation")
+		return
+	}
+
+	token, hash, err := middleware.GenerateToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating invitation")
+		return
+	}
+
+	invitation, err := s.store.CreateProjectInvitation(r.Context(), &model.ProjectInvitation{
+		OrgID:       project.OrgID,
+		ProjectID:   project.ID,
+		Email:       payload.Email,
+		Role:        payload.Role,
+		TokenHash:   hash,
+		InvitedByID: middleware.GetUserIDFromContext(r.Context()),
+		ExpiresAt:   time.Now().Add(config.Envs.ProjectInvitationTTL),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating invitation")
+		return
+	}
+
+	if err := s.sendInvitationEmail(project, invitation, token); err != nil {
+		logging.FromContext(r.Context()).Error("handleCreateInvitation: error sending project invitation", "invitation_id", invitation.ID, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "error sending invitation email")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, invitation)
+}
+
+func (s *ProjectInvitationService) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	invitations, err := s.store.ListProjectInvitations(r.Context(), middleware.GetOrgIDFromContext(r.Context()), projectID, time.Now())
+	if err != nil {
+		writeStoreError(w, r, err, "handleListInvitations: error listing invitations")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+func (s *ProjectInvitationService) handleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	id, err := strconv.ParseInt(mux.Vars(r)["invitationID"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid invitation id")
+		return
+	}
+
+	if err := s.store.RevokeProjectInvitation(r.Context(), middleware.GetOrgIDFromContext(r.Context()), projectID, id); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "invitation not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error revoking invitation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAcceptInvitation accepts an invitation with the current account,
+// which must have the email address the invitation was sent to.
+func (s *ProjectInvitationService) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload model.ProjectInvitationTokenPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	invitation, status, err := s.pendingInvitation(r.Context(), payload.Token)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(r.Context())
+	user, err := s.store.GetUserByID(r.Context(), strconv.FormatInt(userID, 10))
+	if err != nil {
+		writeStoreError(w, r, err, "handleAcceptInvitation: error accepting invitation")
+		return
+	}
+
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		utils.WriteError(w, http.StatusForbidden, errInvitationEmail.Error())
+		return
+	}
+
+	if status, err := s.accept(r.Context(), invitation, userID); err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitation)
+}
+
+// handleAcceptInvitationSignup creates an account for the invited email
+// address and accepts the invitation with it. The emailed token proves that
+// the invitee owns the address, so the account starts out verified.
+func (s *ProjectInvitationService) handleAcceptInvitationSignup(w http.ResponseWriter, r *http.Request) {
+	var payload model.AcceptProjectInvitationSignupPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	invitation, status, err := s.pendingInvitation(r.Context(), payload.Token)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	user := &model.User{
+		Email:     invitation.Email,
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Password:  payload.Password,
+		Role:      model.RoleUser,
+	}
+	if _, err := s.store.GetUserByEmail(r.Context(), invitation.Email); err == nil {
+		utils.WriteError(w, http.StatusConflict, errAccountExists.Error())
+		return
+	} else if err != sql.ErrNoRows {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating user")
+		return
+	}
+
+	user.Password, err = middleware.HashPassword(payload.Password)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating user")
+		return
+	}
+
+	user, err = s.store.CreateUser(r.Context(), user)
+	if err != nil {
+		writeStoreError(w, r, err, "handleAcceptInvitationSignup: error creating user")
+		return
+	}
+
+	if err := s.store.SetUserVerified(r.Context(), user.ID); err != nil {
+		logging.FromContext(r.Context()).Error("handleAcceptInvitationSignup: error verifying user", "user_id", user.ID, "error", err)
+	}
+
+	if _, err := createPersonalOrganization(r.Context(), s.store, user); err != nil {
+		logging.FromContext(r.Context()).Error("handleAcceptInvitationSignup: error creating organization", "user_id", user.ID, "error", err)
+	}
+
+	if status, err := s.accept(r.Context(), invitation, user.ID); err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	token, err := createAndSetAuthCookie(s.store, w, r, user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, token)
+}
+
+// handleDeclineInvitation declines an invitation. The token is all it takes,
+// so invitees don't need an account to turn an invitation down.
+func (s *ProjectInvitationService) handleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload model.ProjectInvitationTokenPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	invitation, status, err := s.pendingInvitation(r.Context(), payload.Token)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	if err := s.store.DeclineProjectInvitation(r.Context(), invitation.ID); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error declining invitation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pendingInvitation looks up an invitation by its token. Invitations that
+// have been answered or have expired are treated as unknown.
+func (s *ProjectInvitationService) pendingInvitation(ctx context.Context, token string) (*model.ProjectInvitation, int, error) {
+	if token == "" {
+		return nil, http.StatusBadRequest, errTokenRequired
+	}
+
+	invitation, err := s.store.GetProjectInvitationByHash(ctx, middleware.HashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, http.StatusBadRequest, errInvalidToken
+		}
+		return nil, http.StatusInternalServerError, errors.New("error loading invitation")
+	}
+
+	if invitation.AcceptedAt != nil || invitation.DeclinedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, http.StatusBadRequest, errInvalidToken
+	}
+
+	return invitation, 0, nil
+}
+
+func (s *ProjectInvitationService) accept(ctx context.Context, invitation *model.ProjectInvitation, userID int64) (int, error) {
+	if err := s.store.AcceptProjectInvitation(ctx, invitation.ID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusBadRequest, errInvalidToken
+		}
+		logging.FromContext(ctx).Error("accept: error accepting project invitation", "invitation_id", invitation.ID, "user_id", userID, "error", err)
+		return http.StatusInternalServerError, errors.New("error accepting invitation")
+	}
+
+	now := time.Now()
+	invitation.AcceptedAt = &now
+	return 0, nil
+}
+
+func (s *ProjectInvitationService) sendInvitationEmail(project *model.Project, invitation *model.ProjectInvitation, token string) error {
+	return s.mailer.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to %s", project.Name),
+		Body: fmt.Sprintf("You have been invited to the project %s as %s. Accept or decline the invitation here:\n\n%s/accept-project-invitation?token=%s\n\nYou can create an account from the link if you don't have one yet. The link expires in %s.",
+			project.Name, invitation.Role, config.Envs.AppURL, url.QueryEscape(token), config.Envs.ProjectInvitationTTL),
+	})
+}
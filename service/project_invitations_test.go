@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *orgStore) CreateUser(ctx context.Context, u *model.User) (*model.User, error) {
+	u.ID = int64(len(s.users) + 100)
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *orgStore) SetUserVerified(ctx context.Context, userID int64) error {
+	user, ok := s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Verified = true
+	return nil
+}
+
+func (s *orgStore) CreateProjectInvitation(ctx context.Context, inv *model.ProjectInvitation) (*model.ProjectInvitation, error) {
+	inv.ID = int64(len(s.projectInvitations) + 1)
+	s.projectInvitations = append(s.projectInvitations, inv)
+	return inv, nil
+}
+
+func (s *orgStore) GetProjectInvitationByHash(ctx context.Context, tokenHash string) (*model.ProjectInvitation, error) {
+	for _, inv := range s.projectInvitations {
+		if inv != nil && inv.TokenHash == tokenHash {
+			clone := *inv
+			return &clone, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *orgStore) ListProjectInvitations(ctx context.Context, orgID, projectID int64, now time.Time) ([]model.ProjectInvitation, error) {
+	invitations := []model.ProjectInvitation{}
+	for _, inv := range s.projectInvitations {
+		if inv != nil && inv.OrgID == orgID && inv.ProjectID == projectID && inv.AcceptedAt == nil && inv.DeclinedAt == nil && inv.ExpiresAt.After(now) {
+			invitations = append(invitations, *inv)
+		}
+	}
+	return invitations, nil
+}
+
+func (s *orgStore) RevokeProjectInvitation(ctx context.Context, orgID, projectID, id int64) error {
+	if id < 1 || id > int64(len(s.projectInvitations)) {
+		return sql.ErrNoRows
+	}
+	inv := s.projectInvitations[id-1]
+	if inv == nil || inv.OrgID != orgID || inv.ProjectID != projectID || inv.AcceptedAt != nil || inv.DeclinedAt != nil {
+		return sql.ErrNoRows
+	}
+	s.projectInvitations[id-1] = nil
+	return nil
+}
+
+func (s *orgStore) AcceptProjectInvitation(ctx context.Context, id, userID int64) error {
+	inv := s.projectInvitations[id-1]
+	if inv == nil || inv.AcceptedAt != nil || inv.DeclinedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	inv.AcceptedAt = &now
+	if _, ok := s.members[orgMemberKey{inv.OrgID, userID}]; !ok {
+		s.members[orgMemberKey{inv.OrgID, userID}] = model.OrgRoleGuest
+	}
+	s.userGrants[projectGrantKey{inv.ProjectID, userID}] = inv.Role
+	return nil
+}
+
+func (s *orgStore) DeclineProjectInvitation(ctx context.Context, id int64) error {
+	inv := s.projectInvitations[id-1]
+	if inv == nil || inv.AcceptedAt != nil || inv.DeclinedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	inv.DeclinedAt = &now
+	return nil
+}
+
+// inviteToProject invites email to project 10 as the admin and returns the
+// token from the invitation email.
+func inviteToProject(t *testing.T, router http.Handler, m *mailer.MockMailer, token, email, role string) string {
+	t.Helper()
+
+	rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/projects/10/invitations", token, "", &model.CreateProjectInvitationPayload{Email: email, Role: role})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	body := m.Sent[len(m.Sent)-1].Body
+	_, query, _ := strings.Cut(strings.Fields(body[strings.Index(body, "http"):])[0], "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values.Get("token")
+}
+
+func TestProjectInvitations(t *testing.T) {
+	store := newOrgStore()
+	m := &mailer.MockMailer{}
+	router := newOrgRouter(store, m)
+	admin := login(t, store, 1, "")
+	joe := login(t, store, 7, "")
+	guest := login(t, store, 8, "")
+
+	t.Run("should only let project admins invite", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/projects/10/invitations", guest, "", &model.CreateProjectInvitationPayload{Email: "joe@mail.com"})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject unknown project roles", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/projects/10/invitations", admin, "", &model.CreateProjectInvitationPayload{Email: "joe@mail.com", Role: "owner"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	var token string
+
+	t.Run("should email an invitation", func(t *testing.T) {
+		token = inviteToProject(t, router, m, admin, "joe@mail.com", model.ProjectRoleEditor)
+
+		if m.Sent[0].To != "joe@mail.com" || !strings.Contains(m.Sent[0].Body, "/accept-project-invitation?token=") {
+			t.Errorf("unexpected invitation email %+v", m.Sent[0])
+		}
+
+		rr := orgRequest(t, router, http.MethodGet, "/orgs/globex/projects/10/invitations", admin, "", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if strings.Contains(rr.Body.String(), store.projectInvitations[0].TokenHash) {
+			t.Error("expected the token hash to stay private")
+		}
+	})
+
+	t.Run("should only accept for the invited address", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/projects/invitations/accept", guest, "", &model.ProjectInvitationTokenPayload{Token: token})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should grant the invited role on accept", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/projects/invitations/accept", joe, "", &model.ProjectInvitationTokenPayload{Token: token})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if role := store.members[orgMemberKey{2, 7}]; role != model.OrgRoleGuest {
+			t.Errorf("expected joe to join globex as a guest, got %q", role)
+		}
+
+		rr = orgRequest(t, ifMatchAny(router), http.MethodPut, "/orgs/globex/projects/10", joe, "", &model.Project{Name: "Renamed"})
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected joe to edit the project, got %d", rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodPost, "/projects/invitations/accept", joe, "", &model.ProjectInvitationTokenPayload{Token: token})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected a used invitation to be rejected, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should not open the rest of the organization to invitees", func(t *testing.T) {
+		store.projects[11] = &model.Project{ID: 11, OrgID: 2, Name: "Sibling"}
+		defer delete(store.projects, 11)
+
+		rr := orgRequest(t, router, http.MethodGet, "/orgs/globex/projects/11", joe, "", nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d for a sibling project, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodGet, "/orgs/globex/members", joe, "", nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d for the member list, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodGet, "/orgs/globex/projects/10", joe, "", nil)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected joe to keep reading the invited project, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should create an account for new invitees", func(t *testing.T) {
+		token := inviteToProject(t, router, m, admin, "new@mail.com", "")
+
+		rr := orgRequest(t, router, http.MethodPost, "/projects/invitations/signup", "", "", &model.AcceptProjectInvitationSignupPayload{
+			Token:     token,
+			FirstName: "New",
+			LastName:  "Invitee",
+			Password:  "password123",
+		})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		user, err := store.GetUserByEmail(context.Background(), "new@mail.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.Verified || user.Role != model.RoleUser {
+			t.Errorf("expected a verified user account, got %+v", user)
+		}
+		if role := store.userGrants[projectGrantKey{10, user.ID}]; role != model.ProjectRoleViewer {
+			t.Errorf("expected viewer access to the project, got %q", role)
+		}
+	})
+
+	t.Run("should not sign up existing accounts", func(t *testing.T) {
+		token := inviteToProject(t, router, m, admin, "guest@mail.com", "")
+
+		rr := orgRequest(t, router, http.MethodPost, "/projects/invitations/signup", "", "", &model.AcceptProjectInvitationSignupPayload{
+			Token:     token,
+			FirstName: "Guest",
+			LastName:  "User",
+			Password:  "password123",
+		})
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should decline without an account", func(t *testing.T) {
+		token := inviteToProject(t, router, m, admin, "nobody@mail.com", "")
+
+		rr := orgRequest(t, router, http.MethodPost, "/projects/invitations/decline", "", "", &model.ProjectInvitationTokenPayload{Token: token})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodPost, "/projects/invitations/decline", "", "", &model.ProjectInvitationTokenPayload{Token: token})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected a declined invitation to be rejected, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should revoke pending invitations", func(t *testing.T) {
+		token := inviteToProject(t, router, m, admin, "revoked@mail.com", "")
+		id := len(store.projectInvitations)
+
+		rr := orgRequest(t, router, http.MethodDelete, "/orgs/globex/projects/10/invitations/"+strconv.Itoa(id), admin, "", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodPost, "/projects/invitations/decline", "", "", &model.ProjectInvitationTokenPayload{Token: token})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected a revoked invitation to be rejected, got %d", rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodDelete, "/orgs/globex/projects/10/invitations/1", admin, "", nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected answered invitations to be kept, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should reject expired invitations", func(t *testing.T) {
+		token := inviteToProject(t, router, m, admin, "late@mail.com", "")
+		store.projectInvitations[len(store.projectInvitations)-1].ExpiresAt = time.Now().Add(-time.Minute)
+
+		rr := orgRequest(t, router, http.MethodPost, "/projects/invitations/decline", "", "", &model.ProjectInvitationTokenPayload{Token: token})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
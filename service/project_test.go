@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
 	"github.com/gorilla/mux"
 )
 
@@ -102,6 +104,7 @@ func TestDeleteProject(t *testing.T) {
 			if err != nil {
 					t.Fatal(err)
 			}
+			req.Header.Set("If-Match", utils.ETag(1))
 
 			rr := httptest.NewRecorder()
 			router := mux.NewRouter()
@@ -110,7 +113,7 @@ func TestDeleteProject(t *testing.T) {
 
 			router.ServeHTTP(rr, req)
 
-			if rr.Code != http.StatusOK {
+			if rr.Code != http.StatusNoContent {
 					t.Error("invalid status code", rr.Code)
 			}
 	})
@@ -134,6 +137,7 @@ func TestUpdateProject(t *testing.T) {
 			if err != nil {
 					t.Fatal(err)
 			}
+			req.Header.Set("If-Match", utils.ETag(1))
 
 			rr := httptest.NewRecorder()
 			router := mux.NewRouter()
@@ -146,4 +150,53 @@ func TestUpdateProject(t *testing.T) {
 					t.Error("invalid status code", rr.Code)
 			}
 	})
-}
\ No newline at end of file
+}
+type patchProjectStore struct {
+	repository.MockStore
+	patch *model.ProjectPatch
+}
+
+func (s *patchProjectStore) PatchProject(ctx context.Context, orgID int64, id string, version int64, patch *model.ProjectPatch) (*model.Project, error) {
+	s.patch = patch
+	return &model.Project{ID: 42, OrgID: orgID, Name: "Stored project"}, nil
+}
+
+func TestPatchProject(t *testing.T) {
+	store := &patchProjectStore{}
+	service := NewProjectService(store)
+
+	t.Run("should return the stored project", func(t *testing.T) {
+		rr := patchRequest(service.handlePatchProject, "/projects/42", utils.MergePatchContentType, `{"name":"Renamed"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		if store.patch.Name == nil || *store.patch.Name != "Renamed" {
+			t.Errorf("expected the name to be patched, got %+v", store.patch)
+		}
+
+		var project model.Project
+		if err := json.Unmarshal(rr.Body.Bytes(), &project); err != nil {
+			t.Fatal(err)
+		}
+		if project.Name != "Stored project" {
+			t.Errorf("expected the project as stored, got %+v", project)
+		}
+	})
+
+	t.Run("should leave fields out of an empty patch", func(t *testing.T) {
+		rr := patchRequest(service.handlePatchProject, "/projects/42", "application/json", `{}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if store.patch.Name != nil {
+			t.Errorf("expected nothing to be patched, got %+v", store.patch)
+		}
+	})
+
+	t.Run("should reject fields a project does not have", func(t *testing.T) {
+		rr := patchRequest(service.handlePatchProject, "/projects/42", utils.MergePatchContentType, `{"owner":"joe"}`)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
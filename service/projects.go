@@ -2,13 +2,10 @@ package service
 
 import (
 	"database/sql"
-	"encoding/json"
-	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
 	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
@@ -25,108 +22,168 @@ func NewProjectService(s repository.Store) *ProjectService {
 }
 
 func (s *ProjectService) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/projects", middleware.AuthHandler(s.handleCreateProject, s.store)).Methods("POST")
-	r.HandleFunc("/projects/{id}", middleware.AuthHandler(s.handleGetProject, s.store)).Methods("GET")
-	r.HandleFunc("/projects/{id}", middleware.AuthHandler(s.handleDeleteProject, s.store)).Methods("DELETE")
-	r.HandleFunc("/projects/{id}", middleware.AuthHandler(s.handleUpdateProject, s.store)).Methods("PUT")
+	r.HandleFunc("/projects", middleware.RequireRole(model.RoleUser, middleware.OrgHandler(model.OrgRoleMember, s.handleCreateProject, s.store), s.store, model.ScopeProjectsWrite)).Methods("POST")
+	r.HandleFunc("/projects/{id}", projectReader(s.store, model.ProjectRoleViewer, s.handleGetProject)).Methods("GET")
+	r.HandleFunc("/projects/{id}", projectWriter(s.store, model.ProjectRoleAdmin, s.handleDeleteProject)).Methods("DELETE")
+	r.HandleFunc("/projects/{id}", projectWriter(s.store, model.ProjectRoleEditor, s.handleUpdateProject)).Methods("PUT")
+	r.HandleFunc("/projects/{id}", projectWriter(s.store, model.ProjectRoleEditor, s.handlePatchProject)).Methods("PATCH")
+	r.HandleFunc("/projects/{id}/grants", projectReader(s.store, model.ProjectRoleViewer, s.handleListGrants)).Methods("GET")
+	r.HandleFunc("/projects/{id}/grants/users/{userID}", projectWriter(s.store, model.ProjectRoleAdmin, s.handleSetUserGrant)).Methods("PUT")
+	r.HandleFunc("/projects/{id}/grants/users/{userID}", projectWriter(s.store, model.ProjectRoleAdmin, s.handleDeleteUserGrant)).Methods("DELETE")
+	r.HandleFunc("/projects/{id}/grants/teams/{teamID}", projectWriter(s.store, model.ProjectRoleAdmin, s.handleSetTeamGrant)).Methods("PUT")
+	r.HandleFunc("/projects/{id}/grants/teams/{teamID}", projectWriter(s.store, model.ProjectRoleAdmin, s.handleDeleteTeamGrant)).Methods("DELETE")
+	r.HandleFunc("/projects/{id}/access/{userID}", projectReader(s.store, model.ProjectRoleViewer, s.handleGetAccess)).Methods("GET")
 }
 
+// projectReader lets users with role on the project read it. Every member of
+// the organization, guests included, can get past OrgHandler; their project
+// role decides.
+func projectReader(store repository.Store, role string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleGuest, middleware.ProjectHandler(role, handlerFunc, store), store), store, model.ScopeProjectsRead)
+}
 
-func (s *ProjectService) handleCreateProject(w http.ResponseWriter, r *http.Request){
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "invalid request payload"})
-		return
-	}
-
-	defer r.Body.Close()
+// projectWriter lets users with role on the project change it.
+func projectWriter(store repository.Store, role string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return middleware.RequireRole(model.RoleUser, middleware.OrgHandler(model.OrgRoleGuest, middleware.ProjectHandler(role, handlerFunc, store), store), store, model.ScopeProjectsWrite)
+}
 
-	var project *model.Project
-	if err := json.Unmarshal(body, &project); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "invalid request payload"})
+func (s *ProjectService) handleCreateProject(w http.ResponseWriter, r *http.Request) {
+	var project model.Project
+	if !utils.ReadJSON(w, r, &project) {
 		return
 	}
 
-	if project.Name == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "missing name"})
+	p, err := s.store.CreateProject(r.Context(), middleware.GetOrgIDFromContext(r.Context()), &project)
+	if err != nil {
+		writeStoreError(w, r, err, "handleCreateProject: error creating project")
 		return
 	}
 
-	p, err := s.store.CreateProject(project)
-	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
-		return
+	// the creator manages access to the project, whatever their role in the
+	// organization
+	orgID, userID := middleware.GetOrgIDFromContext(r.Context()), middleware.GetUserIDFromContext(r.Context())
+	if err := s.store.SetProjectUserGrant(r.Context(), orgID, p.ID, userID, model.ProjectRoleAdmin); err != nil {
+		logging.FromContext(r.Context()).Error("handleCreateProject: error granting admin", "project_id", p.ID, "error", err)
 	}
 
+	utils.SetETag(w, p.Version)
 	utils.WriteJSON(w, http.StatusCreated, p)
-
 }
 
-func (s *ProjectService) handleGetProject(w http.ResponseWriter, r *http.Request){
+func (s *ProjectService) handleGetProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	project, err := s.store.GetProject(id)
+	project, err := s.store.GetProject(r.Context(), middleware.GetOrgIDFromContext(r.Context()), id)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Project not found")
 			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
+	utils.SetETag(w, project.Version)
+	if utils.NotModified(r, project.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	utils.WriteJSON(w, http.StatusOK, project)
 }
 
-func (s *ProjectService) handleDeleteProject(w http.ResponseWriter, r *http.Request){
+func (s *ProjectService) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	log.Printf("handleDeleteProject: attempting to delete project id %s", id)
-	
-	err := s.store.DeleteProject(id)
+	logging.FromContext(r.Context()).Debug("handleDeleteProject: attempting to delete project", "project_id", id)
+
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+	current, err := s.store.GetProject(r.Context(), orgID, id)
+	if err != nil {
+		writeStoreError(w, r, err, "handleDeleteProject: error loading project", "project_id", id)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, current.Version) {
+		return
+	}
+
+	err = s.store.DeleteProject(r.Context(), orgID, id, current.Version)
 	if err != nil {
-			if err == sql.ErrNoRows {
-					log.Printf("handleDeleteProject: project id %s not found", id)
-					utils.WriteJSON(w, http.StatusNotFound, model.ErrorResponse{Error: "Project not found"})
-					return
-			}
-			log.Printf("handleDeleteProject: error deleting project id %s: %v", id, err)
-			utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "Error deleting project"})
+		if err == sql.ErrNoRows {
+			logging.FromContext(r.Context()).Info("handleDeleteProject: project not found", "project_id", id)
+			utils.WriteError(w, http.StatusNotFound, "Project not found")
 			return
+		}
+		writeStoreError(w, r, err, "handleDeleteProject: error deleting project", "project_id", id)
+		return
 	}
 
-	log.Printf("handleDeleteProject: project id %s deleted successfully", id)
-	utils.WriteJSON(w, http.StatusOK, fmt.Sprintf("Deleted project %s", id))
+	logging.FromContext(r.Context()).Info("handleDeleteProject: project deleted", "project_id", id)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *ProjectService) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	orgID := middleware.GetOrgIDFromContext(r.Context())
 
-	body, err := io.ReadAll(r.Body)
+	current, err := s.store.GetProject(r.Context(), orgID, id)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "invalid request payload"})
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "failed to update project")
+		return
+	}
+	if !utils.CheckIfMatch(w, r, current.Version) {
 		return
 	}
 
-	defer r.Body.Close()
-
-	var project *model.Project
-	if err := json.Unmarshal(body, &project); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "invalid request payload"})
+	var project model.Project
+	if !utils.ReadJSON(w, r, &project) {
 		return
 	}
 
 	project.ID, _ = strconv.ParseInt(id, 10, 64)
-	if project.Name == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "missing name"})
+	project.Version = current.Version
+	updatedProject, err := s.store.UpdateProject(r.Context(), orgID, &project)
+	if err != nil {
+		writeStoreError(w, r, err, "handleUpdateProject: failed to update project")
 		return
 	}
 
-	updatedProject, err := s.store.UpdateProject(project)
+	utils.SetETag(w, updatedProject.Version)
+	utils.WriteJSON(w, http.StatusOK, updatedProject)
+}
+
+// handlePatchProject applies a JSON merge patch to the project, changing only
+// the fields the patch sets, and returns the project as stored.
+func (s *ProjectService) handlePatchProject(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+
+	current, err := s.store.GetProject(r.Context(), orgID, id)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "failed to update project"})
+		writeStoreError(w, r, err, "handlePatchProject: error loading project")
+		return
+	}
+	if !utils.CheckIfMatch(w, r, current.Version) {
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, updatedProject)
+	var patch model.ProjectPatch
+	if !utils.ReadMergePatch(w, r, &patch) {
+		return
+	}
 
+	project, err := s.store.PatchProject(r.Context(), orgID, id, current.Version, &patch)
+	if err != nil {
+		writeStoreError(w, r, err, "handlePatchProject: error updating project")
+		return
+	}
+
+	utils.SetETag(w, project.Version)
+	utils.WriteJSON(w, http.StatusOK, project)
 }
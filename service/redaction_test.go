@@ -0,0 +1,243 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+)
+
+// captureLogs sends everything logged until the test ends, at debug level,
+// to the returned buffer.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, "json", "debug", []string{"email", "ip"}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// TestLogRedaction calls every route of the API with credentials, passwords
+// and tokens, and checks that none of them, nor any password hash or email
+// address, ends up in the logs.
+func TestLogRedaction(t *testing.T) {
+	const password = "Tr0ub4dor&3-correct-horse"
+
+	pub, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.New(0, keyring.Key{ID: "k1", Method: jwt.SigningMethodEdDSA, Private: private, Public: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleware.SetKeyring(keys)
+	defer middleware.SetKeyring(nil)
+
+	hash, err := middleware.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := captureLogs(t)
+	store := newOrgStore()
+	for _, user := range store.users {
+		user.Password = hash
+	}
+	m := &mailer.MockMailer{}
+
+	defer func(enabled bool, token string) {
+		config.Envs.PprofEnabled, config.Envs.MetricsToken = enabled, token
+	}(config.Envs.PprofEnabled, config.Envs.MetricsToken)
+	config.Envs.PprofEnabled, config.Envs.MetricsToken = true, "scrape-token"
+
+	// record the route each request reaches, to tell that every route was
+	// exercised rather than answered by the not found handler
+	reached := map[string]bool{}
+	router := mux.NewRouter()
+	router.Use(middleware.LogRoute, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			template, _ := mux.CurrentRoute(r).GetPathTemplate()
+			reached[r.Method+" "+template] = true
+			next.ServeHTTP(w, r)
+		})
+	})
+	RegisterRoutes(router, store, m, keys)
+
+	admin := login(t, store, 1, "")
+
+	send := func(method, path, token string, payload any) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(method, path, &body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(SharePasswordHeader, password)
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		middleware.RequestLogger(router).ServeHTTP(rr, req)
+		return rr
+	}
+
+	var shareLink model.CreatedShareLink
+	rr := send(http.MethodPost, "/api/v1/orgs/globex/projects/10/share-links", admin, &model.CreateShareLinkPayload{Password: password})
+	if err := json.NewDecoder(rr.Body).Decode(&shareLink); err != nil {
+		t.Fatal(err)
+	}
+
+	// values of the route variables
+	vars := map[string]string{
+		"org":          "globex",
+		"id":           "10",
+		"userID":       "7",
+		"teamID":       "1",
+		"invitationID": "1",
+		"linkID":       "1",
+		"token":        shareLink.Token,
+		"scope":        model.LoginScopeAccount,
+		"key":          "joe@mail.com",
+	}
+
+	secrets := []string{password, hash, admin, shareLink.Token, "admin@mail.com", "joe@mail.com", "new@mail.com"}
+
+	credentials := map[string]any{
+		"email":           "new@mail.com",
+		"password":        password,
+		"currentPassword": password,
+		"newPassword":     password + "!",
+		"firstName":       "New",
+		"lastName":        "User",
+		"name":            "Launch",
+		"token":           shareLink.Token,
+		"code":            "123456",
+		"role":            model.OrgRoleMember,
+		"projectID":       10,
+	}
+
+	t.Run("should not log credentials on sign up and login", func(t *testing.T) {
+		send(http.MethodPost, "/api/v1/users/register", "", credentials)
+		send(http.MethodPost, "/api/v1/users/login", "", &model.LoginRequest{Email: "joe@mail.com", Password: "wrong " + password})
+		rr := send(http.MethodPost, "/api/v1/users/login", "", &model.LoginRequest{Email: "joe@mail.com", Password: password})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var token string
+		if err := json.NewDecoder(rr.Body).Decode(&token); err != nil {
+			t.Fatal(err)
+		}
+		secrets = append(secrets, token)
+
+		rr = send(http.MethodPost, "/api/v1/users/me/tokens", admin, &model.CreateAccessTokenPayload{Name: "ci", Scopes: []string{model.ScopeProjectsRead}})
+		var created model.CreatedAccessToken
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || created.Token == "" {
+			t.Fatalf("expected an access token, got %d", rr.Code)
+		}
+		secrets = append(secrets, created.Token)
+	})
+
+	// profiles run for as many seconds as asked
+	queries := map[string]string{
+		"/debug/pprof/profile": "?seconds=1",
+		"/debug/pprof/trace":   "?seconds=0.01",
+	}
+
+	t.Run("should not log secrets in any handler", func(t *testing.T) {
+		type route struct{ method, path string }
+		var routes []route
+		err := router.Walk(func(r *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			template, err := r.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			methods, err := r.GetMethods()
+			if err != nil {
+				return nil
+			}
+			for _, method := range methods {
+				routes = append(routes, route{method, template})
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// requests that delete things go last, deleting the account very last
+		rank := func(r route) int {
+			switch {
+			case r.method == http.MethodDelete && r.path == "/api/v1/users/me":
+				return 2
+			case r.method == http.MethodDelete:
+				return 1
+			}
+			return 0
+		}
+		sort.SliceStable(routes, func(i, j int) bool {
+			return rank(routes[i]) < rank(routes[j])
+		})
+
+		// logging out must not end the session the other requests use
+		other := login(t, store, 1, "")
+		secrets = append(secrets, other)
+
+		for _, r := range routes {
+			path := r.path
+			for name, value := range vars {
+				path = strings.ReplaceAll(path, "{"+name+"}", value)
+			}
+			token := admin
+			if r.path == "/api/v1/users/logout" {
+				token = other
+			}
+			send(r.method, path+queries[r.path], token, credentials)
+		}
+
+		if len(routes) == 0 {
+			t.Fatal("expected routes to be registered")
+		}
+		for _, r := range routes {
+			if !reached[r.method+" "+r.path] {
+				t.Errorf("expected %s %s to be called", r.method, r.path)
+			}
+		}
+	})
+
+	t.Run("should not log secrets of single sign-on", func(t *testing.T) {
+		idp, _, service := newOIDCTest(t)
+		secrets = append(secrets, idp.ClientSecret)
+
+		oidcLogin(t, service, idp, true)
+		if rr := oidcLogin(t, service, idp, false); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	if !strings.Contains(logs.String(), `"msg":"request"`) {
+		t.Fatal("expected requests to be logged")
+	}
+	for _, secret := range secrets {
+		if secret != "" && strings.Contains(logs.String(), secret) {
+			t.Errorf("found %q in the logs", secret)
+		}
+	}
+}
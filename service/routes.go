@@ -0,0 +1,93 @@
+package service
+
+import (
+	"log/slog"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/metrics"
+	"github.com/DaffaJatmiko/go-rest-project-manager/oidc"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/gorilla/mux"
+)
+
+// RegisterRoutes registers the routes of every service on router: the API
+// under /api/v1, and the key set, probes and metrics at the top level.
+// Single sign-on and profiling are only served when configured, and metrics
+// outside development only with METRICS_TOKEN set: every scrape queries the
+// database and reveals business totals. checks decide whether /readyz
+// reports the server ready.
+func RegisterRoutes(router *mux.Router, store repository.Store, m mailer.Mailer, keys *keyring.Keyring, checks ...HealthCheck) {
+	subRouter := router.PathPrefix("/api/v1").Subrouter()
+
+	userService := NewUserService(store, m)
+	userService.RegisterRoutes(subRouter)
+
+	organizationService := NewOrganizationService(store, m)
+	organizationService.RegisterRoutes(subRouter)
+
+	teamService := NewTeamService(store)
+	teamService.RegisterRoutes(subRouter)
+
+	projectInvitationService := NewProjectInvitationService(store, m)
+	projectInvitationService.RegisterRoutes(subRouter)
+
+	shareLinkService := NewShareLinkService(store)
+	shareLinkService.RegisterRoutes(subRouter)
+
+	// tasks and projects are reachable under /orgs/{org} and, with the
+	// organization taken from the X-Organization header, at the top level
+	orgRouter := subRouter.PathPrefix("/orgs/{org}").Subrouter()
+
+	taskService := NewTaskService(store)
+	taskService.RegisterRoutes(subRouter)
+	taskService.RegisterRoutes(orgRouter)
+
+	projectService := NewProjectService(store)
+	projectService.RegisterRoutes(subRouter)
+	projectService.RegisterRoutes(orgRouter)
+	projectInvitationService.RegisterProjectRoutes(subRouter)
+	projectInvitationService.RegisterProjectRoutes(orgRouter)
+	shareLinkService.RegisterProjectRoutes(subRouter)
+	shareLinkService.RegisterProjectRoutes(orgRouter)
+
+	if config.Envs.OIDCIssuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       config.Envs.OIDCIssuer,
+			ClientID:     config.Envs.OIDCClientID,
+			ClientSecret: config.Envs.OIDCClientSecret,
+			RedirectURL:  config.Envs.OIDCRedirectURL,
+			Scopes:       config.Envs.OIDCScopes,
+		}, nil)
+		oidcService := NewOIDCService(store, provider)
+		oidcService.RegisterRoutes(subRouter)
+	}
+
+	accessTokenService := NewAccessTokenService(store)
+	accessTokenService.RegisterRoutes(subRouter)
+
+	sessionService := NewSessionService(store)
+	sessionService.RegisterRoutes(subRouter)
+
+	docsService := NewDocsService()
+	docsService.RegisterRoutes(subRouter)
+
+	adminService := NewAdminService(store, m)
+	adminService.RegisterRoutes(subRouter)
+
+	jwksService := NewJWKSService(keys)
+	jwksService.RegisterRoutes(router)
+
+	healthService := NewHealthService(store, checks...)
+	healthService.RegisterRoutes(router)
+	if config.Envs.PprofEnabled {
+		healthService.RegisterProfilingRoutes(router)
+	}
+
+	if config.Envs.MetricsToken != "" || config.Envs.DevMode() {
+		router.Handle("/metrics", metrics.Handler(config.Envs.MetricsToken)).Methods("GET")
+	} else {
+		slog.Warn("RegisterRoutes: /metrics is not served, set METRICS_TOKEN to enable it")
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/gorilla/mux"
+)
+
+func TestMetricsRoute(t *testing.T) {
+	defer func(env, token string) {
+		config.Envs.Env, config.Envs.MetricsToken = env, token
+	}(config.Envs.Env, config.Envs.MetricsToken)
+
+	scrape := func() int {
+		router := mux.NewRouter()
+		RegisterRoutes(router, &repository.MockStore{}, &mailer.MockMailer{}, nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rr.Code
+	}
+
+	t.Run("should not serve metrics without a token outside development", func(t *testing.T) {
+		config.Envs.Env, config.Envs.MetricsToken = "production", ""
+
+		if code := scrape(); code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, code)
+		}
+	})
+
+	t.Run("should require the token when one is set", func(t *testing.T) {
+		config.Envs.Env, config.Envs.MetricsToken = "production", "scrape-token"
+
+		if code := scrape(); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("should serve metrics openly in development", func(t *testing.T) {
+		config.Envs.Env, config.Envs.MetricsToken = "development", ""
+
+		if code := scrape(); code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, code)
+		}
+	})
+}
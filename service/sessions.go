@@ -0,0 +1,173 @@
+package service
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+const maxUserAgentLen = 512
+
+type SessionService struct {
+	store repository.Store
+}
+
+func NewSessionService(s repository.Store) *SessionService {
+	return &SessionService{store: s}
+}
+
+// RegisterRoutes registers the session management endpoints. Like the token
+// endpoints they declare no scopes, so only session tokens can use them, and
+// a support session can end itself but not sign the user out elsewhere.
+func (s *SessionService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/users/me/sessions", middleware.AuthHandler(s.handleListSessions, s.store)).Methods("GET")
+	r.HandleFunc("/users/me/sessions", middleware.OwnerHandler(s.handleRevokeOtherSessions, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/me/sessions/{id}", middleware.OwnerHandler(s.handleRevokeSession, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/logout", middleware.AuthHandler(s.handleLogout, s.store)).Methods("POST")
+}
+
+// handleLogout ends the current session and clears the browser cookies.
+func (s *SessionService) handleLogout(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	current := middleware.GetSessionIDFromContext(r.Context())
+
+	if err := s.store.RevokeSession(r.Context(), userID, current); err != nil && err != sql.ErrNoRows {
+		utils.WriteError(w, http.StatusInternalServerError, "error revoking session")
+		return
+	}
+
+	middleware.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *SessionService) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	current := middleware.GetSessionIDFromContext(r.Context())
+
+	sessions, err := s.store.ListSessions(r.Context(), userID, time.Now())
+	if err != nil {
+		writeStoreError(w, r, err, "handleListSessions: error listing sessions")
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	utils.WriteJSON(w, http.StatusOK, sessions)
+}
+
+func (s *SessionService) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+
+	if err := s.store.RevokeSession(r.Context(), userID, id); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Session not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error revoking session")
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("handleRevokeSession: session revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeOtherSessions signs the user out everywhere except on the
+// device making the request.
+func (s *SessionService) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	current := middleware.GetSessionIDFromContext(r.Context())
+
+	revoked, err := s.store.RevokeOtherSessions(r.Context(), userID, current)
+	if err != nil {
+		writeStoreError(w, r, err, "handleRevokeOtherSessions: error revoking sessions")
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("handleRevokeOtherSessions: sessions revoked", "revoked", revoked)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func createSession(store repository.Store, r *http.Request, userID int64) (*model.Session, error) {
+	session, err := newSession(r, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.CreateSession(r.Context(), session)
+}
+
+// newSession describes a new session for the device the request came from,
+// without storing it.
+func newSession(r *http.Request, userID int64) (*model.Session, error) {
+	id, _, err := middleware.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLen {
+		userAgent = userAgent[:maxUserAgentLen]
+	}
+
+	return &model.Session{
+		ID:        id,
+		UserID:    userID,
+		Device:    deviceName(userAgent),
+		IP:        middleware.ClientIP(r),
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(config.Envs.JWTTTL),
+	}, nil
+}
+
+// deviceName turns a user agent into a short label such as "Firefox on
+// Windows". It only needs to be good enough for users to recognise their
+// own devices.
+func deviceName(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, os := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, os.token) {
+			return browser + " on " + os.name
+		}
+	}
+
+	return browser
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+)
+
+// sessionStore keeps sessions in memory and knows every user ID.
+type sessionStore struct {
+	repository.MockStore
+	sessions map[string]*model.Session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: map[string]*model.Session{}}
+}
+
+func (s *sessionStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	return &model.User{ID: userID}, nil
+}
+
+func (s *sessionStore) CreateSession(ctx context.Context, sess *model.Session) (*model.Session, error) {
+	sess.CreatedAt = time.Now()
+	sess.LastSeenAt = sess.CreatedAt
+	s.sessions[sess.ID] = sess
+	return sess, nil
+}
+
+func (s *sessionStore) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return sess, nil
+}
+
+func (s *sessionStore) ListSessions(ctx context.Context, userID int64, now time.Time) ([]model.Session, error) {
+	sessions := []model.Session{}
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && sess.RevokedAt == nil && sess.ExpiresAt.After(now) {
+			sessions = append(sessions, *sess)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *sessionStore) RevokeSession(ctx context.Context, userID int64, id string) error {
+	sess, ok := s.sessions[id]
+	if !ok || sess.UserID != userID || sess.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	sess.RevokedAt = &now
+	return nil
+}
+
+func (s *sessionStore) RevokeOtherSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	var revoked int64
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && sess.ID != keepID && sess.RevokedAt == nil {
+			now := time.Now()
+			sess.RevokedAt = &now
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (s *sessionStore) TouchSession(ctx context.Context, id string, seenAt time.Time, ip string) error {
+	s.sessions[id].LastSeenAt = seenAt
+	s.sessions[id].IP = ip
+	return nil
+}
+
+// login creates a session for userID the way the login handlers do and
+// returns its token.
+func login(t *testing.T, store repository.Store, userID int64, userAgent string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/users/login", nil)
+	req.Header.Set("User-Agent", userAgent)
+
+	token, err := createAndSetAuthCookie(store, httptest.NewRecorder(), req, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// withSession runs handler behind AuthHandler with the given session token.
+func withSession(store repository.Store, handler http.HandlerFunc, method, path, pathTemplate, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return serve(middleware.AuthHandler(handler, store), pathTemplate, req)
+}
+
+func TestSessions(t *testing.T) {
+	const firefox = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0"
+	const iphone = "Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1"
+
+	t.Run("should list the user's sessions and mark the current one", func(t *testing.T) {
+		store := newSessionStore()
+		service := NewSessionService(store)
+		laptop := login(t, store, 7, firefox)
+		login(t, store, 7, iphone)
+		login(t, store, 8, firefox)
+
+		rr := withSession(store, service.handleListSessions, http.MethodGet, "/users/me/sessions", "/users/me/sessions", laptop)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var sessions []model.Session
+		if err := json.NewDecoder(rr.Body).Decode(&sessions); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(sessions) != 2 {
+			t.Fatalf("expected 2 sessions, got %d", len(sessions))
+		}
+
+		for _, sess := range sessions {
+			if sess.Current != (sess.Device == "Firefox on Windows") {
+				t.Errorf("unexpected current flag on %+v", sess)
+			}
+		}
+	})
+
+	t.Run("should reject tokens of a revoked session", func(t *testing.T) {
+		store := newSessionStore()
+		service := NewSessionService(store)
+		laptop := login(t, store, 7, firefox)
+		phone := login(t, store, 7, iphone)
+
+		var phoneID string
+		for id, sess := range store.sessions {
+			if sess.Device == "Safari on iOS" {
+				phoneID = id
+			}
+		}
+
+		rr := withSession(store, service.handleRevokeSession, http.MethodDelete, "/users/me/sessions/"+phoneID, "/users/me/sessions/{id}", laptop)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		rr = withSession(store, service.handleListSessions, http.MethodGet, "/users/me/sessions", "/users/me/sessions", phone)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should not revoke another user's session", func(t *testing.T) {
+		store := newSessionStore()
+		service := NewSessionService(store)
+		login(t, store, 8, firefox)
+		mine := login(t, store, 7, firefox)
+
+		var theirID string
+		for id, sess := range store.sessions {
+			if sess.UserID == 8 {
+				theirID = id
+			}
+		}
+
+		rr := withSession(store, service.handleRevokeSession, http.MethodDelete, "/users/me/sessions/"+theirID, "/users/me/sessions/{id}", mine)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should revoke all other sessions", func(t *testing.T) {
+		store := newSessionStore()
+		service := NewSessionService(store)
+		laptop := login(t, store, 7, firefox)
+		phone := login(t, store, 7, iphone)
+
+		rr := withSession(store, service.handleRevokeOtherSessions, http.MethodDelete, "/users/me/sessions", "/users/me/sessions", laptop)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if rr := withSession(store, service.handleListSessions, http.MethodGet, "/users/me/sessions", "/users/me/sessions", laptop); rr.Code != http.StatusOK {
+			t.Errorf("expected current session to stay valid, got %d", rr.Code)
+		}
+
+		if rr := withSession(store, service.handleListSessions, http.MethodGet, "/users/me/sessions", "/users/me/sessions", phone); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected other session to be revoked, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should reject tokens without a session", func(t *testing.T) {
+		store := newSessionStore()
+		token, err := middleware.SignJWT(map[string]any{"userID": "7", "exp": time.Now().Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := withSession(store, func(w http.ResponseWriter, r *http.Request) {}, http.MethodGet, "/projects", "/projects", token)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestDeviceName(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36":         "Chrome on macOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0": "Edge on Windows",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36":         "Chrome on Android",
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0":                                                "Firefox on Linux",
+		"curl/8.5.0": "curl",
+		"":           "Unknown device",
+	}
+
+	for userAgent, want := range tests {
+		if got := deviceName(userAgent); got != want {
+			t.Errorf("deviceName(%q) = %q, want %q", userAgent, got, want)
+		}
+	}
+}
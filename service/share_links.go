@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+// SharePasswordHeader carries the password of a password-protected share
+// link. It is a header rather than a query parameter so that it stays out of
+// access logs and browser history.
+const SharePasswordHeader = "X-Share-Password"
+
+var (
+	errShareLinkNotFound     = errors.New("share link not found")
+	errSharePasswordRequired = errors.New("this share link is password protected")
+	errSharePasswordInvalid  = errors.New("invalid share link password")
+)
+
+type ShareLinkService struct {
+	store repository.Store
+}
+
+func NewShareLinkService(s repository.Store) *ShareLinkService {
+	return &ShareLinkService{store: s}
+}
+
+// RegisterRoutes registers the public route share links are opened with. It
+// needs no account, the link token is the only credential.
+func (s *ShareLinkService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/share/{token}", s.handleGetSharedProject).Methods("GET")
+}
+
+// RegisterProjectRoutes registers the routes project admins manage share
+// links with, at the top level and under /orgs/{org}.
+func (s *ShareLinkService) RegisterProjectRoutes(r *mux.Router) {
+	r.HandleFunc("/projects/{id}/share-links", projectWriter(s.store, model.ProjectRoleAdmin, s.handleCreateShareLink)).Methods("POST")
+	r.HandleFunc("/projects/{id}/share-links", projectWriter(s.store, model.ProjectRoleAdmin, s.handleListShareLinks)).Methods("GET")
+	r.HandleFunc("/projects/{id}/share-links/{linkID}", projectWriter(s.store, model.ProjectRoleAdmin, s.handleRevokeShareLink)).Methods("DELETE")
+}
+
+func (s *ShareLinkService) handleCreateShareLink(w http.ResponseWriter, r *http.Request) {
+	var payload model.CreateShareLinkPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	link := &model.ShareLink{
+		OrgID:       middleware.GetOrgIDFromContext(r.Context()),
+		CreatedByID: middleware.GetUserIDFromContext(r.Context()),
+	}
+	link.ProjectID, _ = strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	if payload.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, payload.ExpiresInDays)
+		link.ExpiresAt = &expiresAt
+	}
+
+	if payload.Password != "" {
+		hash, err := middleware.HashPassword(payload.Password)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "error creating share link")
+			return
+		}
+		link.PasswordHash = hash
+	}
+
+	secret, hash, err := middleware.GenerateToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating share link")
+		return
+	}
+	link.TokenHash = hash
+
+	link, err = s.store.CreateShareLink(r.Context(), link)
+	if err != nil {
+		writeStoreError(w, r, err, "handleCreateShareLink: error creating share link")
+		return
+	}
+
+	token := middleware.SignShareToken(link.ID, secret)
+	logging.FromContext(r.Context()).Info("handleCreateShareLink: project shared", "project_id", link.ProjectID, "share_link_id", link.ID)
+	utils.WriteJSON(w, http.StatusCreated, model.CreatedShareLink{
+		ShareLink: *link,
+		Token:     token,
+		URL:       config.Envs.AppURL + "/share/" + token,
+	})
+}
+
+func (s *ShareLinkService) handleListShareLinks(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	links, err := s.store.ListShareLinks(r.Context(), middleware.GetOrgIDFromContext(r.Context()), projectID)
+	if err != nil {
+		writeStoreError(w, r, err, "handleListShareLinks: error listing share links")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, links)
+}
+
+func (s *ShareLinkService) handleRevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	id, err := strconv.ParseInt(mux.Vars(r)["linkID"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid share link id")
+		return
+	}
+
+	if err := s.store.RevokeShareLink(r.Context(), middleware.GetOrgIDFromContext(r.Context()), projectID, id); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, errShareLinkNotFound.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error revoking share link")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetSharedProject serves the project and its tasks to whoever holds a
+// valid share link. Links that are forged, revoked or expired all look the
+// same to the caller.
+func (s *ShareLinkService) handleGetSharedProject(w http.ResponseWriter, r *http.Request) {
+	// the token is in the URL, keep it out of caches and Referer headers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	link, ok := s.openShareLink(r.Context(), w, mux.Vars(r)["token"], r.Header.Get(SharePasswordHeader))
+	if !ok {
+		return
+	}
+
+	project, err := s.store.GetSharedProject(r.Context(), link.ProjectID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, errShareLinkNotFound.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error loading project")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, project)
+}
+
+// openShareLink checks a share link token, and the password if the link has
+// one, and returns the link. Wrong passwords lock the link like failed
+// logins lock an account. On failure it writes the response and returns
+// false.
+func (s *ShareLinkService) openShareLink(ctx context.Context, w http.ResponseWriter, token, password string) (*model.ShareLink, bool) {
+	id, secret, err := middleware.ParseShareToken(token)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, errShareLinkNotFound.Error())
+		return nil, false
+	}
+
+	link, err := s.store.GetShareLink(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, errShareLinkNotFound.Error())
+			return nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error loading share link")
+		return nil, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(middleware.HashToken(secret)), []byte(link.TokenHash)) != 1 {
+		utils.WriteError(w, http.StatusNotFound, errShareLinkNotFound.Error())
+		return nil, false
+	}
+
+	if link.RevokedAt != nil || (link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now())) {
+		utils.WriteError(w, http.StatusNotFound, errShareLinkNotFound.Error())
+		return nil, false
+	}
+
+	if link.PasswordHash != "" {
+		if password == "" {
+			utils.WriteError(w, http.StatusUnauthorized, errSharePasswordRequired.Error())
+			return nil, false
+		}
+
+		keys := shareLinkThrottleKeys(link.ID)
+		retryAfter, err := throttleRetryAfter(ctx, s.store, keys)
+		if err != nil {
+			logging.FromContext(ctx).Error("openShareLink: error checking lockout", "link_id", link.ID, "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, "error loading share link")
+			return nil, false
+		}
+		if retryAfter > 0 {
+			writeTooManyAttempts(w, retryAfter)
+			return nil, false
+		}
+
+		if !middleware.CheckPasswordHash(password, link.PasswordHash) {
+			recordThrottleFailure(ctx, s.store, keys)
+			utils.WriteError(w, http.StatusUnauthorized, errSharePasswordInvalid.Error())
+			return nil, false
+		}
+	}
+
+	return link, true
+}
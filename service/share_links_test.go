@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func (s *orgStore) CreateShareLink(ctx context.Context, link *model.ShareLink) (*model.ShareLink, error) {
+	link.ID = int64(len(s.shareLinks) + 1)
+	link.HasPassword = link.PasswordHash != ""
+	s.shareLinks = append(s.shareLinks, link)
+	return link, nil
+}
+
+func (s *orgStore) GetShareLink(ctx context.Context, id int64) (*model.ShareLink, error) {
+	if id < 1 || id > int64(len(s.shareLinks)) {
+		return nil, sql.ErrNoRows
+	}
+	clone := *s.shareLinks[id-1]
+	return &clone, nil
+}
+
+func (s *orgStore) RevokeShareLink(ctx context.Context, orgID, projectID, id int64) error {
+	if id < 1 || id > int64(len(s.shareLinks)) {
+		return sql.ErrNoRows
+	}
+	link := s.shareLinks[id-1]
+	if link.OrgID != orgID || link.ProjectID != projectID || link.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	link.RevokedAt = &now
+	return nil
+}
+
+func (s *orgStore) GetSharedProject(ctx context.Context, projectID int64) (*model.SharedProject, error) {
+	p, ok := s.projects[projectID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &model.SharedProject{
+		Name:  p.Name,
+		Tasks: []model.SharedTask{{ID: 1, Name: "Launch", Status: "IN_PROGRESS", Assignee: "Joe Doe"}},
+	}, nil
+}
+
+// throttledOrgStore adds the in-memory login throttles of throttleStore to
+// orgStore.
+type throttledOrgStore struct {
+	*orgStore
+	throttles *throttleStore
+}
+
+func (s *throttledOrgStore) GetLoginThrottle(ctx context.Context, scope, key string) (*model.LoginThrottle, error) {
+	return s.throttles.GetLoginThrottle(ctx, scope, key)
+}
+
+func (s *throttledOrgStore) RecordLoginFailure(ctx context.Context, scope, key string, since time.Time) (*model.LoginThrottle, error) {
+	return s.throttles.RecordLoginFailure(ctx, scope, key, since)
+}
+
+func (s *throttledOrgStore) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	return s.throttles.LockLogin(ctx, scope, key, until)
+}
+
+// createShareLink shares project 10 as the admin and returns the new link.
+func createShareLink(t *testing.T, router http.Handler, token string, payload *model.CreateShareLinkPayload) model.CreatedShareLink {
+	t.Helper()
+
+	rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/projects/10/share-links", token, "", payload)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	var link model.CreatedShareLink
+	if err := json.NewDecoder(rr.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+	return link
+}
+
+// openShareLink requests a shared project without any credentials.
+func openShareLink(router http.Handler, token, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/share/"+token, nil)
+	if password != "" {
+		req.Header.Set(SharePasswordHeader, password)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestShareLinks(t *testing.T) {
+	store := newOrgStore()
+	store.users[8].Role = model.RoleUser
+	router := newOrgRouter(store, &mailer.MockMailer{})
+	admin := login(t, store, 1, "")
+	guest := login(t, store, 8, "")
+
+	t.Run("should only let project admins share", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/projects/10/share-links", guest, "", &model.CreateShareLinkPayload{})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should reject invalid expiry", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/projects/10/share-links", admin, "", &model.CreateShareLinkPayload{ExpiresInDays: 366})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	link := createShareLink(t, router, admin, &model.CreateShareLinkPayload{})
+
+	t.Run("should serve the project without an account", func(t *testing.T) {
+		rr := openShareLink(router, link.Token, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if strings.Contains(rr.Body.String(), "@mail.com") {
+			t.Error("expected assignee emails to be redacted")
+		}
+
+		var project model.SharedProject
+		if err := json.NewDecoder(rr.Body).Decode(&project); err != nil {
+			t.Fatal(err)
+		}
+		if project.Name != "Secret" || len(project.Tasks) != 1 {
+			t.Errorf("unexpected shared project %+v", project)
+		}
+
+		if rr.Header().Get("Cache-Control") != "no-store" {
+			t.Error("expected shared projects not to be cached")
+		}
+	})
+
+	t.Run("should reject forged tokens", func(t *testing.T) {
+		id, _, _ := strings.Cut(link.Token, ".")
+		forged := strings.Replace(link.Token, id+".", "2.", 1)
+		store.shareLinks = append(store.shareLinks, &model.ShareLink{ID: 2, OrgID: 2, ProjectID: 10, TokenHash: store.shareLinks[0].TokenHash})
+
+		if rr := openShareLink(router, forged, ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+
+		if rr := openShareLink(router, link.Token+"x", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should require the password", func(t *testing.T) {
+		protected := createShareLink(t, router, admin, &model.CreateShareLinkPayload{Password: "hunter22"})
+		if !protected.HasPassword {
+			t.Error("expected the link to be password protected")
+		}
+
+		if rr := openShareLink(router, protected.Token, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		if rr := openShareLink(router, protected.Token, "wrong"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		if rr := openShareLink(router, protected.Token, "hunter22"); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should lock a link after repeated wrong passwords", func(t *testing.T) {
+		protected := createShareLink(t, router, admin, &model.CreateShareLinkPayload{Password: "hunter22"})
+		service := NewShareLinkService(&throttledOrgStore{orgStore: store, throttles: &throttleStore{throttles: map[string]*model.LoginThrottle{}}})
+		open := func(password string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/share/"+protected.Token, nil)
+			req.Header.Set(SharePasswordHeader, password)
+			return serve(service.handleGetSharedProject, "/share/{token}", req)
+		}
+
+		free := config.Envs.LoginMaxAttempts/2 + 1
+		for i := 0; i < free; i++ {
+			if rr := open("guess"); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("attempt %d: expected status code %d, got %d", i+1, http.StatusUnauthorized, rr.Code)
+			}
+		}
+
+		rr := open("hunter22")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+
+	t.Run("should reject expired links", func(t *testing.T) {
+		expiring := createShareLink(t, router, admin, &model.CreateShareLinkPayload{ExpiresInDays: 1})
+		if expiring.ExpiresAt == nil {
+			t.Fatal("expected the link to expire")
+		}
+
+		past := time.Now().Add(-time.Minute)
+		store.shareLinks[expiring.ID-1].ExpiresAt = &past
+
+		if rr := openShareLink(router, expiring.Token, ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should revoke links", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodDelete, "/orgs/globex/projects/10/share-links/"+strconv.FormatInt(link.ID, 10), admin, "", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if rr := openShareLink(router, link.Token, ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodDelete, "/orgs/globex/projects/10/share-links/"+strconv.FormatInt(link.ID, 10), admin, "", nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
@@ -1,14 +1,13 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
 	"errors"
-	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
 	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
@@ -16,9 +15,8 @@ import (
 	"github.com/gorilla/mux"
 )
 
-var errNameRequired = errors.New("name is required")
-var errProjectIDRequired = errors.New("project id is required")
-var errUserIDRequired = errors.New("user id is required")
+var errProjectNotFound = errors.New("project not found")
+var errAssigneeNotMember = errors.New("assignee is not a member of the organization")
 
 type TaskService struct {
 	store repository.Store
@@ -29,114 +27,245 @@ func NewTaskService(s repository.Store) *TaskService {
 }
 
 func (s *TaskService) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/tasks", middleware.AuthHandler(s.handleCreateTask, s.store)).Methods("POST")
-	r.HandleFunc("/tasks/{id}", middleware.AuthHandler(s.handleGetTask, s.store)).Methods("GET")
-	r.HandleFunc("/tasks/{id}", middleware.AuthHandler(s.handleDeleteTask, s.store)).Methods("DELETE")
-	r.HandleFunc("/tasks/{id}", middleware.AuthHandler(s.handleUpdateTask, s.store)).Methods("PUT")
+	r.HandleFunc("/tasks", middleware.RequireRole(model.RoleUser, middleware.OrgHandler(model.OrgRoleGuest, s.handleCreateTask, s.store), s.store, model.ScopeTasksWrite)).Methods("POST")
+	r.HandleFunc("/tasks/{id}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleGuest, s.taskHandler(model.ProjectRoleViewer, s.handleGetTask), s.store), s.store, model.ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/tasks/{id}", middleware.RequireRole(model.RoleUser, middleware.OrgHandler(model.OrgRoleGuest, s.taskHandler(model.ProjectRoleEditor, s.handleDeleteTask), s.store), s.store, model.ScopeTasksWrite)).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}", middleware.RequireRole(model.RoleUser, middleware.OrgHandler(model.OrgRoleGuest, s.taskHandler(model.ProjectRoleEditor, s.handleUpdateTask), s.store), s.store, model.ScopeTasksWrite)).Methods("PUT")
+	r.HandleFunc("/tasks/{id}", middleware.RequireRole(model.RoleUser, middleware.OrgHandler(model.OrgRoleGuest, s.taskHandler(model.ProjectRoleEditor, s.handlePatchTask), s.store), s.store, model.ScopeTasksWrite)).Methods("PATCH")
 }
 
-func (s *TaskService) handleCreateTask(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-			utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "Invalid request payload"})
+// taskHandler requires the user to hold role on the project of the task named
+// by the {id} route variable. Tasks of other organizations are not found.
+func (s *TaskService) taskHandler(role string, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		task, err := s.store.GetTask(r.Context(), middleware.GetOrgIDFromContext(r.Context()), mux.Vars(r)["id"])
+		if err != nil {
+			if err == sql.ErrNoRows {
+				utils.WriteError(w, http.StatusNotFound, "task not found")
+				return
+			}
+			utils.WriteError(w, http.StatusInternalServerError, "error loading task")
 			return
+		}
+
+		status, err := middleware.RequireProjectRole(r, s.store, strconv.FormatInt(task.ProjectID, 10), role)
+		if err != nil {
+			utils.WriteError(w, status, err.Error())
+			return
+		}
+
+		handlerFunc(w, r)
 	}
-	defer r.Body.Close()
+}
 
+func (s *TaskService) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 	var task model.Task
-	if err = json.Unmarshal(body, &task); err != nil {
-			utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request payload"})
-			return
+	if !utils.ReadJSON(w, r, &task) {
+		return
 	}
 
-	if err := validateTaskPayload(&task); err != nil {
-			utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
-			return
+	if task.Status == "" {
+		task.Status = model.TaskStatusTodo
+	}
+
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+	if err := s.validateTaskReferences(r.Context(), orgID, &task); err != nil {
+		writeTaskReferenceError(w, r, err)
+		return
 	}
 
-	log.Printf("Creating task: %+v", task)
+	if status, err := middleware.RequireProjectRole(r, s.store, strconv.FormatInt(task.ProjectID, 10), model.ProjectRoleEditor); err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
 
-	t, err := s.store.CreateTask(&task)
+	logging.FromContext(r.Context()).Debug("Creating task", "project_id", task.ProjectID, "assignee_id", task.AssignedToID)
+
+	t, err := s.store.CreateTask(r.Context(), orgID, &task)
 	if err != nil {
-			log.Printf("Error creating task: %v", err)
-			utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "Error creating task"})
-			return
+		writeStoreError(w, r, err, "Error creating task")
+		return
 	}
 
+	utils.SetETag(w, t.Version)
 	utils.WriteJSON(w, http.StatusCreated, t)
 }
 
-
 func (s *TaskService) handleGetTask(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-
-	task, err := s.store.GetTask(id)
+	task, err := s.store.GetTask(r.Context(), middleware.GetOrgIDFromContext(r.Context()), id)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "task not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	utils.SetETag(w, task.Version)
+	if utils.NotModified(r, task.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	utils.WriteJSON(w, http.StatusOK, task)
 }
 
 func (s *TaskService) handleDeleteTask(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	orgID := middleware.GetOrgIDFromContext(r.Context())
 
-	if err := s.store.DeleteTask(id); err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "error deleting task"})
+	current, err := s.store.GetTask(r.Context(), orgID, id)
+	if err != nil {
+		writeStoreError(w, r, err, "handleDeleteTask: error loading task")
+		return
+	}
+	if !utils.CheckIfMatch(w, r, current.Version) {
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, fmt.Sprintf("Deleted task %s", id))
 
+	if err := s.store.DeleteTask(r.Context(), orgID, id, current.Version); err != nil {
+		writeStoreError(w, r, err, "handleDeleteTask: error deleting task")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *TaskService) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	orgID := middleware.GetOrgIDFromContext(r.Context())
 
-	body, err := io.ReadAll(r.Body)
+	current, err := s.store.GetTask(r.Context(), orgID, id)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "Invalid request payload"})
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "task not found")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "Error updating task")
+		return
+	}
+	if !utils.CheckIfMatch(w, r, current.Version) {
 		return
 	}
 
-	defer r.Body.Close()
-
-	var task *model.Task
-	if err := json.Unmarshal(body, &task); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "invalid request payload"})
+	var task model.Task
+	if !utils.ReadJSON(w, r, &task) {
 		return
 	}
 
 	task.ID, _ = strconv.ParseInt(id, 10, 64)
-	if err := validateTaskPayload(task); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+	task.Version = current.Version
+	if task.Status == "" {
+		task.Status = current.Status
+	}
+
+	if !s.checkTaskChange(w, r, orgID, current, &task) {
 		return
 	}
 
-	updatedTask, err := s.store.UpdateTask(task)
+	updatedTask, err := s.store.UpdateTask(r.Context(), orgID, &task)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "Error updating task"})
+		writeStoreError(w, r, err, "handleUpdateTask: error updating task")
 		return
 	}
 
+	utils.SetETag(w, updatedTask.Version)
 	utils.WriteJSON(w, http.StatusOK, updatedTask)
 }
 
-func validateTaskPayload(task *model.Task) error {
-	if task.Name == "" {
-		return errNameRequired
+// handlePatchTask applies a JSON merge patch to the task, changing only the
+// fields the patch sets, and returns the task as stored.
+func (s *TaskService) handlePatchTask(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	orgID := middleware.GetOrgIDFromContext(r.Context())
+
+	current, err := s.store.GetTask(r.Context(), orgID, id)
+	if err != nil {
+		writeStoreError(w, r, err, "handlePatchTask: error loading task")
+		return
+	}
+	if !utils.CheckIfMatch(w, r, current.Version) {
+		return
+	}
+
+	var patch model.TaskPatch
+	if !utils.ReadMergePatch(w, r, &patch) {
+		return
+	}
+
+	if patch.ProjectID != nil || patch.AssignedToID != nil {
+		task := *current
+		if patch.ProjectID != nil {
+			task.ProjectID = *patch.ProjectID
+		}
+		if patch.AssignedToID != nil {
+			task.AssignedToID = *patch.AssignedToID
+		}
+		if !s.checkTaskChange(w, r, orgID, current, &task) {
+			return
+		}
+	}
+
+	task, err := s.store.PatchTask(r.Context(), orgID, id, current.Version, &patch)
+	if err != nil {
+		writeStoreError(w, r, err, "handlePatchTask: error updating task")
+		return
+	}
+
+	utils.SetETag(w, task.Version)
+	utils.WriteJSON(w, http.StatusOK, task)
+}
+
+// checkTaskChange checks that task, the changed current task, refers to a
+// project and an assignee of the organization, and that the user may write
+// to the project it moves to. When it may not be saved, the error has been
+// written and checkTaskChange returns false.
+func (s *TaskService) checkTaskChange(w http.ResponseWriter, r *http.Request, orgID int64, current, task *model.Task) bool {
+	if err := s.validateTaskReferences(r.Context(), orgID, task); err != nil {
+		writeTaskReferenceError(w, r, err)
+		return false
+	}
+
+	// moving the task takes write access to the project it moves to as well
+	if task.ProjectID != current.ProjectID {
+		if status, err := middleware.RequireProjectRole(r, s.store, strconv.FormatInt(task.ProjectID, 10), model.ProjectRoleEditor); err != nil {
+			utils.WriteError(w, status, err.Error())
+			return false
+		}
 	}
+	return true
+}
 
-	if task.ProjectID == 0 {
-		return errProjectIDRequired
+// validateTaskReferences checks that the task's project and assignee both
+// belong to the organization.
+func (s *TaskService) validateTaskReferences(ctx context.Context, orgID int64, task *model.Task) error {
+	if _, err := s.store.GetProject(ctx, orgID, strconv.FormatInt(task.ProjectID, 10)); err != nil {
+		if err == sql.ErrNoRows {
+			return errProjectNotFound
+		}
+		return err
 	}
 
-	if task.AssignedToID == 0 {
-		return errUserIDRequired
+	if _, err := s.store.GetOrgMember(ctx, orgID, task.AssignedToID); err != nil {
+		if err == sql.ErrNoRows {
+			return errAssigneeNotMember
+		}
+		return err
 	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+func writeTaskReferenceError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errProjectNotFound) || errors.Is(err, errAssigneeNotMember) {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("Error validating task", "error", err)
+	utils.WriteError(w, http.StatusInternalServerError, "internal server error")
+}
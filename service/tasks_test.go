@@ -2,13 +2,18 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
 	"github.com/gorilla/mux"
 )
 
@@ -58,6 +63,7 @@ func TestCreateTask(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		req = req.WithContext(middleware.WithOrgRole(req.Context(), model.OrgRoleMember))
 
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
@@ -104,6 +110,7 @@ func TestDeleteTask(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		req.Header.Set("If-Match", utils.ETag(1))
 
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
@@ -112,8 +119,8 @@ func TestDeleteTask(t *testing.T) {
 
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusOK {
-			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
 		}
 	})
 }
@@ -139,6 +146,8 @@ func TestUpdateTask(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		req.Header.Set("If-Match", utils.ETag(1))
+		req = req.WithContext(middleware.WithOrgRole(req.Context(), model.OrgRoleMember))
 
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
@@ -151,4 +160,172 @@ func TestUpdateTask(t *testing.T) {
 			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
 		}
 	})
-}
\ No newline at end of file
+}
+type patchTaskStore struct {
+	repository.MockStore
+	patch *model.TaskPatch
+}
+
+func (s *patchTaskStore) GetTask(ctx context.Context, orgID int64, id string) (*model.Task, error) {
+	return &model.Task{ID: 42, Name: "Write docs", Status: model.TaskStatusTodo, ProjectID: 1, AssignedToID: 7, Version: 1}, nil
+}
+
+func (s *patchTaskStore) PatchTask(ctx context.Context, orgID int64, id string, version int64, patch *model.TaskPatch) (*model.Task, error) {
+	s.patch = patch
+	return &model.Task{ID: 42, Name: "Write docs", Status: *patch.Status, ProjectID: 1, AssignedToID: 7, Version: version + 1}, nil
+}
+
+func patchRequest(handler http.HandlerFunc, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	// the stores of these tests hold version 1
+	req.Header.Set("If-Match", utils.ETag(1))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc(strings.Replace(path, "42", "{id}", 1), handler).Methods("PATCH")
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPatchTask(t *testing.T) {
+	store := &patchTaskStore{}
+	service := NewTaskService(store)
+
+	t.Run("should only change the fields in the patch", func(t *testing.T) {
+		rr := patchRequest(service.handlePatchTask, "/tasks/42", utils.MergePatchContentType, `{"status":"DONE"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		if store.patch.Name != nil || store.patch.ProjectID != nil || store.patch.AssignedToID != nil {
+			t.Errorf("expected only the status to be patched, got %+v", store.patch)
+		}
+
+		var task model.Task
+		if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+			t.Fatal(err)
+		}
+		if task.Name != "Write docs" || task.Status != model.TaskStatusDone {
+			t.Errorf("expected the stored task, got %+v", task)
+		}
+	})
+
+	t.Run("should not remove required fields", func(t *testing.T) {
+		rr := patchRequest(service.handlePatchTask, "/tasks/42", utils.MergePatchContentType, `{"name":null,"status":"BLOCKED"}`)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		problem := decodeProblem(t, rr)
+		if len(problem.Errors) != 2 || problem.Errors[0].Field != "name" || problem.Errors[1].Field != "status" {
+			t.Errorf("expected errors for name and status, got %+v", problem.Errors)
+		}
+	})
+
+	t.Run("should reject patches that are not objects", func(t *testing.T) {
+		rr := patchRequest(service.handlePatchTask, "/tasks/42", utils.MergePatchContentType, `["status","DONE"]`)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if problem := decodeProblem(t, rr); problem.Code != model.ProblemInvalidJSON {
+			t.Errorf("expected code %s, got %s", model.ProblemInvalidJSON, problem.Code)
+		}
+	})
+
+	t.Run("should reject other patch formats", func(t *testing.T) {
+		rr := patchRequest(service.handlePatchTask, "/tasks/42", "application/json-patch+json", `[{"op":"replace","path":"/status","value":"DONE"}]`)
+		if rr.Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("expected status code %d, got %d", http.StatusUnsupportedMediaType, rr.Code)
+		}
+		if accept := rr.Header().Get("Accept-Patch"); accept != utils.MergePatchContentType {
+			t.Errorf("expected Accept-Patch %s, got %q", utils.MergePatchContentType, accept)
+		}
+	})
+}
+
+type staleTaskStore struct {
+	patchTaskStore
+}
+
+func (s *staleTaskStore) PatchTask(ctx context.Context, orgID int64, id string, version int64, patch *model.TaskPatch) (*model.Task, error) {
+	return nil, repository.ErrVersionConflict
+}
+
+func conditionalRequest(handler http.HandlerFunc, method, header, etag, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/tasks/42", strings.NewReader(body))
+	req.Header.Set("Content-Type", utils.MergePatchContentType)
+	if etag != "" {
+		req.Header.Set(header, etag)
+	}
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/tasks/{id}", handler).Methods(method)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTaskPreconditions(t *testing.T) {
+	service := NewTaskService(&patchTaskStore{})
+
+	t.Run("should send the ETag of the task", func(t *testing.T) {
+		rr := conditionalRequest(service.handleGetTask, http.MethodGet, "If-None-Match", "", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if etag := rr.Header().Get("ETag"); etag != `"1"` {
+			t.Errorf(`expected ETag "1", got %s`, etag)
+		}
+	})
+
+	t.Run("should not resend a current copy", func(t *testing.T) {
+		rr := conditionalRequest(service.handleGetTask, http.MethodGet, "If-None-Match", `"0", W/"1"`, "")
+		if rr.Code != http.StatusNotModified {
+			t.Fatalf("expected status code %d, got %d", http.StatusNotModified, rr.Code)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("expected an empty body, got %s", rr.Body)
+		}
+	})
+
+	t.Run("should refuse changes to another version", func(t *testing.T) {
+		rr := conditionalRequest(service.handlePatchTask, http.MethodPatch, "If-Match", `"2"`, `{"status":"DONE"}`)
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected status code %d, got %d", http.StatusPreconditionFailed, rr.Code)
+		}
+	})
+
+	t.Run("should require If-Match when configured", func(t *testing.T) {
+		defer func(required bool) { config.Envs.IfMatchRequired = required }(config.Envs.IfMatchRequired)
+		config.Envs.IfMatchRequired = true
+
+		rr := conditionalRequest(service.handlePatchTask, http.MethodPatch, "If-Match", "", `{"status":"DONE"}`)
+		if rr.Code != http.StatusPreconditionRequired {
+			t.Fatalf("expected status code %d, got %d", http.StatusPreconditionRequired, rr.Code)
+		}
+		if problem := decodeProblem(t, rr); problem.Code != model.ProblemPreconditionRequired {
+			t.Errorf("expected code %s, got %s", model.ProblemPreconditionRequired, problem.Code)
+		}
+	})
+
+	t.Run("should accept changes without If-Match when it is optional", func(t *testing.T) {
+		defer func(required bool) { config.Envs.IfMatchRequired = required }(config.Envs.IfMatchRequired)
+		config.Envs.IfMatchRequired = false
+
+		rr := conditionalRequest(service.handlePatchTask, http.MethodPatch, "If-Match", "", `{"status":"DONE"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if etag := rr.Header().Get("ETag"); etag != `"2"` {
+			t.Errorf(`expected ETag "2", got %s`, etag)
+		}
+	})
+
+	t.Run("should refuse changes that lose a race", func(t *testing.T) {
+		service := NewTaskService(&staleTaskStore{})
+		rr := conditionalRequest(service.handlePatchTask, http.MethodPatch, "If-Match", `"1"`, `{"status":"DONE"}`)
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected status code %d, got %d", http.StatusPreconditionFailed, rr.Code)
+		}
+	})
+}
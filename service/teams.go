@@ -0,0 +1,174 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+	"github.com/gorilla/mux"
+)
+
+var errTeamNotFound = errors.New("team not found")
+
+type TeamService struct {
+	store repository.Store
+}
+
+func NewTeamService(s repository.Store) *TeamService {
+	return &TeamService{store: s}
+}
+
+// RegisterRoutes registers the team routes. Like the organization routes,
+// they must be registered before the /orgs/{org} project and task routes.
+func (s *TeamService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/orgs/{org}/teams", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleViewer, s.handleListTeams, s.store), s.store)).Methods("GET")
+	r.HandleFunc("/orgs/{org}/teams", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleCreateTeam, s.store), s.store)).Methods("POST")
+	r.HandleFunc("/orgs/{org}/teams/{teamID}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleViewer, s.handleGetTeam, s.store), s.store)).Methods("GET")
+	r.HandleFunc("/orgs/{org}/teams/{teamID}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleDeleteTeam, s.store), s.store)).Methods("DELETE")
+	r.HandleFunc("/orgs/{org}/teams/{teamID}/members", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleAddTeamMember, s.store), s.store)).Methods("POST")
+	r.HandleFunc("/orgs/{org}/teams/{teamID}/members/{userID}", middleware.AuthHandler(middleware.OrgHandler(model.OrgRoleAdmin, s.handleRemoveTeamMember, s.store), s.store)).Methods("DELETE")
+}
+
+func (s *TeamService) handleListTeams(w http.ResponseWriter, r *http.Request) {
+	teams, err := s.store.ListTeams(r.Context(), middleware.GetOrgIDFromContext(r.Context()))
+	if err != nil {
+		writeStoreError(w, r, err, "handleListTeams: error listing teams")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, teams)
+}
+
+func (s *TeamService) handleCreateTeam(w http.ResponseWriter, r *http.Request) {
+	var payload model.CreateTeamPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	team, err := s.store.CreateTeam(r.Context(), middleware.GetOrgIDFromContext(r.Context()), &model.Team{Name: payload.Name})
+	if err != nil {
+		if err == repository.ErrTeamNameTaken {
+			utils.WriteError(w, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error creating team")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, team)
+}
+
+func (s *TeamService) handleGetTeam(w http.ResponseWriter, r *http.Request) {
+	team, status, err := s.currentTeam(r)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	team.Members, err = s.store.ListTeamMembers(r.Context(), team.OrgID, team.ID)
+	if err != nil {
+		writeStoreError(w, r, err, "handleGetTeam: error loading team")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, team)
+}
+
+// handleDeleteTeam deletes the team. Its members lose the access the team
+// was granted.
+func (s *TeamService) handleDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	team, status, err := s.currentTeam(r)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	if err := s.store.DeleteTeam(r.Context(), team.OrgID, team.ID); err != nil {
+		writeStoreError(w, r, err, "handleDeleteTeam: error deleting team")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *TeamService) handleAddTeamMember(w http.ResponseWriter, r *http.Request) {
+	var payload model.AddTeamMemberPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	team, status, err := s.currentTeam(r)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	// only members of the organization can join its teams
+	member, err := s.store.GetOrgMember(r.Context(), team.OrgID, payload.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, "user is not a member of the organization")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error adding team member")
+		return
+	}
+
+	if err := s.store.AddTeamMember(r.Context(), team.OrgID, team.ID, member.UserID); err != nil {
+		writeStoreError(w, r, err, "handleAddTeamMember: error adding team member")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, member)
+}
+
+func (s *TeamService) handleRemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	team, status, err := s.currentTeam(r)
+	if err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := s.store.RemoveTeamMember(r.Context(), team.OrgID, team.ID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, errMemberNotFound.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error removing team member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentTeam loads the team named by the {teamID} route variable from the
+// current organization.
+func (s *TeamService) currentTeam(r *http.Request) (*model.Team, int, error) {
+	teamID, err := strconv.ParseInt(mux.Vars(r)["teamID"], 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("invalid team id")
+	}
+
+	team, err := s.store.GetTeam(r.Context(), middleware.GetOrgIDFromContext(r.Context()), teamID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, http.StatusNotFound, errTeamNotFound
+		}
+		return nil, http.StatusInternalServerError, errors.New("error loading team")
+	}
+
+	return team, 0, nil
+}
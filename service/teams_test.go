@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+type teamMemberKey struct {
+	teamID, userID int64
+}
+
+type projectGrantKey struct {
+	projectID, granteeID int64
+}
+
+func (s *orgStore) CreateTeam(ctx context.Context, orgID int64, t *model.Team) (*model.Team, error) {
+	t.ID = int64(len(s.teams) + 1)
+	t.OrgID = orgID
+	s.teams[t.ID] = t
+	return t, nil
+}
+
+func (s *orgStore) GetTeam(ctx context.Context, orgID, id int64) (*model.Team, error) {
+	t, ok := s.teams[id]
+	if !ok || t.OrgID != orgID {
+		return nil, sql.ErrNoRows
+	}
+	clone := *t
+	return &clone, nil
+}
+
+func (s *orgStore) AddTeamMember(ctx context.Context, orgID, teamID, userID int64) error {
+	s.teamMembers[teamMemberKey{teamID, userID}] = true
+	return nil
+}
+
+func (s *orgStore) SetProjectUserGrant(ctx context.Context, orgID, projectID, userID int64, role string) error {
+	s.userGrants[projectGrantKey{projectID, userID}] = role
+	return nil
+}
+
+func (s *orgStore) SetProjectTeamGrant(ctx context.Context, orgID, projectID, teamID int64, role string) error {
+	s.teamGrants[projectGrantKey{projectID, teamID}] = role
+	return nil
+}
+
+func (s *orgStore) ListUserProjectGrants(ctx context.Context, orgID, projectID, userID int64) ([]model.ProjectGrant, error) {
+	grants := []model.ProjectGrant{}
+	if role, ok := s.userGrants[projectGrantKey{projectID, userID}]; ok {
+		grants = append(grants, model.ProjectGrant{ProjectID: projectID, UserID: &userID, Role: role})
+	}
+	for key, role := range s.teamGrants {
+		if key.projectID == projectID && s.teamMembers[teamMemberKey{key.granteeID, userID}] {
+			teamID := key.granteeID
+			grants = append(grants, model.ProjectGrant{ProjectID: projectID, TeamID: &teamID, TeamName: s.teams[teamID].Name, Role: role})
+		}
+	}
+	return grants, nil
+}
+
+func TestTeamProjectAccess(t *testing.T) {
+	store := newOrgStore()
+	store.users[8].Role = model.RoleUser
+	router := newOrgRouter(store, &mailer.MockMailer{})
+	admin := login(t, store, 1, "")
+	guest := login(t, store, 8, "")
+
+	t.Run("should keep viewers read-only without a grant", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPut, "/orgs/globex/projects/10", guest, "", &model.Project{Name: "Renamed"})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should not let viewers manage teams or grants", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/teams", guest, "", &model.CreateTeamPayload{Name: "Contractors"})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodPut, "/orgs/globex/projects/10/grants/users/8", guest, "", &model.SetProjectGrantPayload{Role: model.ProjectRoleEditor})
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	var team model.Team
+
+	t.Run("should create a team and add members", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPost, "/orgs/globex/teams", admin, "", &model.CreateTeamPayload{Name: "Contractors"})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&team); err != nil {
+			t.Fatal(err)
+		}
+
+		rr = orgRequest(t, router, http.MethodPost, "/orgs/globex/teams/1/members", admin, "", &model.AddTeamMemberPayload{UserID: 8})
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = orgRequest(t, router, http.MethodPost, "/orgs/globex/teams/1/members", admin, "", &model.AddTeamMemberPayload{UserID: 7})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected outsiders to be rejected, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should grant the team's role to its members", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPut, "/orgs/globex/projects/10/grants/teams/1", admin, "", &model.SetProjectGrantPayload{Role: model.ProjectRoleEditor})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = orgRequest(t, ifMatchAny(router), http.MethodPut, "/orgs/globex/projects/10", guest, "", &model.Project{Name: "Renamed"})
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should explain a user's effective access", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodGet, "/orgs/globex/projects/10/access/me", guest, "", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var access model.ProjectAccess
+		if err := json.NewDecoder(rr.Body).Decode(&access); err != nil {
+			t.Fatal(err)
+		}
+
+		if access.Role != model.ProjectRoleEditor || len(access.Sources) != 2 {
+			t.Fatalf("unexpected access %+v", access)
+		}
+
+		if access.Sources[0].Type != model.AccessSourceOrganization || access.Sources[0].Role != model.ProjectRoleViewer {
+			t.Errorf("expected viewer access through the organization, got %+v", access.Sources[0])
+		}
+
+		if access.Sources[1].Type != model.AccessSourceTeam || access.Sources[1].TeamName != "Contractors" {
+			t.Errorf("expected editor access through the team, got %+v", access.Sources[1])
+		}
+	})
+
+	t.Run("should not grant teams of other organizations", func(t *testing.T) {
+		store.teams[2] = &model.Team{ID: 2, OrgID: 1, Name: "Acme team"}
+
+		rr := orgRequest(t, router, http.MethodPut, "/orgs/globex/projects/10/grants/teams/2", admin, "", &model.SetProjectGrantPayload{Role: model.ProjectRoleAdmin})
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should reject unknown project roles", func(t *testing.T) {
+		rr := orgRequest(t, router, http.MethodPut, "/orgs/globex/projects/10/grants/users/8", admin, "", &model.SetProjectGrantPayload{Role: "owner"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
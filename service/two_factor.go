@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/DaffaJatmiko/go-rest-project-manager/utils"
+)
+
+const recoveryCodeCount = 10
+
+var errInvalidCode = errors.New("invalid two-factor code")
+var errTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+var errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+var errTwoFactorNotStarted = errors.New("two-factor enrollment has not been started")
+var errInvalidChallenge = errors.New("invalid or expired challenge token")
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (s *UserService) handleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	current, err := s.store.GetUserTOTP(r.Context(), userID)
+	if err != nil && err != sql.ErrNoRows {
+		utils.WriteError(w, http.StatusInternalServerError, "error starting enrollment")
+		return
+	}
+	if err == nil && current.Enabled {
+		utils.WriteError(w, http.StatusConflict, errTwoFactorEnabled.Error())
+		return
+	}
+
+	user, err := s.store.GetUserByID(r.Context(), strconv.FormatInt(userID, 10))
+	if err != nil {
+		writeStoreError(w, r, err, "handleTOTPEnroll: error starting enrollment")
+		return
+	}
+
+	secret, err := middleware.GenerateTOTPSecret()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error starting enrollment")
+		return
+	}
+
+	if err := s.store.SaveUserTOTP(r.Context(), &model.UserTOTP{UserID: userID, Secret: secret}); err != nil {
+		writeStoreError(w, r, err, "handleTOTPEnroll: error starting enrollment")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, model.TOTPEnrollment{
+		Secret: secret,
+		URI:    middleware.TOTPURI(config.Envs.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// handleTOTPConfirm enables two-factor authentication once the user proves
+// their authenticator app produces valid codes, and returns the recovery
+// codes. This is the only time the recovery codes are shown.
+func (s *UserService) handleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var payload model.TOTPCodePayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	current, err := s.store.GetUserTOTP(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, errTwoFactorNotStarted.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error confirming enrollment")
+		return
+	}
+
+	if current.Enabled {
+		utils.WriteError(w, http.StatusConflict, errTwoFactorEnabled.Error())
+		return
+	}
+
+	ok, err := s.checkTOTPCode(r.Context(), current, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error confirming enrollment")
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errInvalidCode.Error())
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error confirming enrollment")
+		return
+	}
+
+	if err := s.store.EnableUserTOTP(r.Context(), userID, hashes); err != nil {
+		writeStoreError(w, r, err, "handleTOTPConfirm: error confirming enrollment")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, model.RecoveryCodes{RecoveryCodes: codes})
+}
+
+func (s *UserService) handleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var payload model.TOTPCodePayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	current, err := s.store.GetUserTOTP(r.Context(), userID)
+	if err != nil && err != sql.ErrNoRows {
+		utils.WriteError(w, http.StatusInternalServerError, "error disabling two-factor authentication")
+		return
+	}
+	if err == sql.ErrNoRows || !current.Enabled {
+		utils.WriteError(w, http.StatusBadRequest, errTwoFactorNotEnabled.Error())
+		return
+	}
+
+	ok, err := s.verifySecondFactor(r.Context(), current, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error disabling two-factor authentication")
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errInvalidCode.Error())
+		return
+	}
+
+	if err := s.store.DeleteUserTOTP(r.Context(), userID); err != nil {
+		writeStoreError(w, r, err, "handleTOTPDisable: error disabling two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTwoFactorLogin is the second login step: it exchanges the challenge
+// token from handleUserLogin and a TOTP or recovery code for a session token.
+func (s *UserService) handleTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var payload model.TwoFactorLoginPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	userID, err := middleware.ValidateChallengeJWT(payload.ChallengeToken)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, errInvalidChallenge.Error())
+		return
+	}
+
+	current, err := s.store.GetUserTOTP(r.Context(), userID)
+	if err != nil || !current.Enabled {
+		utils.WriteError(w, http.StatusUnauthorized, errInvalidChallenge.Error())
+		return
+	}
+
+	user, err := s.store.GetUserByID(r.Context(), strconv.FormatInt(userID, 10))
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, errInvalidChallenge.Error())
+		return
+	}
+
+	// codes are guessable too, so they share the password lockout
+	ip := middleware.ClientIP(r)
+	retryAfter, err := s.loginRetryAfter(r.Context(), user.Email, ip)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error verifying code")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyAttempts(w, retryAfter)
+		return
+	}
+
+	ok, err := s.verifySecondFactor(r.Context(), current, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error verifying code")
+		return
+	}
+	if !ok {
+		s.recordLoginFailure(r.Context(), user.Email, ip)
+		utils.WriteError(w, http.StatusUnauthorized, errInvalidCode.Error())
+		return
+	}
+
+	s.clearAccountThrottle(r.Context(), user.Email)
+
+	token, err := createAndSetAuthCookie(s.store, w, r, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, token)
+}
+
+// completeLogin answers a login whose first factor, a password or an
+// identity provider, has been checked. Users with two-factor authentication
+// get a challenge to answer at /users/login/2fa, everyone else a session.
+func completeLogin(store repository.Store, w http.ResponseWriter, r *http.Request, userID int64) {
+	twoFactor, err := twoFactorEnabled(r.Context(), store, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+
+	if twoFactor {
+		challenge, err := middleware.CreateChallengeJWT(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, model.TwoFactorChallenge{TwoFactorRequired: true, ChallengeToken: challenge})
+		return
+	}
+
+	token, err := createAndSetAuthCookie(store, w, r, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, token)
+}
+
+// twoFactorEnabled reports whether the user has confirmed TOTP enrollment.
+func twoFactorEnabled(ctx context.Context, store repository.Store, userID int64) (bool, error) {
+	current, err := store.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return current.Enabled, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (s *UserService) verifySecondFactor(ctx context.Context, t *model.UserTOTP, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if isNumeric(code) {
+		return s.checkTOTPCode(ctx, t, code)
+	}
+
+	err := s.store.ConsumeRecoveryCode(ctx, t.UserID, middleware.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logging.FromContext(ctx).Info("verifySecondFactor: invalid recovery code", "user_id", t.UserID)
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// checkTOTPCode validates a TOTP code and burns its time step so the same
+// code cannot be used twice.
+func (s *UserService) checkTOTPCode(ctx context.Context, t *model.UserTOTP, code string) (bool, error) {
+	step, ok := middleware.ValidateTOTP(t.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	if err := s.store.UseTOTPStep(ctx, t.UserID, step); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// generateRecoveryCodes returns codes formatted for display along with the
+// hashes that are stored in their place.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		hashes = append(hashes, middleware.HashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/keyring"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
+	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+)
+
+// totpStore keeps a single user's two-factor state in memory.
+type totpStore struct {
+	repository.MockStore
+	user          *model.User
+	totp          *model.UserTOTP
+	recoveryCodes map[string]bool
+}
+
+func (s *totpStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	return s.user, nil
+}
+
+func (s *totpStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return s.user, nil
+}
+
+func (s *totpStore) GetUserTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error) {
+	if s.totp == nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.totp, nil
+}
+
+func (s *totpStore) SaveUserTOTP(ctx context.Context, t *model.UserTOTP) error {
+	s.totp = t
+	return nil
+}
+
+func (s *totpStore) EnableUserTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	s.totp.Enabled = true
+	s.recoveryCodes = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		s.recoveryCodes[hash] = true
+	}
+	return nil
+}
+
+func (s *totpStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	if step <= s.totp.LastUsedStep {
+		return sql.ErrNoRows
+	}
+	s.totp.LastUsedStep = step
+	return nil
+}
+
+func (s *totpStore) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	if !s.recoveryCodes[codeHash] {
+		return sql.ErrNoRows
+	}
+	delete(s.recoveryCodes, codeHash)
+	return nil
+}
+
+func authedRequest(t *testing.T, method, path string, userID int64, payload any) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, path, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return req.WithContext(middleware.WithUserID(req.Context(), userID))
+}
+
+func serve(handler http.HandlerFunc, path string, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc(path, handler)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	store := &totpStore{user: &model.User{ID: 7, Email: "joe@mail.com"}}
+	service := NewUserService(store, &mailer.MockMailer{})
+
+	t.Run("should return a secret and otpauth URI", func(t *testing.T) {
+		rr := serve(service.handleTOTPEnroll, "/users/2fa/enroll", authedRequest(t, http.MethodPost, "/users/2fa/enroll", 7, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var enrollment model.TOTPEnrollment
+		if err := json.NewDecoder(rr.Body).Decode(&enrollment); err != nil {
+			t.Fatal(err)
+		}
+
+		if enrollment.Secret == "" || !strings.HasPrefix(enrollment.URI, "otpauth://totp/") {
+			t.Errorf("unexpected enrollment %+v", enrollment)
+		}
+
+		if store.totp == nil || store.totp.Enabled {
+			t.Error("expected a pending enrollment to be saved")
+		}
+	})
+
+	t.Run("should reject an invalid confirmation code", func(t *testing.T) {
+		rr := serve(service.handleTOTPConfirm, "/users/2fa/confirm", authedRequest(t, http.MethodPost, "/users/2fa/confirm", 7, &model.TOTPCodePayload{Code: "000000"}))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should enable 2FA and return recovery codes", func(t *testing.T) {
+		code, err := middleware.TOTPCode(store.totp.Secret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := serve(service.handleTOTPConfirm, "/users/2fa/confirm", authedRequest(t, http.MethodPost, "/users/2fa/confirm", 7, &model.TOTPCodePayload{Code: code}))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var codes model.RecoveryCodes
+		if err := json.NewDecoder(rr.Body).Decode(&codes); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(codes.RecoveryCodes) != recoveryCodeCount {
+			t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes.RecoveryCodes))
+		}
+
+		if !store.totp.Enabled {
+			t.Error("expected 2FA to be enabled")
+		}
+	})
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	hash, err := middleware.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := middleware.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &totpStore{
+		user:          &model.User{ID: 7, Email: "joe@mail.com", Password: hash},
+		totp:          &model.UserTOTP{UserID: 7, Secret: secret, Enabled: true},
+		recoveryCodes: map[string]bool{middleware.HashToken("abcdefgh"): true},
+	}
+	service := NewUserService(store, &mailer.MockMailer{})
+
+	var challenge model.TwoFactorChallenge
+
+	t.Run("should return a challenge instead of a token", func(t *testing.T) {
+		rr := postJSON(t, service.handleUserLogin, "/users/login", &model.LoginRequest{Email: "joe@mail.com", Password: "password"})
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if err := json.NewDecoder(rr.Body).Decode(&challenge); err != nil {
+			t.Fatal(err)
+		}
+
+		if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+			t.Fatalf("expected a 2FA challenge, got %+v", challenge)
+		}
+	})
+
+	t.Run("should not accept the challenge token as a session", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/projects/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", challenge.ChallengeToken)
+
+		rr := httptest.NewRecorder()
+		middleware.AuthHandler(func(w http.ResponseWriter, r *http.Request) {}, store)(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should exchange a valid code for a token", func(t *testing.T) {
+		code, err := middleware.TOTPCode(secret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload := &model.TwoFactorLoginPayload{ChallengeToken: challenge.ChallengeToken, Code: code}
+		rr := postJSON(t, service.handleTwoFactorLogin, "/users/login/2fa", payload)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = postJSON(t, service.handleTwoFactorLogin, "/users/login/2fa", payload)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected replayed code to be rejected, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should accept a recovery code only once", func(t *testing.T) {
+		payload := &model.TwoFactorLoginPayload{ChallengeToken: challenge.ChallengeToken, Code: "ABCD-EFGH"}
+
+		rr := postJSON(t, service.handleTwoFactorLogin, "/users/login/2fa", payload)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = postJSON(t, service.handleTwoFactorLogin, "/users/login/2fa", payload)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected used recovery code to be rejected, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should reject a forged challenge", func(t *testing.T) {
+		forged, err := keyring.NewHMAC([]byte("not-" + config.Envs.JWTSecret)).Sign(jwt.MapClaims{
+			"challengeUserID": "7",
+			"exp":             time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := postJSON(t, service.handleTwoFactorLogin, "/users/login/2fa", &model.TwoFactorLoginPayload{ChallengeToken: forged, Code: "123456"})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
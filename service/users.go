@@ -1,13 +1,17 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
 	"errors"
-	"io"
-	"log"
+	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/logging"
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
 	"github.com/DaffaJatmiko/go-rest-project-manager/middleware"
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
@@ -15,142 +19,307 @@ import (
 	"github.com/gorilla/mux"
 )
 
-var errEmailRequired = errors.New("email is required")
-var errFirstNameRequired = errors.New("first name is required")
-var errLastNameRequired = errors.New("last name is required")
-var errPasswordRequired = errors.New("password is required")
+var errPasswordRequired = model.FieldError{Field: "password", Code: model.FieldRequired, Message: "password is required"}
+var errTokenRequired = model.FieldError{Field: "token", Code: model.FieldRequired, Message: "token is required"}
+var errInvalidToken = errors.New("invalid or expired token")
+var errEmailNotVerified = errors.New("email address has not been verified")
+var errAccountDeactivated = errors.New("account has been deactivated")
+var errPasswordResetRequired = errors.New("password must be reset, check your email for a reset link")
 
 type UserService struct {
-	store repository.Store
+	store  repository.Store
+	mailer mailer.Mailer
 }
 
-func NewUserService(s repository.Store) *UserService {
-	return &UserService{store: s}
+func NewUserService(s repository.Store, m mailer.Mailer) *UserService {
+	return &UserService{store: s, mailer: m}
 }
 
 func (s *UserService) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/users/register", s.handleUserRegister).Methods("POST")
 	r.HandleFunc("/users/login", s.handleUserLogin).Methods("POST")
+	r.HandleFunc("/users/password/forgot", s.handleForgotPassword).Methods("POST")
+	r.HandleFunc("/users/password/reset", s.handleResetPassword).Methods("POST")
+	r.HandleFunc("/users/verify", s.handleVerifyEmail).Methods("POST")
+	r.HandleFunc("/users/login/2fa", s.handleTwoFactorLogin).Methods("POST")
+	r.HandleFunc("/users/2fa/enroll", middleware.OwnerHandler(s.handleTOTPEnroll, s.store)).Methods("POST")
+	r.HandleFunc("/users/2fa/confirm", middleware.OwnerHandler(s.handleTOTPConfirm, s.store)).Methods("POST")
+	r.HandleFunc("/users/2fa/disable", middleware.OwnerHandler(s.handleTOTPDisable, s.store)).Methods("POST")
+	r.HandleFunc("/users/email/confirm", s.handleConfirmEmailChange).Methods("POST")
+	r.HandleFunc("/users/me", middleware.AuthHandler(s.handleGetProfile, s.store)).Methods("GET")
+	r.HandleFunc("/users/me", middleware.AuthHandler(s.handleUpdateProfile, s.store)).Methods("PATCH")
+	r.HandleFunc("/users/me", middleware.OwnerHandler(s.handleDeleteAccount, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/me/password", middleware.OwnerHandler(s.handleChangePassword, s.store)).Methods("POST")
+	r.HandleFunc("/users/me/email", middleware.OwnerHandler(s.handleChangeEmail, s.store)).Methods("POST")
+	r.HandleFunc("/users/me/avatar", middleware.AuthHandler(s.handleUploadAvatar, s.store)).Methods("PUT")
+	r.HandleFunc("/users/me/avatar", middleware.AuthHandler(s.handleDeleteAvatar, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/{id}/avatar", middleware.AuthHandler(s.handleGetAvatar, s.store)).Methods("GET")
 }
 
 func (s *UserService) handleUserRegister(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	var payload model.RegisterPayload
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
+
+	hashedPW, err := middleware.HashPassword(payload.Password)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	defer r.Body.Close()
+	logging.FromContext(r.Context()).Debug("handleUserRegister: registering user", "email", logging.PII(payload.Email))
 
-	var payload *model.User
-	err = json.Unmarshal(body, &payload)
+	user, err := s.store.CreateUser(r.Context(), &model.User{
+		Email:     payload.Email,
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Password:  hashedPW,
+		Role:      model.RoleUser,
+	})
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request payload"})
+		writeStoreError(w, r, err, "handleUserRegister: error creating user")
 		return
 	}
 
-	if err := validateUserPayload(payload); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
-		return
+	if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+		logging.FromContext(r.Context()).Error("handleUserRegister: error sending verification email", "user_id", user.ID, "error", err)
 	}
 
-	hashedPW, err := middleware.HashPassword(payload.Password)
+	if _, err := createPersonalOrganization(r.Context(), s.store, user); err != nil {
+		logging.FromContext(r.Context()).Error("handleUserRegister: error creating organization", "user_id", user.ID, "error", err)
+	}
+
+	token, err := createAndSetAuthCookie(s.store, w, r, user.ID)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
+		utils.WriteError(w, http.StatusInternalServerError, "error creating token session")
 		return
 	}
-	payload.Password = hashedPW
+	utils.WriteJSON(w, http.StatusCreated, token)
+}
 
-	log.Printf("Registering user: %s, Hashed Password: %s", payload.Email, hashedPW)
+func (s *UserService) handleUserLogin(w http.ResponseWriter, r *http.Request) {
+	var payload model.LoginRequest
+	if !utils.ReadJSON(w, r, &payload) {
+		return
+	}
 
-	user, err := s.store.CreateUser(payload)
+	ip := middleware.ClientIP(r)
+	retryAfter, err := s.loginRetryAfter(r.Context(), payload.Email, ip)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "error creating user"})
+		utils.WriteError(w, http.StatusInternalServerError, "error logging in")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyAttempts(w, retryAfter)
 		return
 	}
 
-	token, err := createAndSetAuthCookie(user.ID, w)
+	user, err := s.store.GetUserByEmail(r.Context(), payload.Email)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "error creating token session"})
+		if err != sql.ErrNoRows {
+			utils.WriteError(w, http.StatusInternalServerError, "error logging in")
+			return
+		}
+		// burn the same bcrypt time as a real comparison before failing
+		middleware.CheckPasswordHash(payload.Password, dummyPasswordHash())
+		s.recordLoginFailure(r.Context(), payload.Email, ip)
+		utils.WriteError(w, http.StatusUnauthorized, errInvalidCredentials.Error())
 		return
 	}
-	utils.WriteJSON(w, http.StatusCreated, token)
+
+	if !middleware.CheckPasswordHash(payload.Password, user.Password) {
+		logging.FromContext(r.Context()).Info("handleUserLogin: password mismatch", "user_id", user.ID)
+		s.recordLoginFailure(r.Context(), payload.Email, ip)
+		utils.WriteError(w, http.StatusUnauthorized, errInvalidCredentials.Error())
+		return
+	}
+
+	s.clearAccountThrottle(r.Context(), payload.Email)
+
+	if err := checkAccountUsable(user); err != nil {
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if user.PasswordResetRequired {
+		utils.WriteError(w, http.StatusForbidden, errPasswordResetRequired.Error())
+		return
+	}
+
+	if config.Envs.RequireEmailVerification && !user.Verified {
+		utils.WriteError(w, http.StatusForbidden, errEmailNotVerified.Error())
+		return
+	}
+
+	completeLogin(s.store, w, r, user.ID)
 }
 
-func (s *UserService) handleUserLogin(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+// handleForgotPassword always answers 202 so the endpoint cannot be used to
+// find out which email addresses have an account.
+func (s *UserService) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload model.ForgotPasswordPayload
+	if !utils.ReadJSON(w, r, &payload) {
 		return
 	}
 
-	defer r.Body.Close()
+	user, err := s.store.GetUserByEmail(r.Context(), payload.Email)
+	if err == nil {
+		if err := s.sendPasswordResetEmail(r.Context(), user); err != nil {
+			logging.FromContext(r.Context()).Error("handleForgotPassword: error sending reset email", "user_id", user.ID, "error", err)
+		}
+	} else if err != sql.ErrNoRows {
+		logging.FromContext(r.Context()).Error("handleForgotPassword: error looking up user", "error", err)
+	}
 
-	var payload *model.LoginRequest
-	err = json.Unmarshal(body, &payload)
-	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request payload"})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *UserService) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload model.ResetPasswordPayload
+	if !utils.ReadJSON(w, r, &payload) {
 		return
 	}
 
-	if payload.Email == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, model.ErrorResponse{Error: "missing email"})
+	hashedPW, err := middleware.HashPassword(payload.Password)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "error resetting password")
 		return
 	}
 
-	user, err := s.store.GetUserByEmail(payload.Email)
+	token, err := s.store.ConsumeUserToken(r.Context(), model.TokenPurposePasswordReset, middleware.HashToken(payload.Token))
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error resetting password")
+		return
+	}
+
+	if err := s.store.UpdateUserPassword(r.Context(), token.UserID, hashedPW); err != nil {
+		writeStoreError(w, r, err, "handleResetPassword: error resetting password")
 		return
 	}
 
-	log.Printf("Login attempt for user: %s, Stored Hashed Password: %s", user.Email, user.Password)
+	// whoever made the reset necessary may still be signed in
+	if _, err := s.store.RevokeOtherSessions(r.Context(), token.UserID, ""); err != nil {
+		logging.FromContext(r.Context()).Error("handleResetPassword: error revoking sessions", "user_id", token.UserID, "error", err)
+	}
+	if _, err := s.store.RevokeUserAccessTokens(r.Context(), token.UserID); err != nil {
+		logging.FromContext(r.Context()).Error("handleResetPassword: error revoking access tokens", "user_id", token.UserID, "error", err)
+	}
 
-	if !middleware.CheckPasswordHash(payload.Password, user.Password) {
-		log.Printf("Password mismatch: Provided Password: %s, Hashed Password: %s", payload.Password, user.Password)
-		utils.WriteJSON(w, http.StatusUnauthorized, model.ErrorResponse{Error: "wrong password"})
+	// the reset link was delivered to the user's inbox, which proves ownership
+	if err := s.store.SetUserVerified(r.Context(), token.UserID); err != nil {
+		logging.FromContext(r.Context()).Error("handleResetPassword: error marking user as verified", "user_id", token.UserID, "error", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *UserService) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var payload model.VerifyEmailPayload
+	if !utils.ReadJSON(w, r, &payload) {
 		return
 	}
 
-	token, err := createAndSetAuthCookie(user.ID, w)
+	token, err := s.store.ConsumeUserToken(r.Context(), model.TokenPurposeEmailVerification, middleware.HashToken(payload.Token))
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, model.ErrorResponse{Error: "error creating token session"})
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidToken.Error())
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "error verifying email")
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, token)
+
+	if err := s.store.SetUserVerified(r.Context(), token.UserID); err != nil {
+		writeStoreError(w, r, err, "handleVerifyEmail: error verifying email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func validateUserPayload(user *model.User) error {
-	if user.Email == "" {
-		return errEmailRequired
+// issueUserToken creates a single-use token for the user and returns the raw
+// value, which is only ever sent to the user and never stored.
+func (s *UserService) issueUserToken(ctx context.Context, userID int64, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := middleware.GenerateToken()
+	if err != nil {
+		return "", err
 	}
 
-	if user.FirstName == "" {
-		return errFirstNameRequired
+	_, err = s.store.CreateUserToken(ctx, &model.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
 	}
 
-	if user.LastName == "" {
-		return errLastNameRequired
+	return token, nil
+}
+
+func (s *UserService) sendVerificationEmail(ctx context.Context, user *model.User) error {
+	token, err := s.issueUserToken(ctx, user.ID, model.TokenPurposeEmailVerification, config.Envs.EmailVerificationTTL)
+	if err != nil {
+		return err
 	}
 
-	if user.Password == "" {
-		return errPasswordRequired
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below:\n\n%s/verify-email?token=%s\n\nThe link expires in %s.",
+			config.Envs.AppURL, url.QueryEscape(token), config.Envs.EmailVerificationTTL),
+	})
+}
+
+func (s *UserService) sendPasswordResetEmail(ctx context.Context, user *model.User) error {
+	token, err := s.issueUserToken(ctx, user.ID, model.TokenPurposePasswordReset, config.Envs.PasswordResetTTL)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone requested a password reset for your account. Choose a new password here:\n\n%s/reset-password?token=%s\n\nThe link expires in %s. If you did not request this, you can ignore this email.",
+			config.Envs.AppURL, url.QueryEscape(token), config.Envs.PasswordResetTTL),
+	})
 }
 
-func createAndSetAuthCookie(id int64, w http.ResponseWriter) (string, error) {
-	secretKey := []byte(config.Envs.JWTSecret)
-	token, err := middleware.CreateJWT(secretKey, id)
+// createAndSetAuthCookie records a new session for the device the request
+// came from and returns a session token for it. Browsers also receive the
+// token in an HttpOnly cookie, along with the CSRF token bound to it.
+func createAndSetAuthCookie(store repository.Store, w http.ResponseWriter, r *http.Request, id int64) (string, error) {
+	session, err := createSession(store, r, id)
 	if err != nil {
 		return "", err
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:  "Authorization",
-		Value: token,
-	})
+	csrfToken, _, err := middleware.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := middleware.CreateJWT(id, session.ID, csrfToken)
+	if err != nil {
+		return "", err
+	}
+
+	middleware.SetSessionCookies(w, token, csrfToken, session.ExpiresAt)
 
 	return token, nil
 }
+
+// checkAccountUsable rejects logins to accounts an administrator has
+// deactivated.
+func checkAccountUsable(user *model.User) error {
+	if user.DeactivatedAt != nil {
+		return errAccountDeactivated
+	}
+	return nil
+}
@@ -2,93 +2,24 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/DaffaJatmiko/go-rest-project-manager/mailer"
 	"github.com/DaffaJatmiko/go-rest-project-manager/model"
 	"github.com/DaffaJatmiko/go-rest-project-manager/repository"
 	"github.com/gorilla/mux"
 )
 
-func TestValidateUserPayload(t *testing.T) {
-	type args struct {
-		user *model.User
-	}
-	tests := []struct {
-		name string
-		args args
-		want error
-	}{
-
-		{
-			name: "should return error if email is empty",
-			args: args{
-				user: &model.User{
-					FirstName: "John",
-					LastName:  "Doe",
-				},
-			},
-			want: errEmailRequired,
-		},
-		{
-			name: "should return error if first name is empty",
-			args: args{
-				user: &model.User{
-					Email:    "joe@mail.com",
-					LastName: "Doe",
-				},
-			},
-			want: errFirstNameRequired,
-		},
-		{
-			name: "should return error if last name is empty",
-			args: args{
-				user: &model.User{
-					Email:     "joe@mail.com",
-					FirstName: "John",
-				},
-			},
-			want: errLastNameRequired,
-		},
-		{
-			name: "should return error if the password is empty",
-			args: args{
-				user: &model.User{
-					Email:     "joe@mail.com",
-					FirstName: "John",
-				},
-			},
-			want: errLastNameRequired,
-		},
-		{
-			name: "should return nil if all fields are present",
-			args: args{
-				user: &model.User{
-					Email:     "joe@mail.com",
-					FirstName: "John",
-					LastName:  "Doe",
-					Password:  "password",
-				},
-			},
-			want: nil,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := validateUserPayload(tt.args.user); got != tt.want {
-				t.Errorf("validateUserPayload() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestCreateUser(t *testing.T) {
 	// Create a new project
 	ms := &repository.MockStore{}
-	service := NewUserService(ms)
+	service := NewUserService(ms, &mailer.MockMailer{})
 
 	t.Run("should validate if the email is not empty", func(t *testing.T) {
 		payload := &model.RegisterPayload{
@@ -119,14 +50,14 @@ func TestCreateUser(t *testing.T) {
 			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
 		}
 
-		var response model.ErrorResponse
+		var response model.Problem
 		err = json.NewDecoder(rr.Body).Decode(&response)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if response.Error != errEmailRequired.Error() {
-			t.Errorf("expected error message %s, got %s", response.Error, errEmailRequired.Error())
+		if response.Detail != "email is required" {
+			t.Errorf("expected error message %s, got %s", "email is required", response.Detail)
 		}
 	})
 
@@ -159,4 +90,201 @@ func TestCreateUser(t *testing.T) {
 			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
 		}
 	})
-}
\ No newline at end of file
+}
+
+// tokenStore lets tests control user lookups and token consumption.
+type tokenStore struct {
+	repository.MockStore
+	user          *model.User
+	consumeErr    error
+	tokens        []*model.UserToken
+	passwordHash  string
+	verifiedUsers []int64
+	revokedUsers  []int64
+	revokedTokens []int64
+}
+
+func (s *tokenStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	if s.user == nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.user, nil
+}
+
+func (s *tokenStore) CreateUserToken(ctx context.Context, t *model.UserToken) (*model.UserToken, error) {
+	s.tokens = append(s.tokens, t)
+	return t, nil
+}
+
+func (s *tokenStore) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	if s.consumeErr != nil {
+		return nil, s.consumeErr
+	}
+	return &model.UserToken{UserID: 7, Purpose: purpose, TokenHash: tokenHash}, nil
+}
+
+func (s *tokenStore) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error {
+	s.passwordHash = passwordHash
+	return nil
+}
+
+func (s *tokenStore) SetUserVerified(ctx context.Context, userID int64) error {
+	s.verifiedUsers = append(s.verifiedUsers, userID)
+	return nil
+}
+
+func (s *tokenStore) RevokeOtherSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	if keepID != "" {
+		return 0, nil
+	}
+	s.revokedUsers = append(s.revokedUsers, userID)
+	return 1, nil
+}
+
+func (s *tokenStore) RevokeUserAccessTokens(ctx context.Context, userID int64) (int64, error) {
+	s.revokedTokens = append(s.revokedTokens, userID)
+	return 1, nil
+}
+
+func postJSON(t *testing.T, handler http.HandlerFunc, path string, payload any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc(path, handler)
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestForgotPassword(t *testing.T) {
+	t.Run("should email a reset link to a known user", func(t *testing.T) {
+		store := &tokenStore{user: &model.User{ID: 7, Email: "joe@mail.com"}}
+		m := &mailer.MockMailer{}
+		service := NewUserService(store, m)
+
+		rr := postJSON(t, service.handleForgotPassword, "/users/password/forgot", &model.ForgotPasswordPayload{Email: "joe@mail.com"})
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+
+		if len(m.Sent) != 1 || m.Sent[0].To != "joe@mail.com" {
+			t.Fatalf("expected one email to joe@mail.com, got %+v", m.Sent)
+		}
+
+		if len(store.tokens) != 1 || store.tokens[0].Purpose != model.TokenPurposePasswordReset {
+			t.Fatalf("expected one password reset token, got %+v", store.tokens)
+		}
+
+		if strings.Contains(m.Sent[0].Body, store.tokens[0].TokenHash) {
+			t.Error("the email should contain the raw token, not its hash")
+		}
+	})
+
+	t.Run("should not reveal whether the email exists", func(t *testing.T) {
+		m := &mailer.MockMailer{}
+		service := NewUserService(&tokenStore{}, m)
+
+		rr := postJSON(t, service.handleForgotPassword, "/users/password/forgot", &model.ForgotPasswordPayload{Email: "nobody@mail.com"})
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+
+		if len(m.Sent) != 0 {
+			t.Errorf("expected no email to be sent, got %d", len(m.Sent))
+		}
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	t.Run("should reject a missing token", func(t *testing.T) {
+		service := NewUserService(&tokenStore{}, &mailer.MockMailer{})
+
+		rr := postJSON(t, service.handleResetPassword, "/users/password/reset", &model.ResetPasswordPayload{Password: "newpassword"})
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject a used or expired token", func(t *testing.T) {
+		service := NewUserService(&tokenStore{consumeErr: sql.ErrNoRows}, &mailer.MockMailer{})
+
+		rr := postJSON(t, service.handleResetPassword, "/users/password/reset", &model.ResetPasswordPayload{Token: "stale", Password: "newpassword"})
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should store the new password hashed", func(t *testing.T) {
+		store := &tokenStore{}
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		rr := postJSON(t, service.handleResetPassword, "/users/password/reset", &model.ResetPasswordPayload{Token: "valid", Password: "newpassword"})
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if store.passwordHash == "" || store.passwordHash == "newpassword" {
+			t.Errorf("expected a password hash to be stored, got %q", store.passwordHash)
+		}
+	})
+
+	t.Run("should sign the user out everywhere", func(t *testing.T) {
+		store := &tokenStore{}
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		rr := postJSON(t, service.handleResetPassword, "/users/password/reset", &model.ResetPasswordPayload{Token: "valid", Password: "newpassword"})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if len(store.revokedUsers) != 1 || store.revokedUsers[0] != 7 {
+			t.Errorf("expected every session of user 7 to be revoked, got %v", store.revokedUsers)
+		}
+		if len(store.revokedTokens) != 1 || store.revokedTokens[0] != 7 {
+			t.Errorf("expected the access tokens of user 7 to be revoked, got %v", store.revokedTokens)
+		}
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Run("should mark the user as verified", func(t *testing.T) {
+		store := &tokenStore{}
+		service := NewUserService(store, &mailer.MockMailer{})
+
+		rr := postJSON(t, service.handleVerifyEmail, "/users/verify", &model.VerifyEmailPayload{Token: "valid"})
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if len(store.verifiedUsers) != 1 || store.verifiedUsers[0] != 7 {
+			t.Errorf("expected user 7 to be verified, got %v", store.verifiedUsers)
+		}
+	})
+
+	t.Run("should reject an invalid token", func(t *testing.T) {
+		service := NewUserService(&tokenStore{consumeErr: sql.ErrNoRows}, &mailer.MockMailer{})
+
+		rr := postJSON(t, service.handleVerifyEmail, "/users/verify", &model.VerifyEmailPayload{Token: "bogus"})
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
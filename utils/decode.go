@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+	"github.com/DaffaJatmiko/go-rest-project-manager/validate"
+)
+
+// ReadJSON decodes the JSON body of r into v, a pointer to a payload, and
+// checks it against the validate tags of the payload. Bodies larger than
+// MAX_BODY_BYTES, malformed JSON, fields the payload does not have and
+// invalid values are answered with a problem, in which case ReadJSON
+// returns false.
+func ReadJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	defer r.Body.Close()
+
+	if err := decode(http.MaxBytesReader(w, r.Body, config.Envs.MaxBodyBytes), v); err != nil {
+		writeDecodeError(w, err)
+		return false
+	}
+
+	if err := validate.Struct(v); err != nil {
+		WriteValidationError(w, err)
+		return false
+	}
+	return true
+}
+
+// MergePatchContentType is the media type of JSON merge patches (RFC 7396).
+const MergePatchContentType = "application/merge-patch+json"
+
+// ReadMergePatch decodes a JSON merge patch from the body of r into v, a
+// pointer to a payload of pointer fields, leaving the fields the patch does
+// not mention nil. None of the patchable fields can be removed, so members
+// set to null are rejected. Patches are accepted as MergePatchContentType or
+// plain JSON; like ReadJSON, ReadMergePatch answers anything else with a
+// problem and returns false.
+func ReadMergePatch(w http.ResponseWriter, r *http.Request, v any) bool {
+	defer r.Body.Close()
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != MergePatchContentType && mediaType != "application/json" {
+		w.Header().Set("Accept-Patch", MergePatchContentType)
+		WriteError(w, http.StatusUnsupportedMediaType, "patches must be sent as "+MergePatchContentType)
+		return false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, config.Envs.MaxBodyBytes))
+	if err == nil {
+		err = decode(bytes.NewReader(body), v)
+	}
+	if err != nil {
+		writeDecodeError(w, err)
+		return false
+	}
+
+	// the body decoded into a struct, so it is an object or null
+	var members map[string]json.RawMessage
+	json.Unmarshal(body, &members)
+	if members == nil {
+		WriteProblem(w, model.Problem{Status: http.StatusBadRequest, Code: model.ProblemInvalidJSON, Detail: "merge patch must be a JSON object"})
+		return false
+	}
+
+	var removed []string
+	for name, value := range members {
+		if string(value) == "null" {
+			removed = append(removed, name)
+		}
+	}
+	slices.Sort(removed)
+
+	var errs model.FieldErrors
+	for _, name := range removed {
+		errs = append(errs, model.FieldError{Field: name, Code: model.FieldRequired, Message: name + " cannot be removed"})
+	}
+	var invalid model.FieldErrors
+	if errors.As(validate.Struct(v), &invalid) {
+		errs = append(errs, invalid...)
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, errs)
+		return false
+	}
+	return true
+}
+
+// decode decodes a single JSON value from body into v, rejecting fields v
+// does not have.
+func decode(body io.Reader, v any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errTrailingData
+	}
+	return err
+}
+
+var errTrailingData = errors.New("request body must hold a single JSON value")
+
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		WriteValidationError(w, model.FieldError{Field: typeErr.Field, Code: model.FieldInvalid, Message: fmt.Sprintf("%s must be a JSON %s", typeErr.Field, jsonType(typeErr.Type.String()))})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		WriteValidationError(w, model.FieldError{Field: field, Code: model.FieldUnknown, Message: field + " is not a known field"})
+	case errors.Is(err, io.EOF):
+		WriteProblem(w, model.Problem{Status: http.StatusBadRequest, Code: model.ProblemInvalidJSON, Detail: "request body is empty"})
+	case errors.Is(err, errTrailingData):
+		WriteProblem(w, model.Problem{Status: http.StatusBadRequest, Code: model.ProblemInvalidJSON, Detail: err.Error()})
+	default:
+		WriteInvalidJSON(w)
+	}
+}
+
+// jsonType names the JSON type that decodes into the Go type goType.
+func jsonType(goType string) string {
+	goType = strings.TrimLeft(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		return "array"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"), strings.HasPrefix(goType, "float"):
+		return "number"
+	case goType == "string":
+		return "string"
+	case goType == "bool":
+		return "boolean"
+	default:
+		return "object"
+	}
+}
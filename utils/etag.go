@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/config"
+)
+
+// ETag returns the entity tag of a resource at version.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// SetETag sets the ETag header of a response holding a resource at version.
+func SetETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", ETag(version))
+}
+
+// NotModified tells whether the If-None-Match header of r lists the ETag of
+// version, so that the client's copy of the resource is current.
+func NotModified(r *http.Request, version int64) bool {
+	etag := ETag(version)
+	for _, tag := range entityTags(r.Header.Get("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckIfMatch checks that a change to a resource at version is based on
+// that version, as named by the If-Match header of r. Requests without the
+// header are refused with 428 Precondition Required if IF_MATCH_REQUIRED is
+// set, and requests based on another version with 412 Precondition Failed;
+// CheckIfMatch then returns false.
+func CheckIfMatch(w http.ResponseWriter, r *http.Request, version int64) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if config.Envs.IfMatchRequired {
+			WriteError(w, http.StatusPreconditionRequired, "the If-Match header must hold the ETag of the resource")
+			return false
+		}
+		return true
+	}
+
+	// If-Match compares strongly, so weak tags never match
+	etag := ETag(version)
+	for _, tag := range entityTags(header) {
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	WriteError(w, http.StatusPreconditionFailed, "the resource has been changed since it was read")
+	return false
+}
+
+func entityTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+// ProblemContentType is the media type of error responses.
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix is followed by the problem code in the type URI of a
+// problem, such as "urn:project-manager:problem:not_found".
+const ProblemTypePrefix = "urn:project-manager:problem:"
+
+// internalErrorDetail replaces the detail of every 500 response, so that no
+// database or other internal error reaches clients.
+const internalErrorDetail = "an internal error occurred"
+
+var problemCodes = map[int]string{
+	http.StatusBadRequest:            model.ProblemBadRequest,
+	http.StatusUnauthorized:          model.ProblemUnauthorized,
+	http.StatusForbidden:             model.ProblemForbidden,
+	http.StatusNotFound:              model.ProblemNotFound,
+	http.StatusMethodNotAllowed:      model.ProblemMethodNotAllowed,
+	http.StatusConflict:              model.ProblemConflict,
+	http.StatusGone:                  model.ProblemGone,
+	http.StatusPreconditionFailed:    model.ProblemPreconditionFailed,
+	http.StatusPreconditionRequired:  model.ProblemPreconditionRequired,
+	http.StatusRequestEntityTooLarge: model.ProblemPayloadTooLarge,
+	http.StatusUnsupportedMediaType:  model.ProblemUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   model.ProblemValidationFailed,
+	http.StatusTooManyRequests:       model.ProblemRateLimited,
+	http.StatusInternalServerError:   model.ProblemInternalError,
+	http.StatusBadGateway:            model.ProblemBadGateway,
+	http.StatusServiceUnavailable:    model.ProblemUnavailable,
+}
+
+// WriteError writes a problem with the default code of status.
+func WriteError(w http.ResponseWriter, status int, detail string) {
+	WriteProblem(w, model.Problem{Status: status, Detail: detail})
+}
+
+// WriteInvalidJSON answers a request whose body could not be read or is
+// not the JSON expected.
+func WriteInvalidJSON(w http.ResponseWriter) {
+	WriteProblem(w, model.Problem{Status: http.StatusBadRequest, Code: model.ProblemInvalidJSON, Detail: "invalid request payload"})
+}
+
+// WriteValidationError answers a request that failed validation with err.
+// The model.FieldErrors or model.FieldError in err are listed in the errors
+// of the problem.
+func WriteValidationError(w http.ResponseWriter, err error) {
+	p := model.Problem{Status: http.StatusBadRequest, Code: model.ProblemValidationFailed, Detail: err.Error()}
+	var fields model.FieldErrors
+	var field model.FieldError
+	switch {
+	case errors.As(err, &fields):
+		p.Errors = fields
+		if len(fields) > 1 {
+			p.Detail = fmt.Sprintf("%d fields are invalid", len(fields))
+		}
+	case errors.As(err, &field):
+		p.Errors = []model.FieldError{field}
+	}
+	WriteProblem(w, p)
+}
+
+// NotFound answers requests that match no route.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusNotFound, "no such route")
+}
+
+// MethodNotAllowed answers requests whose route does not accept their
+// method.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusMethodNotAllowed, r.Method+" is not allowed on this route")
+}
+
+// WriteProblem writes p, filling in its type, title and, when left empty,
+// its code. The detail of internal errors is never sent.
+func WriteProblem(w http.ResponseWriter, p model.Problem) {
+	if p.Code == "" {
+		p.Code = problemCodes[p.Status]
+	}
+	if p.Code == "" {
+		p.Code = model.ProblemBadRequest
+		if p.Status >= http.StatusInternalServerError {
+			p.Code = model.ProblemInternalError
+		}
+	}
+	p.Type = ProblemTypePrefix + p.Code
+	p.Title = http.StatusText(p.Status)
+	if p.Status == http.StatusInternalServerError {
+		p.Detail = internalErrorDetail
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
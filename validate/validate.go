@@ -0,0 +1,228 @@
+// Package validate checks request payloads against the rules in the validate
+// tags of their fields, such as
+//
+//	Email string `json:"email" validate:"required,email,max=255"`
+//
+// Every field is checked, so that a client learns about all of its mistakes
+// at once. Rules other than required accept the zero value. A nil pointer,
+// such as a field left out of a partial update, skips every rule, while the
+// value of a non-nil pointer is checked like any other.
+//
+// The rules are:
+//
+//	required   set, and for strings not blank; slices must not be empty
+//	min=n      at least n characters, elements or, for numbers, n
+//	max=n      at most n characters, elements or, for numbers, n
+//	enum=name  one of the values listed under name in Enums; for slices,
+//	           every element
+//	email      a bare email address
+//	slug       an organization slug
+//	timezone   an IANA time zone name such as Europe/Berlin
+//	locale     a language tag such as en or pt-BR
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezone validation must not depend on the host's zoneinfo
+	"unicode/utf8"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+// Enums lists the values allowed by each enum rule.
+var Enums = map[string][]string{
+	"taskstatus":  model.TaskStatuses,
+	"role":        model.Roles,
+	"orgrole":     model.OrgRoles,
+	"projectrole": model.ProjectRoles,
+	"scope":       model.AccessTokenScopes,
+}
+
+var (
+	slugPattern   = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,48}[a-z0-9])?$`)
+	localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+)
+
+type format struct {
+	valid   func(string) bool
+	message string
+}
+
+var formats = map[string]format{
+	"email":    {validEmail, "must be a valid email address"},
+	"slug":     {ValidSlug, "must be 1-50 lowercase letters, digits or dashes, contain a letter, and not start or end with a dash"},
+	"timezone": {validTimezone, "must be an IANA time zone such as Europe/Berlin"},
+	"locale":   {localePattern.MatchString, "must be a language tag such as en or pt-BR"},
+}
+
+// Struct checks v, a struct or a pointer to one, and returns every rule it
+// breaks as model.FieldErrors, or nil. Malformed tags panic, as they are
+// mistakes in the code rather than in the request.
+func Struct(v any) error {
+	var errs model.FieldErrors
+	checkStruct(reflect.Indirect(reflect.ValueOf(v)), &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ValidSlug tells whether slug can identify an organization.
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug) && strings.ContainsAny(slug, "abcdefghijklmnopqrstuvwxyz")
+}
+
+func checkStruct(v reflect.Value, errs *model.FieldErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			checkStruct(v.Field(i), errs)
+			continue
+		}
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		if err := checkField(jsonName(field), v.Field(i), strings.Split(tag, ",")); err != nil {
+			*errs = append(*errs, *err)
+		}
+	}
+}
+
+// checkField applies rules to the value of the field named name and returns
+// the first rule it breaks.
+func checkField(name string, v reflect.Value, rules []string) *model.FieldError {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	for _, rule := range rules {
+		rule, arg, _ := strings.Cut(rule, "=")
+		switch rule {
+		case "required":
+			if missing(v) {
+				return &model.FieldError{Field: name, Code: model.FieldRequired, Message: name + " is required"}
+			}
+		case "min", "max":
+			if err := checkBound(name, v, rule, arg); err != nil {
+				return err
+			}
+		case "enum":
+			allowed, ok := Enums[arg]
+			if !ok {
+				panic("validate: unknown enum " + arg)
+			}
+			if err := checkEnum(name, v, allowed); err != nil {
+				return err
+			}
+		default:
+			f, ok := formats[rule]
+			if !ok {
+				panic("validate: unknown rule " + rule)
+			}
+			if s := v.String(); s != "" && !f.valid(s) {
+				return &model.FieldError{Field: name, Code: model.FieldInvalid, Message: name + " " + f.message}
+			}
+		}
+	}
+	return nil
+}
+
+func missing(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+func checkBound(name string, v reflect.Value, rule, arg string) *model.FieldError {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		panic("validate: invalid " + rule + " " + arg)
+	}
+
+	var size int64
+	var unit string
+	switch v.Kind() {
+	case reflect.String:
+		size, unit = int64(utf8.RuneCountInString(v.String())), "characters"
+	case reflect.Slice:
+		size, unit = int64(v.Len()), "elements"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = v.Int()
+	default:
+		panic("validate: " + rule + " does not apply to " + v.Kind().String())
+	}
+
+	// zero values are left to required
+	if v.IsZero() {
+		return nil
+	}
+
+	switch {
+	case rule == "min" && size < n && unit == "":
+		return &model.FieldError{Field: name, Code: model.FieldOutOfRange, Message: fmt.Sprintf("%s must be at least %d", name, n)}
+	case rule == "max" && size > n && unit == "":
+		return &model.FieldError{Field: name, Code: model.FieldOutOfRange, Message: fmt.Sprintf("%s must be at most %d", name, n)}
+	case rule == "min" && size < n:
+		return &model.FieldError{Field: name, Code: model.FieldTooShort, Message: fmt.Sprintf("%s must be at least %d %s", name, n, unit)}
+	case rule == "max" && size > n:
+		return &model.FieldError{Field: name, Code: model.FieldTooLong, Message: fmt.Sprintf("%s must be at most %d %s", name, n, unit)}
+	}
+	return nil
+}
+
+func checkEnum(name string, v reflect.Value, allowed []string) *model.FieldError {
+	values := []string{v.String()}
+	if v.Kind() == reflect.Slice {
+		values = v.Interface().([]string)
+	}
+
+	for _, value := range values {
+		if value != "" && !slices.Contains(allowed, value) {
+			return &model.FieldError{Field: name, Code: model.FieldInvalid, Message: fmt.Sprintf("%s must be one of %s", name, strings.Join(allowed, ", "))}
+		}
+	}
+	return nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// validTimezone accepts IANA names such as "Europe/Berlin" and "UTC".
+func validTimezone(tz string) bool {
+	if tz == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
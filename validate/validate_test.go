@@ -0,0 +1,100 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/go-rest-project-manager/model"
+)
+
+func fields(err error) []string {
+	var errs model.FieldErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	var names []string
+	for _, e := range errs {
+		names = append(names, e.Field+":"+e.Code)
+	}
+	return names
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload any
+		want    []string
+	}{
+		{
+			name:    "should accept a valid payload",
+			payload: &model.RegisterPayload{Email: "joe@mail.com", FirstName: "John", LastName: "Doe", Password: "password"},
+		},
+		{
+			name:    "should report every missing field at once",
+			payload: &model.RegisterPayload{Email: "joe@mail.com", FirstName: " "},
+			want:    []string{"firstName:required", "lastName:required", "password:required"},
+		},
+		{
+			name:    "should check the email format",
+			payload: &model.RegisterPayload{Email: "Joe <joe@mail.com>", FirstName: "John", LastName: "Doe", Password: "password"},
+			want:    []string{"email:invalid"},
+		},
+		{
+			name:    "should count characters rather than bytes",
+			payload: &model.CreateTeamPayload{Name: strings.Repeat("é", 255)},
+		},
+		{
+			name:    "should limit the length to the column",
+			payload: &model.CreateTeamPayload{Name: strings.Repeat("a", 256)},
+			want:    []string{"name:too_long"},
+		},
+		{
+			name:    "should only allow known statuses",
+			payload: &model.Task{Name: "Write docs", Status: "BLOCKED", ProjectID: 1, AssignedToID: 7},
+			want:    []string{"status:invalid"},
+		},
+		{
+			name:    "should check every element of a slice",
+			payload: &model.CreateAccessTokenPayload{Name: "ci", Scopes: []string{model.ScopeTasksRead, "admin"}},
+			want:    []string{"scopes:invalid"},
+		},
+		{
+			name:    "should check the range of numbers",
+			payload: &model.CreateAccessTokenPayload{Name: "ci", Scopes: []string{model.ScopeTasksRead}, ExpiresInDays: -1},
+			want:    []string{"expiresInDays:out_of_range"},
+		},
+		{
+			name:    "should skip fields left out of a partial update",
+			payload: &model.UpdateProfilePayload{Locale: ptr("pt-BR")},
+		},
+		{
+			name:    "should check fields set in a partial update",
+			payload: &model.UpdateProfilePayload{FirstName: ptr(""), Timezone: ptr("Mars/Olympus_Mons")},
+			want:    []string{"firstName:required", "timezone:invalid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(tt.payload)
+			if got := fields(err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestValidSlug(t *testing.T) {
+	for slug, want := range map[string]bool{"acme": true, "acme-2": true, "42": false, "-acme": false, "Acme": false} {
+		if got := ValidSlug(slug); got != want {
+			t.Errorf("ValidSlug(%q) = %v, want %v", slug, got, want)
+		}
+	}
+}